@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/mxschmitt/golang-url-shortener/internal/handlers/auth"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/mxschmitt/golang-url-shortener/internal/util"
+	"github.com/sirupsen/logrus"
+)
+
+// visitorClaims returns the identity of a visitor who resolves an entry
+// in the browser, or nil if the visitor is not authenticated
+func (h *Handler) visitorClaims(c *gin.Context) *auth.JWTClaims {
+	switch util.GetConfig().AuthBackend {
+	case "oauth":
+		token, ok := sessions.Default(c).Get("token").(string)
+		if !ok || token == "" {
+			return nil
+		}
+		claims, err := h.parseJWT(token)
+		if err == nil {
+			return claims
+		}
+		logrus.Debugf("Could not parse session token of visitor: %v", err)
+		// the access token is short-lived, so it is renewed with the
+		// refresh token of the session if it is expired
+		refreshToken, _ := sessions.Default(c).Get("refreshToken").(string)
+		if refreshToken == "" {
+			return nil
+		}
+		if token, refreshToken, err = h.refreshSession(refreshToken); err != nil {
+			logrus.Debugf("Could not refresh session of visitor: %v", err)
+			return nil
+		}
+		if err := saveBrowserSession(c, token, refreshToken); err != nil {
+			logrus.Warningf("Could not save refreshed session of visitor: %v", err)
+		}
+		if claims, err = h.parseJWT(token); err != nil {
+			return nil
+		}
+		return claims
+	case "proxy":
+		if c.GetHeader(util.GetConfig().Proxy.UserHeader) == "" {
+			return nil
+		}
+		claims, err := h.fakeClaimsForProxy(c)
+		if err != nil {
+			return nil
+		}
+		return claims
+	}
+	return nil
+}
+
+// checkAccessPolicy enforces the access policy of an entry. If the visitor
+// is not authenticated, the visitor is sent through the login and comes back
+// afterwards. It returns false if the request was already answered.
+func (h *Handler) checkAccessPolicy(c *gin.Context, entry *shared.Entry) bool {
+	if !entry.Access.RequiresAuthentication() {
+		return true
+	}
+	c.Header("Cache-Control", "no-cache, no-store")
+	claims := h.visitorClaims(c)
+	if claims == nil {
+		h.redirectToLogin(c)
+		return false
+	}
+	if !entry.Access.Allows(claims.OAuthProvider, claims.OAuthID, claims.OAuthEmail) {
+		c.HTML(http.StatusForbidden, "error.html", gin.H{
+			"Title":   "Access denied",
+			"Message": "You are not allowed to access this link.",
+		})
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// redirectToLogin sends the visitor to the configured login flow
+func (h *Handler) redirectToLogin(c *gin.Context) {
+	defer c.Abort()
+	returnTo := c.Request.URL.RequestURI()
+	switch util.GetConfig().AuthBackend {
+	case "oauth":
+		if len(h.providers) == 1 {
+			c.Redirect(http.StatusTemporaryRedirect, loginURL(h.providers[0], returnTo))
+			return
+		}
+		if len(h.providers) > 1 {
+			logins := map[string]string{}
+			for _, provider := range h.providers {
+				logins[provider] = loginURL(provider, returnTo)
+			}
+			c.HTML(http.StatusUnauthorized, "login.html", gin.H{
+				"Logins": logins,
+			})
+			return
+		}
+	case "proxy":
+		if loginURL := util.GetConfig().Proxy.LoginURL; loginURL != "" {
+			u, err := url.Parse(loginURL)
+			if err == nil {
+				query := u.Query()
+				query.Set("rd", util.GetConfig().BaseURL+returnTo)
+				u.RawQuery = query.Encode()
+				c.Redirect(http.StatusTemporaryRedirect, u.String())
+				return
+			}
+			logrus.Errorf("could not parse proxy login URL: %v", err)
+		}
+	}
+	c.HTML(http.StatusUnauthorized, "error.html", gin.H{
+		"Title":   "Login required",
+		"Message": "You need to be logged in to access this link.",
+	})
+}
+
+func loginURL(provider, returnTo string) string {
+	return "/api/v1/auth/" + provider + "/login?returnTo=" + url.QueryEscape(returnTo)
+}
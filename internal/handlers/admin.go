@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+)
+
+// Page sizes of the entries of the admin API
+const (
+	adminDefaultLimit = 100
+	adminMaxLimit     = 1000
+)
+
+// adminEntry is an entry together with its owner, as it is seen by admins
+type adminEntry struct {
+	ID         string
+	Owner      string
+	TeamID     string `json:",omitempty"`
+	RemoteAddr string `json:",omitempty"`
+	Protected  bool   `json:",omitempty"`
+	Public     shared.EntryPublicData
+}
+
+func newAdminEntry(id string, entry shared.Entry) adminEntry {
+	return adminEntry{
+		ID:         id,
+		Owner:      shared.Identity(entry.OAuthProvider, entry.OAuthID),
+		TeamID:     entry.TeamID,
+		RemoteAddr: entry.RemoteAddr,
+		Protected:  len(entry.Password) > 0,
+		Public:     entry.Public,
+	}
+}
+
+// handleAdminEntries lists and searches all entries, the newest first
+func (h *Handler) handleAdminEntries(c *gin.Context) {
+	var query struct {
+		Query  string `form:"q"`
+		Offset int    `form:"offset"`
+		Limit  int    `form:"limit"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if query.Limit <= 0 {
+		query.Limit = adminDefaultLimit
+	} else if query.Limit > adminMaxLimit {
+		query.Limit = adminMaxLimit
+	}
+	entries, err := h.store.SearchEntries(query.Query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result := make([]adminEntry, 0, len(entries))
+	for id, entry := range entries {
+		result = append(result, newAdminEntry(id, entry))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].Public.CreatedOn.Equal(result[j].Public.CreatedOn) {
+			return result[i].Public.CreatedOn.After(result[j].Public.CreatedOn)
+		}
+		return result[i].ID < result[j].ID
+	})
+	total := len(result)
+	if query.Offset < 0 || query.Offset > total {
+		query.Offset = total
+	}
+	if end := query.Offset + query.Limit; end < total {
+		result = result[:end]
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Total":   total,
+		"Entries": result[query.Offset:],
+	})
+}
+
+// handleAdminEntry returns any entry together with its owner and its statistics
+func (h *Handler) handleAdminEntry(c *gin.Context) {
+	id := c.Param("id")
+	entry, err := h.store.GetEntryByID(id)
+	if errors.Cause(err) == shared.ErrNoEntryFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": shared.ErrNoEntryFound.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	stats, err := h.store.GetStats(id, stores.StatsQuery{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Entry": newAdminEntry(id, *entry),
+		"Stats": stats,
+	})
+}
+
+// handleAdminDeleteEntry deletes any entry without its deletion URL
+func (h *Handler) handleAdminDeleteEntry(c *gin.Context) {
+	h.respondAdminChange(c, h.store.AdminDeleteEntry(c.Param("id")))
+}
+
+// handleAdminSuspendEntry disables or enables the redirect of any entry
+func (h *Handler) handleAdminSuspendEntry(c *gin.Context) {
+	var data struct {
+		Suspended bool
+	}
+	if err := c.ShouldBind(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.respondAdminChange(c, h.store.SuspendEntry(c.Param("id"), data.Suspended))
+}
+
+// respondAdminChange responds with the result of a change of an entry
+func (h *Handler) respondAdminChange(c *gin.Context, err error) {
+	if errors.Cause(err) == shared.ErrNoEntryFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": shared.ErrNoEntryFound.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// handleAdminUsers lists the users and teams together with the number of their entries
+func (h *Handler) handleAdminUsers(c *gin.Context) {
+	users, err := h.store.GetUserLinkCounts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+// handleAdminAudit returns the latest events of the audit log
+func (h *Handler) handleAdminAudit(c *gin.Context) {
+	var query struct {
+		Limit int `form:"limit"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if query.Limit <= 0 {
+		query.Limit = adminDefaultLimit
+	} else if query.Limit > adminMaxLimit {
+		query.Limit = adminMaxLimit
+	}
+	events, err := h.store.GetAuditEvents(query.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
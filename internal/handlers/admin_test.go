@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mxschmitt/golang-url-shortener/internal/stores"
+	"github.com/mxschmitt/golang-url-shortener/internal/util"
+)
+
+func TestAdminAPI(t *testing.T) {
+	config := util.GetConfig()
+	defer util.SetConfig(config)
+	adminConfig := config
+	adminConfig.Admin.Users = "google/admin"
+	util.SetConfig(adminConfig)
+	TestCreateBackend(t)
+	defer TestCloseBackend(t)
+	TestCreateNewJWT(t)
+	admin := signTestToken(t, "admin")
+	var created requestHelper
+	doJSONRequest(t, tokenString, "POST", "/api/v1/protected/create", makeJSON(t, requestHelper{URL: testURL}), http.StatusOK, &created)
+
+	doJSONRequest(t, tokenString, "GET", "/api/v1/admin/entries", "", http.StatusForbidden, nil)
+	var list struct {
+		Total   int
+		Entries []adminEntry
+	}
+	doJSONRequest(t, admin, "GET", "/api/v1/admin/entries?q="+created.ID, "", http.StatusOK, &list)
+	if list.Total != 1 || len(list.Entries) != 1 || list.Entries[0].ID != created.ID || list.Entries[0].Owner != "google/id" {
+		t.Fatalf("entries are not the expected ones: %+v", list)
+	}
+	doJSONRequest(t, admin, "GET", "/api/v1/admin/entries?limit=1&offset=1000", "", http.StatusOK, &list)
+	if len(list.Entries) != 0 {
+		t.Fatalf("entries after the last page: %+v", list.Entries)
+	}
+	var detail struct {
+		Entry adminEntry
+		Stats stores.Stats
+	}
+	doJSONRequest(t, admin, "GET", "/api/v1/admin/entries/"+created.ID, "", http.StatusOK, &detail)
+	if detail.Entry.Owner != "google/id" || detail.Entry.Public.URL != testURL {
+		t.Fatalf("entry is not the expected one: %+v", detail.Entry)
+	}
+	var users []stores.UserLinkCount
+	doJSONRequest(t, admin, "GET", "/api/v1/admin/users", "", http.StatusOK, &users)
+	found := false
+	for _, user := range users {
+		found = found || user.Owner == "google/id" && user.Links > 0
+	}
+	if !found {
+		t.Fatalf("users do not contain the owner: %+v", users)
+	}
+
+	doJSONRequest(t, admin, "POST", "/api/v1/admin/entries/"+created.ID+"/suspend", `{"Suspended":true}`, http.StatusOK, nil)
+	resp, err := http.Get(created.URL)
+	if err != nil {
+		t.Fatalf("could not visit entry: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGone {
+		t.Fatalf("expected status of a suspended entry: %d; got: %d", http.StatusGone, resp.StatusCode)
+	}
+	doJSONRequest(t, admin, "POST", "/api/v1/admin/entries/"+created.ID+"/suspend", `{"Suspended":false}`, http.StatusOK, nil)
+	testRedirect(t, created.URL, testURL)
+
+	doJSONRequest(t, tokenString, "DELETE", "/api/v1/admin/entries/"+created.ID, "", http.StatusForbidden, nil)
+	doJSONRequest(t, admin, "DELETE", "/api/v1/admin/entries/"+created.ID, "", http.StatusOK, nil)
+	doJSONRequest(t, admin, "GET", "/api/v1/admin/entries/"+created.ID, "", http.StatusNotFound, nil)
+	doJSONRequest(t, admin, "POST", "/api/v1/admin/entries/"+created.ID+"/suspend", `{"Suspended":true}`, http.StatusNotFound, nil)
+}
@@ -3,8 +3,10 @@ package handlers
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/mxschmitt/golang-url-shortener/internal/handlers/auth"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores"
 	"github.com/mxschmitt/golang-url-shortener/internal/util"
 	"github.com/sirupsen/logrus"
 
@@ -28,26 +30,29 @@ func (h *Handler) initOAuth() {
 	h.providers = []string{}
 	google := util.GetConfig().Google
 	if google.Enabled() {
-		auth.WithAdapterWrapper(auth.NewGoogleAdapter(google.ClientID, google.ClientSecret), h.engine.Group("/api/v1/auth/google"))
+		auth.WithAdapterWrapper(auth.NewGoogleAdapter(google.ClientID, google.ClientSecret), h.engine.Group("/api/v1/auth/google"), h.issueSession)
 		h.providers = append(h.providers, "google")
 	}
 	github := util.GetConfig().GitHub
 	if github.Enabled() {
-		auth.WithAdapterWrapper(auth.NewGithubAdapter(github.ClientID, github.ClientSecret, github.EndpointURL), h.engine.Group("/api/v1/auth/github"))
+		auth.WithAdapterWrapper(auth.NewGithubAdapter(github.ClientID, github.ClientSecret, github.EndpointURL), h.engine.Group("/api/v1/auth/github"), h.issueSession)
 		h.providers = append(h.providers, "github")
 	}
 	microsoft := util.GetConfig().Microsoft
 	if microsoft.Enabled() {
-		auth.WithAdapterWrapper(auth.NewMicrosoftAdapter(microsoft.ClientID, microsoft.ClientSecret), h.engine.Group("/api/v1/auth/microsoft"))
+		auth.WithAdapterWrapper(auth.NewMicrosoftAdapter(microsoft.ClientID, microsoft.ClientSecret), h.engine.Group("/api/v1/auth/microsoft"), h.issueSession)
 		h.providers = append(h.providers, "microsoft")
 	}
 	okta := util.GetConfig().Okta
 	if okta.Enabled() {
-		auth.WithAdapterWrapper(auth.NewOktaAdapter(okta.ClientID, okta.ClientSecret, okta.EndpointURL), h.engine.Group("/api/v1/auth/okta"))
+		auth.WithAdapterWrapper(auth.NewOktaAdapter(okta.ClientID, okta.ClientSecret, okta.EndpointURL), h.engine.Group("/api/v1/auth/okta"), h.issueSession)
 		h.providers = append(h.providers, "okta")
 	}
 
 	h.engine.POST("/api/v1/auth/check", h.handleAuthCheck)
+	h.engine.POST("/api/v1/auth/refresh", h.handleRefresh)
+	h.engine.POST("/api/v1/auth/logout", h.handleLogout)
+	h.engine.POST("/api/v1/auth/logout/all", h.handleLogoutAll)
 }
 
 // initProxyAuth intializes data structures for proxy authentication mode
@@ -75,16 +80,45 @@ func (h *Handler) parseJWT(wt string) (*auth.JWTClaims, error) {
 	if !token.Valid {
 		return nil, errors.New("token is not valid")
 	}
-	return token.Claims.(*auth.JWTClaims), nil
+	claims := token.Claims.(*auth.JWTClaims)
+	// the token is only valid as long as its session was not revoked
+	if claims.Id == "" {
+		return nil, errors.New("token has no session")
+	}
+	session, err := h.store.GetSession(claims.Id)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get session of token")
+	}
+	if session.OAuthProvider != claims.OAuthProvider || session.OAuthID != claims.OAuthID {
+		return nil, errors.New("token does not belong to its session")
+	}
+	return claims, nil
 }
 
-// oAuthMiddleware implements an auth layer that validates a JWT token
+// oAuthMiddleware implements an auth layer that validates a JWT token or a
+// personal API token, whose scope has to allow the request
 func (h *Handler) oAuthMiddleware(c *gin.Context) {
 	authError := func() error {
 		wt := c.GetHeader("Authorization")
 		if wt == "" {
 			return errors.New("Authorization header not set")
 		}
+		wt = strings.TrimPrefix(wt, "Bearer ")
+		if strings.HasPrefix(wt, stores.APITokenPrefix) {
+			token, err := h.store.AuthenticateAPIToken(wt)
+			if err != nil {
+				return errors.Wrap(err, "could not authenticate API token")
+			}
+			c.Set("user", &auth.JWTClaims{
+				OAuthProvider: token.OAuthProvider,
+				OAuthID:       token.OAuthID,
+				OAuthName:     token.OAuthName,
+				OAuthPicture:  token.OAuthPicture,
+				OAuthEmail:    token.OAuthEmail,
+			})
+			c.Set("tokenScope", token.Scope)
+			return nil
+		}
 		claims, err := h.parseJWT(wt)
 		if err != nil {
 			return errors.Wrap(err, "could not parse JWT")
@@ -99,6 +133,12 @@ func (h *Handler) oAuthMiddleware(c *gin.Context) {
 		logrus.Debugf("Authentication middleware check failed: %v\n", authError)
 		return
 	}
+	if scope := c.GetString("tokenScope"); scope != "" && !tokenScopeAllows(scope, c.Request.Method, c.FullPath()) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "the scope of the API token does not allow this request",
+		})
+		return
+	}
 	c.Next()
 }
 
@@ -153,6 +193,7 @@ func (h *Handler) fakeClaimsForProxy(c *gin.Context) (*auth.JWTClaims, error) {
 		OAuthName:     displayName,
 		OAuthPicture:  "/images/proxy_user.png",
 		OAuthProvider: "proxy",
+		OAuthEmail:    c.GetHeader(util.GetConfig().Proxy.EmailHeader),
 	}
 	return claims, nil
 }
@@ -187,15 +228,8 @@ func (h *Handler) handleAuthCheck(c *gin.Context) {
 		"Name":     claims.OAuthName,
 		"Picture":  claims.OAuthPicture,
 		"Provider": claims.OAuthProvider,
+		"Email":    claims.OAuthEmail,
 	}
 	logrus.Debugf("Found session data: %v", sessionData)
 	c.JSON(http.StatusOK, sessionData)
 }
-
-func (h *Handler) oAuthPropertiesEquals(c *gin.Context, oauthID, oauthProvider string) bool {
-	user := c.MustGet("user").(*auth.JWTClaims)
-	if oauthID == user.OAuthID && oauthProvider == user.OAuthProvider {
-		return true
-	}
-	return false
-}
@@ -5,13 +5,11 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/http"
-	"time"
+	"strings"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
-	"github.com/mxschmitt/golang-url-shortener/internal/util"
-	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -23,7 +21,7 @@ type Adapter interface {
 }
 
 type user struct {
-	ID, Name, Picture string
+	ID, Name, Picture, Email string
 }
 
 // JWTClaims are the data and general information which is stored in the JWT
@@ -33,15 +31,24 @@ type JWTClaims struct {
 	OAuthID       string
 	OAuthName     string
 	OAuthPicture  string
+	OAuthEmail    string
 }
 
+// SessionIssuer starts a server-side session for the user of the claims and
+// returns its short-lived access token and its refresh token
+type SessionIssuer func(claims JWTClaims) (token, refreshToken string, err error)
+
 // AdapterWrapper wraps an normal oAuth Adapter with some generic functions
 // to be implemented directly by the gin router
-type AdapterWrapper struct{ Adapter }
+type AdapterWrapper struct {
+	Adapter
+	issueSession SessionIssuer
+}
 
-// WithAdapterWrapper creates an adapterWrapper out of the oAuth Adapter and an gin.RouterGroup
-func WithAdapterWrapper(a Adapter, h *gin.RouterGroup) *AdapterWrapper {
-	aw := &AdapterWrapper{a}
+// WithAdapterWrapper creates an adapterWrapper out of the oAuth Adapter and an gin.RouterGroup,
+// the sessions of the users who logged in are started by the issuer
+func WithAdapterWrapper(a Adapter, h *gin.RouterGroup, issueSession SessionIssuer) *AdapterWrapper {
+	aw := &AdapterWrapper{a, issueSession}
 	h.GET("/login", aw.HandleLogin)
 	h.GET("/callback", aw.HandleCallback)
 	return aw
@@ -58,6 +65,7 @@ func (a *AdapterWrapper) HandleLogin(c *gin.Context) {
 	state := base64.RawURLEncoding.EncodeToString(b)
 	session := sessions.Default(c)
 	session.Set("state", state)
+	session.Set("returnTo", sanitizeReturnTo(c.Query("returnTo")))
 	if err := session.Save(); err != nil {
 		http.Error(c.Writer, fmt.Sprintf("could not save state to session: %v", err), http.StatusInternalServerError)
 		return
@@ -83,29 +91,41 @@ func (a *AdapterWrapper) HandleCallback(c *gin.Context) {
 		"Provider": a.GetOAuthProviderName(),
 		"Name":     user.Name,
 	}).Info("New user logged in via oAuth")
-	token, err := a.newJWT(user, a.GetOAuthProviderName())
+	token, refreshToken, err := a.issueSession(JWTClaims{
+		OAuthProvider: a.GetOAuthProviderName(),
+		OAuthID:       user.ID,
+		OAuthName:     user.Name,
+		OAuthPicture:  user.Picture,
+		OAuthEmail:    user.Email,
+	})
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	// remember the tokens in the session, so that access restricted
+	// entries can be resolved by the browser and the token can be renewed
+	session.Set("token", token)
+	session.Set("refreshToken", refreshToken)
+	returnTo, _ := session.Get("returnTo").(string)
+	session.Delete("returnTo")
+	if err := session.Save(); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("could not save token to session: %v", err)})
+		return
+	}
+	if returnTo != "" {
+		c.Redirect(http.StatusSeeOther, returnTo)
+		return
+	}
 	c.HTML(http.StatusOK, "token.html", gin.H{
 		"token": token,
 	})
 }
 
-func (a *AdapterWrapper) newJWT(user *user, provider string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, JWTClaims{
-		jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 24 * 365).Unix(),
-		},
-		provider,
-		user.ID,
-		user.Name,
-		user.Picture,
-	})
-	tokenString, err := token.SignedString(util.GetPrivateKey())
-	if err != nil {
-		return "", errors.Wrap(err, "could not sign token")
+// sanitizeReturnTo only allows local paths as the destination
+// after a login to prevent open redirects
+func sanitizeReturnTo(returnTo string) string {
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		return ""
 	}
-	return tokenString, nil
+	return returnTo
 }
@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"net/http"
 
 	"github.com/mxschmitt/golang-url-shortener/internal/util"
 	"github.com/sirupsen/logrus"
@@ -28,7 +29,7 @@ func NewGithubAdapter(clientID, clientSecret, endpointURL string) Adapter {
 		ClientSecret: clientSecret,
 		RedirectURL:  util.GetConfig().BaseURL + "/api/v1/auth/github/callback",
 		Scopes: []string{
-			"(no scope)",
+			"user:email",
 		},
 		Endpoint: github.Endpoint,
 	}}
@@ -49,7 +50,8 @@ func (a *githubAdapter) GetUserData(state, code string) (*user, error) {
 	if util.GetConfig().GitHub.EndpointURL != "" {
 		gitHubUserURL = util.GetConfig().GitHub.EndpointURL + "/api/v3/user"
 	}
-	oAuthUserInfoReq, err := a.config.Client(context.Background(), oAuthToken).Get(gitHubUserURL)
+	client := a.config.Client(context.Background(), oAuthToken)
+	oAuthUserInfoReq, err := client.Get(gitHubUserURL)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not get user data")
 	}
@@ -58,17 +60,53 @@ func (a *githubAdapter) GetUserData(state, code string) (*user, error) {
 		ID        int    `json:"id"`
 		AvatarURL string `json:"avatar_url"`
 		Name      string `json:"name"`
+		Email     string `json:"email"`
 	}
 	if err = json.NewDecoder(oAuthUserInfoReq.Body).Decode(&gUser); err != nil {
 		return nil, errors.Wrap(err, "decoding user info failed")
 	}
+	// the login works without an email, it only can't match the email
+	// based access policies then
+	email, err := getPrimaryEmail(client, gitHubUserURL+"/emails")
+	if err != nil {
+		logrus.Warnf("could not get the primary email of GitHub user %d: %v", gUser.ID, err)
+	}
 	return &user{
 		ID:      string(gUser.ID),
 		Name:    gUser.Name,
 		Picture: gUser.AvatarURL + "&s=64",
+		Email:   email,
 	}, nil
 }
 
+// getPrimaryEmail returns the primary email address of the GitHub user, if
+// it is verified. The public email of the profile is not used, since GitHub
+// does not require it to be verified.
+func getPrimaryEmail(client *http.Client, emailsURL string) (string, error) {
+	res, err := client.Get(emailsURL)
+	if err != nil {
+		return "", errors.Wrap(err, "could not get user emails")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Errorf("could not get user emails: unexpected status %d", res.StatusCode)
+	}
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&emails); err != nil {
+		return "", errors.Wrap(err, "decoding user emails failed")
+	}
+	for _, email := range emails {
+		if email.Primary && email.Verified {
+			return email.Email, nil
+		}
+	}
+	return "", nil
+}
+
 func (a *githubAdapter) GetOAuthProviderName() string {
 	return "github"
 }
@@ -43,17 +43,24 @@ func (a *googleAdapter) GetUserData(state, code string) (*user, error) {
 	}
 	defer oAuthUserInfoReq.Body.Close()
 	var gUser struct {
-		Sub     string `json:"sub"`
-		Name    string `json:"name"`
-		Picture string `json:"picture"`
+		Sub           string `json:"sub"`
+		Name          string `json:"name"`
+		Picture       string `json:"picture"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
 	}
 	if err = json.NewDecoder(oAuthUserInfoReq.Body).Decode(&gUser); err != nil {
 		return nil, errors.Wrap(err, "decoding user info failed")
 	}
+	// unverified emails must not match the email based access policies
+	if !gUser.EmailVerified {
+		gUser.Email = ""
+	}
 	return &user{
 		ID:      gUser.Sub,
 		Name:    gUser.Name,
 		Picture: gUser.Picture + "?sz=64",
+		Email:   gUser.Email,
 	}, nil
 }
 
@@ -26,6 +26,7 @@ func NewMicrosoftAdapter(clientID, clientSecret string) Adapter {
 		RedirectURL:  util.GetConfig().BaseURL + "/api/v1/auth/microsoft/callback",
 		Scopes: []string{
 			"wl.basic",
+			"wl.emails",
 		},
 		Endpoint: microsoft.LiveConnectEndpoint,
 	}}
@@ -53,6 +54,8 @@ func (a *microsoftAdapter) GetUserData(state, code string) (*user, error) {
 	if err = json.NewDecoder(oAuthUserInfoReq.Body).Decode(&mUser); err != nil {
 		return nil, errors.Wrap(err, "decoding user info failed")
 	}
+	// the preferred email is not verified by Microsoft, so it must not
+	// match the email based access policies and is not used at all
 	return &user{
 		ID:      mUser.ID,
 		Name:    mUser.Name,
@@ -31,6 +31,7 @@ func NewOktaAdapter(clientID, clientSecret, endpointURL string) Adapter {
                 Scopes: []string{
                         "profile",
                         "openid",
+                        "email",
                         "offline_access",
                 },
                 Endpoint: oauth2.Endpoint{
@@ -67,15 +68,22 @@ func (a *oktaAdapter) GetUserData(state, code string) (*user, error) {
         var oUser struct {
                 ID   int    `json:"sub"`
                 // Custom URL property for user Avatar can go here
-                Name string `json:"name"`
+                Name          string `json:"name"`
+                Email         string `json:"email"`
+                EmailVerified bool   `json:"email_verified"`
         }
         if err = json.NewDecoder(oAuthUserInfoReq.Body).Decode(&oUser); err != nil {
                 return nil, errors.Wrap(err, "decoding user info failed")
         }
+        // unverified emails must not match the email based access policies
+        if !oUser.EmailVerified {
+                oUser.Email = ""
+        }
         return &user{
                 ID:      string(oUser.ID),
                 Name:    oUser.Name,
                 Picture: util.GetConfig().BaseURL + "/images/okta_logo.png", // Default Okta Avatar
+                Email:   oUser.Email,
         }, nil
 }
 
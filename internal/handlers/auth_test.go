@@ -18,7 +18,7 @@ import (
 )
 
 var (
-	secret           []byte
+	testHandler      *Handler
 	server           *httptest.Server
 	closeServer      func() error
 	testingClaimData = auth.JWTClaims{
@@ -29,12 +29,12 @@ var (
 		"id",
 		"name",
 		"picture",
+		"mail@example.com",
 	}
 	tokenString string
 )
 
 func TestCreateBackend(t *testing.T) {
-	secret = util.GetPrivateKey()
 	if err := util.ReadInConfig(); err != nil {
 		t.Fatalf("could not reload config file: %v", err)
 	}
@@ -47,6 +47,7 @@ func TestCreateBackend(t *testing.T) {
 	if err != nil {
 		t.Fatalf("could not create handler: %v", err)
 	}
+	testHandler = handler
 	server = httptest.NewServer(handler.engine)
 	closeServer = func() error {
 		server.Close()
@@ -58,11 +59,10 @@ func TestCreateBackend(t *testing.T) {
 }
 
 func TestCreateNewJWT(t *testing.T) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, testingClaimData)
 	var err error
-	tokenString, err = token.SignedString(secret)
+	tokenString, _, err = testHandler.issueSession(testingClaimData)
 	if err != nil {
-		t.Fatalf("could not sign token: %v", err)
+		t.Fatalf("could not issue session: %v", err)
 	}
 }
 
@@ -132,6 +132,11 @@ func TestCheckToken(t *testing.T) {
 			currentValue:  data["Provider"].(string),
 			expectedValue: testingClaimData.OAuthProvider,
 		},
+		{
+			name:          "Email",
+			currentValue:  data["Email"].(string),
+			expectedValue: testingClaimData.OAuthEmail,
+		},
 	}
 	for _, tc := range tt {
 		t.Run(fmt.Sprintf("Checking: %s", tc.name), func(t *testing.T) {
@@ -147,3 +152,67 @@ func TestCloseBackend(t *testing.T) {
 		t.Fatalf("could not close server: %v", err)
 	}
 }
+
+func TestSessions(t *testing.T) {
+	TestCreateBackend(t)
+	defer TestCloseBackend(t)
+	claims := testingClaimData
+	claims.OAuthID = "sessions"
+	issue := func() (string, string) {
+		token, refreshToken, err := testHandler.issueSession(claims)
+		if err != nil {
+			t.Fatalf("could not issue session: %v", err)
+		}
+		return token, refreshToken
+	}
+	sign := func(claims auth.JWTClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(util.GetPrivateKey())
+		if err != nil {
+			t.Fatalf("could not sign token: %v", err)
+		}
+		return token
+	}
+	refresh := func(refreshToken string, statusCode int) (string, string) {
+		var tokens struct {
+			Token        string
+			RefreshToken string
+		}
+		var out interface{}
+		if statusCode == http.StatusOK {
+			out = &tokens
+		}
+		doJSONRequest(t, "", "POST", "/api/v1/auth/refresh", makeJSON(t, map[string]string{"RefreshToken": refreshToken}), statusCode, out)
+		return tokens.Token, tokens.RefreshToken
+	}
+	recent := func(token string, statusCode int) {
+		doJSONRequest(t, token, "GET", "/api/v1/protected/recent", "", statusCode, nil)
+	}
+
+	token, refreshToken := issue()
+	recent(token, http.StatusOK)
+	recent(sign(claims), http.StatusForbidden)
+	newToken, newRefreshToken := refresh(refreshToken, http.StatusOK)
+	recent(newToken, http.StatusOK)
+	refresh(refreshToken, http.StatusUnauthorized)
+
+	// an expired access token can't be used, but the session can be ended with its refresh token
+	expired := claims
+	parsed, err := testHandler.parseJWT(newToken)
+	if err != nil {
+		t.Fatalf("could not parse token: %v", err)
+	}
+	expired.Id = parsed.Id
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	recent(sign(expired), http.StatusForbidden)
+	doJSONRequest(t, "", "POST", "/api/v1/auth/logout", makeJSON(t, map[string]string{"RefreshToken": newRefreshToken}), http.StatusOK, nil)
+	recent(newToken, http.StatusForbidden)
+	refresh(newRefreshToken, http.StatusUnauthorized)
+
+	first, _ := issue()
+	second, secondRefreshToken := issue()
+	doJSONRequest(t, "", "POST", "/api/v1/auth/logout", "", http.StatusForbidden, nil)
+	doJSONRequest(t, first, "POST", "/api/v1/auth/logout/all", "", http.StatusOK, nil)
+	recent(first, http.StatusForbidden)
+	recent(second, http.StatusForbidden)
+	refresh(secondRefreshToken, http.StatusUnauthorized)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mxschmitt/golang-url-shortener/internal/handlers/auth"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/mxschmitt/golang-url-shortener/internal/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// role is the relation of a user to an entry
+type role int
+
+// Roles of a user, a user who owns an entry has this role even if the user
+// is an admin as well, while an admin keeps the admin role for the entries
+// which are shared with the admin
+const (
+	roleNone role = iota
+	roleSharedWith
+	roleOwner
+	roleAdmin
+)
+
+// permission is what a user wants to do with an entry
+type permission int
+
+// Permissions on entries
+const (
+	// permissionRead allows to see the details and the visitors of an entry
+	permissionRead permission = iota
+	// permissionManage allows to modify an entry
+	permissionManage
+)
+
+// can checks if the role grants the permission
+func (r role) can(p permission) bool {
+	switch p {
+	case permissionRead:
+		return r != roleNone
+	case permissionManage:
+		return r == roleOwner || r == roleAdmin
+	}
+	return false
+}
+
+// parseIdentities parses a comma separated list of 'provider/id' identities
+func parseIdentities(list string) map[string]bool {
+	identities := map[string]bool{}
+	for _, identity := range strings.Split(list, ",") {
+		if identity = strings.TrimSpace(identity); identity != "" {
+			identities[identity] = true
+		}
+	}
+	return identities
+}
+
+func newAdmins() map[string]bool {
+	return parseIdentities(util.GetConfig().Admin.Users)
+}
+
+// isAdmin checks if the user of the request is one of the configured admins
+// or, if the proxy auth backend is used, a member of the admin group
+func (h *Handler) isAdmin(c *gin.Context) bool {
+	user := c.MustGet("user").(*auth.JWTClaims)
+	if h.admins[shared.Identity(user.OAuthProvider, user.OAuthID)] {
+		return true
+	}
+	conf := util.GetConfig()
+	if conf.AuthBackend != "proxy" || conf.Admin.GroupHeader == "" || conf.Admin.Group == "" {
+		return false
+	}
+	for _, group := range strings.Split(c.GetHeader(conf.Admin.GroupHeader), ",") {
+		if strings.TrimSpace(group) == conf.Admin.Group {
+			return true
+		}
+	}
+	return false
+}
+
+// adminMiddleware aborts the requests of users who are no admins
+func (h *Handler) adminMiddleware(c *gin.Context) {
+	if !h.isAdmin(c) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return
+	}
+	c.Next()
+}
+
+// isTeamMember checks if the user is a member of the team
+func (h *Handler) isTeamMember(user *auth.JWTClaims, teamID string) bool {
+	team, err := h.store.GetTeam(teamID)
+	if err != nil {
+		if errors.Cause(err) != shared.ErrNoTeamFound {
+			logrus.Warningf("could not get team %s: %v", teamID, err)
+		}
+		return false
+	}
+	return team.HasMember(shared.Identity(user.OAuthProvider, user.OAuthID))
+}
+
+// roleOf returns the role of the user of the request for the entry, every
+// member of the team which owns an entry is an owner of it, but not its
+// creator anymore once the creator left the team
+func (h *Handler) roleOf(c *gin.Context, entry *shared.Entry) role {
+	user := c.MustGet("user").(*auth.JWTClaims)
+	switch {
+	case entry.TeamID != "" && h.isTeamMember(user, entry.TeamID):
+		return roleOwner
+	case entry.TeamID == "" && entry.OAuthProvider == user.OAuthProvider && entry.OAuthID == user.OAuthID:
+		return roleOwner
+	case h.isAdmin(c):
+		return roleAdmin
+	case entry.IsSharedWith(user.OAuthProvider, user.OAuthID):
+		return roleSharedWith
+	}
+	return roleNone
+}
+
+// authorizeEntry fetches the entry and checks if the user of the request has
+// the permission on it. If not, the error response is already sent.
+func (h *Handler) authorizeEntry(c *gin.Context, id string, p permission) (*shared.Entry, bool) {
+	entry, err := h.store.GetEntryByID(id)
+	if errors.Cause(err) == shared.ErrNoEntryFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": shared.ErrNoEntryFound.Error()})
+		return nil, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if !h.roleOf(c, entry).can(p) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return nil, false
+	}
+	return entry, true
+}
+
+// authorizeTeam fetches the team and checks if the user of the request is
+// a member of it or an admin. If not, the error response is already sent.
+func (h *Handler) authorizeTeam(c *gin.Context, id string) (*shared.Team, bool) {
+	team, err := h.store.GetTeam(id)
+	if errors.Cause(err) == shared.ErrNoTeamFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": shared.ErrNoTeamFound.Error()})
+		return nil, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	user := c.MustGet("user").(*auth.JWTClaims)
+	if !team.HasMember(shared.Identity(user.OAuthProvider, user.OAuthID)) && !h.isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return nil, false
+	}
+	return team, true
+}
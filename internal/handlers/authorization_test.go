@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mxschmitt/golang-url-shortener/internal/handlers/auth"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/mxschmitt/golang-url-shortener/internal/util"
+)
+
+func TestRoleOf(t *testing.T) {
+	config := util.GetConfig()
+	defer util.SetConfig(config)
+	proxyConfig := config
+	proxyConfig.AuthBackend = "proxy"
+	proxyConfig.Admin.GroupHeader = "X-Groups"
+	proxyConfig.Admin.Group = "operators"
+	util.SetConfig(proxyConfig)
+	h := &Handler{admins: parseIdentities("google/admin, github/root")}
+	entry := &shared.Entry{
+		OAuthProvider: "google",
+		OAuthID:       "owner",
+		SharedWith:    []string{"github/friend", "google/admin"},
+	}
+	tt := []struct {
+		name     string
+		provider string
+		id       string
+		groups   string
+		role     role
+		read     bool
+		manage   bool
+	}{
+		{name: "owner", provider: "google", id: "owner", role: roleOwner, read: true, manage: true},
+		{name: "shared with", provider: "github", id: "friend", role: roleSharedWith, read: true},
+		{name: "admin", provider: "github", id: "root", role: roleAdmin, read: true, manage: true},
+		{name: "admin with whom it is shared", provider: "google", id: "admin", role: roleAdmin, read: true, manage: true},
+		{name: "admin group", provider: "proxy", id: "jane", groups: "staff, operators", role: roleAdmin, read: true, manage: true},
+		{name: "other group", provider: "proxy", id: "jane", groups: "staff", role: roleNone},
+		{name: "same id of another provider", provider: "github", id: "owner", role: roleNone},
+		{name: "stranger", provider: "google", id: "stranger", role: roleNone},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/", nil)
+			c.Request.Header.Set("X-Groups", tc.groups)
+			c.Set("user", &auth.JWTClaims{OAuthProvider: tc.provider, OAuthID: tc.id})
+			r := h.roleOf(c, entry)
+			if r != tc.role {
+				t.Fatalf("expected role: %d; got: %d", tc.role, r)
+			}
+			if r.can(permissionRead) != tc.read {
+				t.Errorf("expected read permission: %t", tc.read)
+			}
+			if r.can(permissionManage) != tc.manage {
+				t.Errorf("expected manage permission: %t", tc.manage)
+			}
+		})
+	}
+}
+
+func TestCrossUserAccess(t *testing.T) {
+	TestCreateBackend(t)
+	defer TestCloseBackend(t)
+	TestCreateNewJWT(t)
+	respBody := createEntryWithJSON(t, []byte(makeJSON(t, requestHelper{
+		URL:        testURL,
+		SharedWith: []string{"google/friend"},
+	})), "application/json; charset=utf-8", http.StatusOK)
+	var body requestHelper
+	if err := json.Unmarshal(respBody, &body); err != nil {
+		t.Fatal("could not unmarshal create response")
+	}
+	stranger := signTestToken(t, "stranger")
+	friend := signTestToken(t, "friend")
+	idBody := makeJSON(t, map[string]string{"ID": body.ID})
+	tt := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{name: "visitors", method: "POST", path: "/api/v1/protected/visitors", body: idBody},
+		{name: "stats", method: "POST", path: "/api/v1/protected/stats", body: idBody},
+		{name: "export", method: "GET", path: "/api/v1/protected/export/" + body.ID},
+		{name: "live", method: "GET", path: "/api/v1/protected/live?id=" + body.ID},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, user := range []struct {
+				token      string
+				statusCode int
+			}{
+				{token: tokenString, statusCode: http.StatusOK},
+				{token: friend, statusCode: http.StatusOK},
+				{token: stranger, statusCode: http.StatusForbidden},
+			} {
+				if status := doAuthorizedRequest(t, user.token, tc.method, tc.path, tc.body); status != user.statusCode {
+					t.Errorf("expected status: %d; got: %d", user.statusCode, status)
+				}
+			}
+		})
+	}
+	t.Run("lookup", func(t *testing.T) {
+		for _, user := range []struct {
+			token    string
+			complete bool
+		}{
+			{token: tokenString, complete: true},
+			{token: friend, complete: true},
+			{token: stranger, complete: false},
+		} {
+			req, err := http.NewRequest("POST", server.URL+"/api/v1/protected/lookup", bytes.NewBufferString(idBody))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", user.token)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("could not do request: %v", err)
+			}
+			var entry shared.EntryPublicData
+			err = json.NewDecoder(resp.Body).Decode(&entry)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatalf("could not decode lookup response: %v", err)
+			}
+			if entry.CreatedOn.IsZero() == user.complete {
+				t.Errorf("expected complete details: %t; got: %+v", user.complete, entry)
+			}
+		}
+	})
+	t.Run("lookup of restricted links", func(t *testing.T) {
+		for _, data := range []requestHelper{
+			{URL: testURL, Password: "secret"},
+			{URL: testURL, AllowedCIDRs: []string{"192.0.2.0/24"}},
+		} {
+			respBody := createEntryWithJSON(t, []byte(makeJSON(t, data)), "application/json; charset=utf-8", http.StatusOK)
+			var created requestHelper
+			if err := json.Unmarshal(respBody, &created); err != nil {
+				t.Fatal("could not unmarshal create response")
+			}
+			body := makeJSON(t, map[string]string{"ID": created.ID})
+			if status := doAuthorizedRequest(t, stranger, "POST", "/api/v1/protected/lookup", body); status != http.StatusForbidden {
+				t.Errorf("expected status: %d; got: %d", http.StatusForbidden, status)
+			}
+			if status := doAuthorizedRequest(t, tokenString, "POST", "/api/v1/protected/lookup", body); status != http.StatusOK {
+				t.Errorf("expected status: %d; got: %d", http.StatusOK, status)
+			}
+		}
+	})
+	t.Run("export of all readable entries", func(t *testing.T) {
+		testRedirect(t, body.URL, testURL)
+		export := func(token string) string {
+			req, err := http.NewRequest("GET", server.URL+"/api/v1/protected/export?format=ndjson", nil)
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+			req.Header.Set("Authorization", token)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("could not do request: %v", err)
+			}
+			defer resp.Body.Close()
+			raw, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("could not read body: %v", err)
+			}
+			return string(raw)
+		}
+		// the visit is registered in the background
+		var raw string
+		for i := 0; i < 50 && !strings.Contains(raw, body.ID); i++ {
+			time.Sleep(20 * time.Millisecond)
+			raw = export(friend)
+		}
+		if !strings.Contains(raw, `"ID":"`+body.ID+`"`) {
+			t.Errorf("export of the friend does not contain the shared entry: %s", raw)
+		}
+		if raw := export(stranger); raw != "" {
+			t.Errorf("export of the stranger is not empty: %s", raw)
+		}
+	})
+}
+
+// signTestToken starts a session of another user of the same provider and
+// returns its token
+func signTestToken(t *testing.T, oAuthID string) string {
+	claims := testingClaimData
+	claims.OAuthID = oAuthID
+	token, _, err := testHandler.issueSession(claims)
+	if err != nil {
+		t.Fatalf("could not issue session: %v", err)
+	}
+	return token
+}
+
+// doAuthorizedRequest sends the request and returns the status code, the
+// body is not read so that streams can be checked as well
+func doAuthorizedRequest(t *testing.T, token, method, path, body string) int {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("could not create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", token)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("could not do request: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestTeamAccess(t *testing.T) {
+	TestCreateBackend(t)
+	defer TestCloseBackend(t)
+	TestCreateNewJWT(t)
+	member := signTestToken(t, "member")
+	stranger := signTestToken(t, "stranger")
+	var team shared.Team
+	doJSONRequest(t, tokenString, "POST", "/api/v1/protected/teams", makeJSON(t, map[string]string{"Name": "Marketing"}), http.StatusOK, &team)
+	doJSONRequest(t, stranger, "POST", "/api/v1/protected/teams/"+team.ID+"/members", makeJSON(t, map[string]string{"Identity": "google/stranger"}), http.StatusForbidden, nil)
+	doJSONRequest(t, tokenString, "POST", "/api/v1/protected/teams/"+team.ID+"/members", makeJSON(t, map[string]string{"Identity": "google/member"}), http.StatusOK, &team)
+	if len(team.Members) != 2 {
+		t.Fatalf("members are not the expected ones: %v", team.Members)
+	}
+	doJSONRequest(t, stranger, "POST", "/api/v1/protected/create", makeJSON(t, requestHelper{URL: testURL, TeamID: team.ID}), http.StatusForbidden, nil)
+	var created requestHelper
+	doJSONRequest(t, member, "POST", "/api/v1/protected/create", makeJSON(t, requestHelper{URL: testURL, TeamID: team.ID}), http.StatusOK, &created)
+	var entries map[string]shared.Entry
+	doJSONRequest(t, tokenString, "GET", "/api/v1/protected/recent?team="+team.ID, "", http.StatusOK, &entries)
+	if _, ok := entries[created.ID]; !ok {
+		t.Fatalf("team entry is not in the recent entries of the team: %v", entries)
+	}
+	doJSONRequest(t, stranger, "GET", "/api/v1/protected/recent?team="+team.ID, "", http.StatusForbidden, nil)
+	stats := makeJSON(t, map[string]string{"ID": created.ID})
+	doJSONRequest(t, tokenString, "POST", "/api/v1/protected/stats", stats, http.StatusOK, nil)
+	doJSONRequest(t, stranger, "POST", "/api/v1/protected/stats", stats, http.StatusForbidden, nil)
+	// the creator loses the access once the creator left the team
+	doJSONRequest(t, member, "DELETE", "/api/v1/protected/teams/"+team.ID+"/members/google/member", "", http.StatusOK, nil)
+	doJSONRequest(t, member, "POST", "/api/v1/protected/stats", stats, http.StatusForbidden, nil)
+	doJSONRequest(t, tokenString, "DELETE", "/api/v1/protected/teams/"+team.ID+"/members/google/id", "", http.StatusBadRequest, nil)
+}
+
+// doJSONRequest sends the request, checks the status code and decodes the
+// response into out if it is given
+func doJSONRequest(t *testing.T, token, method, path, body string, statusCode int, out interface{}) {
+	req, err := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("could not create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("could not do request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != statusCode {
+		t.Fatalf("%s %s: expected status: %d; got: %d", method, path, statusCode, resp.StatusCode)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+	}
+}
+
+func TestTransferAccess(t *testing.T) {
+	TestCreateBackend(t)
+	defer TestCloseBackend(t)
+	TestCreateNewJWT(t)
+	newOwner := signTestToken(t, "new")
+	stranger := signTestToken(t, "stranger")
+	var created requestHelper
+	doJSONRequest(t, tokenString, "POST", "/api/v1/protected/create", makeJSON(t, requestHelper{URL: testURL}), http.StatusOK, &created)
+	transfer := func(token, to string, statusCode int) {
+		doJSONRequest(t, token, "POST", "/api/v1/protected/transfer", makeJSON(t, map[string]string{"ID": created.ID, "To": to}), statusCode, nil)
+	}
+	transfer(stranger, "google/stranger", http.StatusForbidden)
+	transfer(tokenString, "stranger", http.StatusBadRequest)
+	transfer(tokenString, "google/id", http.StatusBadRequest)
+	var team shared.Team
+	doJSONRequest(t, stranger, "POST", "/api/v1/protected/teams", makeJSON(t, map[string]string{"Name": "Strangers"}), http.StatusOK, &team)
+	transfer(tokenString, shared.TeamEntriesPrefix+team.ID, http.StatusForbidden)
+	transfer(tokenString, "google/new", http.StatusOK)
+
+	var entries map[string]shared.Entry
+	doJSONRequest(t, newOwner, "GET", "/api/v1/protected/recent", "", http.StatusOK, &entries)
+	if _, ok := entries[created.ID]; !ok {
+		t.Fatalf("transferred entry is not in the entries of the new owner: %v", entries)
+	}
+	entries = nil
+	doJSONRequest(t, tokenString, "GET", "/api/v1/protected/recent", "", http.StatusOK, &entries)
+	if _, ok := entries[created.ID]; ok {
+		t.Fatalf("transferred entry is still in the entries of the previous owner: %v", entries)
+	}
+	stats := makeJSON(t, map[string]string{"ID": created.ID})
+	doJSONRequest(t, newOwner, "POST", "/api/v1/protected/stats", stats, http.StatusOK, nil)
+	doJSONRequest(t, tokenString, "POST", "/api/v1/protected/stats", stats, http.StatusForbidden, nil)
+}
+
+func TestAPITokenAccess(t *testing.T) {
+	TestCreateBackend(t)
+	defer TestCloseBackend(t)
+	TestCreateNewJWT(t)
+	tokens := map[string]string{}
+	ids := map[string]string{}
+	for _, scope := range []string{shared.TokenScopeFull, shared.TokenScopeRead, shared.TokenScopeCreate} {
+		var created struct {
+			ID    string
+			Token string
+			Hash  string
+		}
+		doJSONRequest(t, tokenString, "POST", "/api/v1/protected/tokens", makeJSON(t, map[string]string{"Name": scope, "Scope": scope}), http.StatusOK, &created)
+		if created.Token == "" || created.Hash != "" {
+			t.Fatalf("created API token is not the expected one: %+v", created)
+		}
+		tokens[scope], ids[created.ID] = created.Token, scope
+	}
+	doJSONRequest(t, tokenString, "POST", "/api/v1/protected/tokens", makeJSON(t, map[string]string{"Name": "CI", "Scope": "admin"}), http.StatusBadRequest, nil)
+	create := makeJSON(t, requestHelper{URL: testURL})
+	tt := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status map[string]int
+	}{
+		{name: "create", method: "POST", path: "/api/v1/protected/create", body: create, status: map[string]int{
+			shared.TokenScopeFull: http.StatusOK, shared.TokenScopeRead: http.StatusForbidden, shared.TokenScopeCreate: http.StatusOK,
+		}},
+		{name: "recent", method: "GET", path: "/api/v1/protected/recent", status: map[string]int{
+			shared.TokenScopeFull: http.StatusOK, shared.TokenScopeRead: http.StatusOK, shared.TokenScopeCreate: http.StatusForbidden,
+		}},
+		{name: "create token", method: "POST", path: "/api/v1/protected/tokens", body: makeJSON(t, map[string]string{"Name": "nested"}), status: map[string]int{
+			shared.TokenScopeFull: http.StatusOK, shared.TokenScopeRead: http.StatusForbidden, shared.TokenScopeCreate: http.StatusForbidden,
+		}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			for scope, statusCode := range tc.status {
+				if status := doAuthorizedRequest(t, "Bearer "+tokens[scope], tc.method, tc.path, tc.body); status != statusCode {
+					t.Errorf("%s scope: expected status: %d; got: %d", scope, statusCode, status)
+				}
+			}
+		})
+	}
+	var listed []struct {
+		ID       string
+		Name     string
+		Hash     string
+		LastUsed *time.Time
+	}
+	doJSONRequest(t, tokenString, "GET", "/api/v1/protected/tokens", "", http.StatusOK, &listed)
+	found := 0
+	for _, token := range listed {
+		if token.Hash != "" {
+			t.Errorf("API token contains its hash: %+v", token)
+		}
+		scope, ok := ids[token.ID]
+		if !ok {
+			continue
+		}
+		found++
+		if scope == shared.TokenScopeRead {
+			if token.LastUsed == nil {
+				t.Errorf("last usage of the API token was not saved: %+v", token)
+			}
+			doJSONRequest(t, signTestToken(t, "stranger"), "DELETE", "/api/v1/protected/tokens/"+token.ID, "", http.StatusNotFound, nil)
+			doJSONRequest(t, tokenString, "DELETE", "/api/v1/protected/tokens/"+token.ID, "", http.StatusOK, nil)
+		}
+	}
+	if found != len(ids) {
+		t.Fatalf("API tokens are not the expected ones: %+v", listed)
+	}
+	if status := doAuthorizedRequest(t, tokens[shared.TokenScopeRead], "GET", "/api/v1/protected/recent", ""); status != http.StatusForbidden {
+		t.Fatalf("revoked API token was accepted: %d", status)
+	}
+}
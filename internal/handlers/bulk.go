@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mxschmitt/golang-url-shortener/internal/handlers/auth"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+)
+
+// Modes of a bulk creation
+const (
+	bulkModeAtomic     = "atomic"
+	bulkModeBestEffort = "best-effort"
+)
+
+// bulkResult is the result of an entry of a bulk creation, it contains
+// either the URLs of the created entry or the error
+type bulkResult struct {
+	ID          string `json:",omitempty"`
+	URL         string `json:",omitempty"`
+	DeletionURL string `json:",omitempty"`
+	Error       string `json:",omitempty"`
+}
+
+// handleCreateBulk handles requests to create many entries at once. In the
+// atomic mode either all entries are created or none, in the best-effort
+// mode every valid entry is created. The results are in the order of the
+// given entries.
+func (h *Handler) handleCreateBulk(c *gin.Context) {
+	var data struct {
+		Mode    string
+		Entries []struct {
+			URL, ID, Password string
+			Expiration        *time.Time
+		}
+	}
+	if err := c.ShouldBind(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	atomic := true
+	switch data.Mode {
+	case "", bulkModeAtomic:
+	case bulkModeBestEffort:
+		atomic = false
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("the mode has to be '%s' or '%s'", bulkModeAtomic, bulkModeBestEffort)})
+		return
+	}
+	user := c.MustGet("user").(*auth.JWTClaims)
+	entries := make([]stores.BulkEntry, len(data.Entries))
+	for i, entry := range data.Entries {
+		entries[i] = stores.BulkEntry{
+			Entry: shared.Entry{
+				Public: shared.EntryPublicData{
+					URL:        entry.URL,
+					Expiration: entry.Expiration,
+				},
+				RemoteAddr:    c.ClientIP(),
+				OAuthProvider: user.OAuthProvider,
+				OAuthID:       user.OAuthID,
+			},
+			ID:       entry.ID,
+			Password: entry.Password,
+		}
+	}
+	results, err := h.store.CreateEntries(entries, atomic)
+	switch err {
+	case nil:
+	case stores.ErrNoEntries, stores.ErrTooManyEntries:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	originURL := h.getURLOrigin(c)
+	response := make([]bulkResult, len(results))
+	failed := false
+	for i, result := range results {
+		if result.Err != nil {
+			response[i].Error = result.Err.Error()
+			failed = true
+			continue
+		}
+		response[i] = bulkResult{
+			ID:          result.ID,
+			URL:         fmt.Sprintf("%s/%s", originURL, result.ID),
+			DeletionURL: fmt.Sprintf("%s/d/%s/%s", originURL, result.ID, url.QueryEscape(base64.RawURLEncoding.EncodeToString(result.DeletionHMAC))),
+		}
+	}
+	status := http.StatusOK
+	if atomic && failed {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"Results": response})
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mxschmitt/golang-url-shortener/internal/util"
+	"github.com/pkg/errors"
+)
+
+// clientIPResolver determines the IP address of a client. The configured
+// header is only taken into account if the request was sent by one of the
+// trusted proxies.
+type clientIPResolver struct {
+	trustedProxies []*net.IPNet
+	header         string
+}
+
+func newClientIPResolver() (*clientIPResolver, error) {
+	conf := util.GetConfig().ClientIP
+	r := &clientIPResolver{}
+	if conf.TrustNone {
+		return r, nil
+	}
+	switch header := http.CanonicalHeaderKey(conf.Header); header {
+	case "", "X-Forwarded-For", "X-Real-Ip", "Forwarded", "Cf-Connecting-Ip":
+		r.header = header
+	default:
+		return nil, errors.Errorf("client IP header '%s' is not supported", conf.Header)
+	}
+	for _, cidr := range strings.Split(conf.TrustedProxies, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse trusted proxy '%s'", cidr)
+		}
+		r.trustedProxies = append(r.trustedProxies, network)
+	}
+	return r, nil
+}
+
+func (r *clientIPResolver) isTrusted(ip net.IP) bool {
+	for _, network := range r.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve returns the IP address of the client. Forwarding chains are
+// walked from the right, so that entries which were added by the client
+// itself are never trusted.
+func (r *clientIPResolver) resolve(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || r.header == "" || !r.isTrusted(ip) {
+		return ip
+	}
+	var hops []string
+	switch r.header {
+	case "X-Forwarded-For":
+		for _, value := range req.Header[r.header] {
+			hops = append(hops, strings.Split(value, ",")...)
+		}
+	case "Forwarded":
+		for _, value := range req.Header[r.header] {
+			hops = append(hops, parseForwarded(value)...)
+		}
+	default:
+		hops = []string{req.Header.Get(r.header)}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !r.isTrusted(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// parseForwarded returns the addresses of the "for" parameters
+// of a Forwarded header (RFC 7239) without ports
+func parseForwarded(value string) []string {
+	var hops []string
+	for _, element := range strings.Split(value, ",") {
+		for _, pair := range strings.Split(element, ";") {
+			pair = strings.TrimSpace(pair)
+			if len(pair) < 4 || !strings.EqualFold(pair[:4], "for=") {
+				continue
+			}
+			node := strings.Trim(pair[4:], "\"")
+			if strings.HasPrefix(node, "[") {
+				if end := strings.Index(node, "]"); end != -1 {
+					node = node[1:end]
+				}
+			} else if host, _, err := net.SplitHostPort(node); err == nil {
+				node = host
+			}
+			hops = append(hops, node)
+		}
+	}
+	return hops
+}
+
+// middleware replaces the remote address of the request with the resolved
+// client IP, so that c.ClientIP() returns it consistently across the engine
+func (r *clientIPResolver) middleware(c *gin.Context) {
+	if ip := r.resolve(c.Request); ip != nil {
+		_, port, err := net.SplitHostPort(c.Request.RemoteAddr)
+		if err != nil {
+			port = "0"
+		}
+		c.Request.RemoteAddr = net.JoinHostPort(ip.String(), port)
+	}
+	c.Next()
+}
+
+// clientIP returns the IP address of the client which sent the request.
+// The remote address was already replaced by the client IP middleware,
+// so headers like X-Forwarded-For are only honoured from trusted proxies.
+func clientIP(c *gin.Context) net.IP {
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		host = c.Request.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	_, trusted, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("could not parse CIDR: %v", err)
+	}
+	tt := []struct {
+		name       string
+		header     string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{
+			name:       "untrusted peer",
+			header:     "X-Forwarded-For",
+			remoteAddr: "203.0.113.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "192.0.2.1"},
+			expected:   "203.0.113.1",
+		},
+		{
+			name:       "trusted peer",
+			header:     "X-Forwarded-For",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "192.0.2.1"},
+			expected:   "192.0.2.1",
+		},
+		{
+			name:       "chain of trusted proxies",
+			header:     "X-Forwarded-For",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1, 192.0.2.1, 10.0.0.2"},
+			expected:   "192.0.2.1",
+		},
+		{
+			name:       "trusted peer without header",
+			header:     "X-Forwarded-For",
+			remoteAddr: "10.0.0.1:1234",
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "other header than the configured one",
+			header:     "X-Real-Ip",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "192.0.2.1"},
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "X-Real-IP",
+			header:     "X-Real-Ip",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Real-IP": "192.0.2.1"},
+			expected:   "192.0.2.1",
+		},
+		{
+			name:       "CF-Connecting-IP",
+			header:     "Cf-Connecting-Ip",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"CF-Connecting-IP": "2001:db8::1"},
+			expected:   "2001:db8::1",
+		},
+		{
+			name:       "Forwarded",
+			header:     "Forwarded",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"Forwarded": `for=198.51.100.1, for="[2001:db8::1]:4711";proto=https`},
+			expected:   "2001:db8::1",
+		},
+		{
+			name:       "trust nothing",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "192.0.2.1"},
+			expected:   "10.0.0.1",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &clientIPResolver{
+				header: tc.header,
+			}
+			if tc.header != "" {
+				r.trustedProxies = []*net.IPNet{trusted}
+			}
+			req := &http.Request{
+				RemoteAddr: tc.remoteAddr,
+				Header:     http.Header{},
+			}
+			for key, value := range tc.headers {
+				req.Header.Set(key, value)
+			}
+			if ip := r.resolve(req); ip.String() != tc.expected {
+				t.Fatalf("expected client IP: %s; got: %s", tc.expected, ip)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mxschmitt/golang-url-shortener/internal/handlers/auth"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Formats of the visitor exports
+const (
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+)
+
+// exportFlushInterval is the number of records after which
+// the export is flushed to the client
+const exportFlushInterval = 500
+
+var exportCSVHeader = []string{
+	"ID", "Timestamp", "IP", "Referer", "UserAgent", "Country", "Browser", "OS", "DeviceType",
+	"UTMSource", "UTMMedium", "UTMCampaign", "UTMContent", "UTMTerm",
+}
+
+// exportRecord is a visitor together with the ID of its entry
+type exportRecord struct {
+	ID string
+	shared.Visitor
+}
+
+// exportQuery are the query parameters of the export endpoints
+type exportQuery struct {
+	Format string    `form:"format"`
+	From   time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To     time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// visitorExporter writes the visitors in one of the export formats
+type visitorExporter struct {
+	w       gin.ResponseWriter
+	csv     *csv.Writer
+	json    *json.Encoder
+	written int
+}
+
+func newVisitorExporter(c *gin.Context, format, name string) (*visitorExporter, error) {
+	e := &visitorExporter{w: c.Writer}
+	switch format {
+	case "", exportFormatCSV:
+		format = exportFormatCSV
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		e.csv = csv.NewWriter(c.Writer)
+	case exportFormatNDJSON:
+		c.Header("Content-Type", "application/x-ndjson")
+		e.json = json.NewEncoder(c.Writer)
+	default:
+		return nil, errors.New("the given format is not valid, it has to be csv or ndjson")
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+format))
+	c.Status(http.StatusOK)
+	if e.csv != nil {
+		if err := e.csv.Write(exportCSVHeader); err != nil {
+			return nil, errors.Wrap(err, "could not write csv header")
+		}
+	}
+	return e, nil
+}
+
+func (e *visitorExporter) write(id string, v shared.Visitor) error {
+	if e.csv != nil {
+		err := e.csv.Write([]string{
+			id, v.Timestamp.Format(time.RFC3339), v.IP, v.Referer, v.UserAgent, v.Country, v.Browser, v.OS, v.DeviceType,
+			v.UTMSource, v.UTMMedium, v.UTMCampaign, v.UTMContent, v.UTMTerm,
+		})
+		if err != nil {
+			return errors.Wrap(err, "could not write csv record")
+		}
+	} else if err := e.json.Encode(exportRecord{ID: id, Visitor: v}); err != nil {
+		return errors.Wrap(err, "could not write json record")
+	}
+	if e.written++; e.written%exportFlushInterval == 0 {
+		e.flush()
+	}
+	return nil
+}
+
+func (e *visitorExporter) flush() {
+	if e.csv != nil {
+		e.csv.Flush()
+	}
+	e.w.Flush()
+}
+
+// handleExport streams the visitors of one entry
+func (h *Handler) handleExport(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := h.authorizeEntry(c, id, permissionRead); !ok {
+		return
+	}
+	h.exportVisitors(c, "visitors-"+id, []string{id})
+}
+
+// handleExportAll streams the visitors of all entries which the user can
+// read, these are the own ones, the ones of the teams of the user and the
+// ones which are shared with the user
+func (h *Handler) handleExportAll(c *gin.Context) {
+	user := c.MustGet("user").(*auth.JWTClaims)
+	ids, err := h.readableEntryIDs(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.exportVisitors(c, "visitors", ids)
+}
+
+// readableEntryIDs returns the sorted IDs of the entries which the user owns
+// by itself or through a team, or which are shared with the user
+func (h *Handler) readableEntryIDs(user *auth.JWTClaims) ([]string, error) {
+	entries, err := h.store.GetUserEntries(user.OAuthProvider, user.OAuthID)
+	if err != nil {
+		return nil, err
+	}
+	included := map[string]bool{}
+	for id := range entries {
+		included[id] = true
+	}
+	teams, err := h.store.GetUserTeams(user.OAuthProvider, user.OAuthID)
+	if err != nil {
+		return nil, err
+	}
+	for _, team := range teams {
+		entries, err := h.store.GetTeamEntries(team.ID)
+		if err != nil {
+			return nil, err
+		}
+		for id := range entries {
+			included[id] = true
+		}
+	}
+	entries, err = h.store.GetSharedEntries(user.OAuthProvider, user.OAuthID)
+	if err != nil {
+		return nil, err
+	}
+	for id := range entries {
+		included[id] = true
+	}
+	ids := make([]string, 0, len(included))
+	for id := range included {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// exportVisitors streams the visitors of the given entries in the requested
+// format, the visitors are never loaded into memory at once and the entries
+// which were not visited in the requested time range are skipped
+func (h *Handler) exportVisitors(c *gin.Context, name string, ids []string) {
+	var query exportQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	exporter, err := newVisitorExporter(c, query.Format, name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer exporter.flush()
+	for _, id := range ids {
+		err := h.store.IterateVisitors(id, query.From, query.To, func(visitor shared.Visitor) error {
+			return exporter.write(id, visitor)
+		})
+		if err != nil {
+			// the status is already sent, so the export can only be cut off
+			logrus.Errorf("could not export visitors of %s: %v", id, err)
+			return
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gobuffalo/packr/v2"
+	"github.com/mxschmitt/golang-url-shortener/internal/metrics"
 	"github.com/mxschmitt/golang-url-shortener/internal/stores"
 	"github.com/mxschmitt/golang-url-shortener/internal/util"
 	"github.com/pkg/errors"
@@ -19,9 +20,12 @@ import (
 // Handler holds the funcs and attributes for the
 // http communication
 type Handler struct {
-	store     stores.Store
-	engine    *gin.Engine
-	providers []string
+	store               stores.Store
+	engine              *gin.Engine
+	providers           []string
+	unlockLifetime      time.Duration
+	accessTokenLifetime time.Duration
+	admins              map[string]bool
 }
 
 // DoNotPrivateKeyChecking is used for testing
@@ -92,8 +96,22 @@ func New(store stores.Store) (*Handler, error) {
 		gin.SetMode(gin.ReleaseMode)
 	}
 	h := &Handler{
-		store:  store,
-		engine: gin.New(),
+		store:               store,
+		engine:              gin.New(),
+		admins:              newAdmins(),
+		accessTokenLifetime: defaultAccessTokenLifetime,
+	}
+	if lifetime := util.GetConfig().PasswordProtection.RememberDuration; lifetime != "" {
+		var err error
+		if h.unlockLifetime, err = time.ParseDuration(lifetime); err != nil {
+			return nil, errors.Wrap(err, "could not parse remember duration")
+		}
+	}
+	if lifetime := util.GetConfig().Sessions.AccessTokenLifetime; lifetime != "" {
+		var err error
+		if h.accessTokenLifetime, err = time.ParseDuration(lifetime); err != nil {
+			return nil, errors.Wrap(err, "could not parse access token lifetime")
+		}
 	}
 	if err := h.setHandlers(); err != nil {
 		return nil, errors.Wrap(err, "could not set handlers")
@@ -134,39 +152,85 @@ func (h *Handler) addTemplatesFromFS(files []string) error {
 }
 
 func (h *Handler) setHandlers() error {
-	if err := h.addTemplatesFromFS([]string{"token.html", "protected.html"}); err != nil {
+	if err := h.addTemplatesFromFS([]string{"token.html", "protected.html", "error.html", "login.html"}); err != nil {
 		return errors.Wrap(err, "could not add templates from FS")
 	}
+	// resolve the client IP before anything else, the headers of
+	// the request are only trusted if it comes from a trusted proxy
+	resolver, err := newClientIPResolver()
+	if err != nil {
+		return errors.Wrap(err, "could not create client IP resolver")
+	}
+	h.engine.ForwardedByClientIP = false
+	h.engine.Use(resolver.middleware)
+	if util.GetConfig().Metrics.Enabled {
+		h.engine.Use(metrics.Middleware())
+	}
 	// only do web access logs if enabled
 	if util.GetConfig().EnableAccessLogs {
 		if util.GetConfig().EnableDebugMode {
 			// in debug mode, log everything including healthchecks
 			h.engine.Use(Ginrus(logrus.StandardLogger(), time.RFC3339, false))
 		} else {
-			// if we are not in debug mode, do not log healthchecks
-			h.engine.Use(Ginrus(logrus.StandardLogger(), time.RFC3339, false, "/ok"))
+			// if we are not in debug mode, do not log healthchecks and scrapes
+			h.engine.Use(Ginrus(logrus.StandardLogger(), time.RFC3339, false, "/ok", "/metrics"))
 		}
 	}
-	protected := h.engine.Group("/api/v1/protected")
+	var authMiddleware gin.HandlerFunc
 	switch util.GetConfig().AuthBackend {
 	case "oauth":
 		logrus.Info("Using OAuth auth backend: oauth")
-		protected.Use(h.oAuthMiddleware)
+		authMiddleware = h.oAuthMiddleware
 	case "proxy":
 		logrus.Info("Using OAuth auth backend: proxy")
-		protected.Use(h.proxyAuthMiddleware)
+		authMiddleware = h.proxyAuthMiddleware
 	default:
 		logrus.Fatalf("Auth backend method '%s' is not recognized", util.GetConfig().AuthBackend)
 	}
+	protected := h.engine.Group("/api/v1/protected")
+	protected.Use(authMiddleware)
 	protected.POST("/create", h.handleCreate)
+	protected.POST("/create/bulk", h.handleCreateBulk)
 	protected.POST("/lookup", h.handleLookup)
 	protected.GET("/recent", h.handleRecent)
+	protected.GET("/search", h.handleSearch)
 	protected.POST("/visitors", h.handleGetVisitors)
+	protected.POST("/stats", h.handleGetStats)
+	protected.POST("/transfer", h.handleTransfer)
+	protected.POST("/update", h.handleUpdate)
+	protected.POST("/metadata", h.handleRefreshMetadata)
+	protected.GET("/export", h.handleExportAll)
+	protected.GET("/export/:id", h.handleExport)
+	protected.GET("/live", h.handleLive)
+	protected.GET("/webhooks", h.handleGetWebhooks)
+	protected.POST("/webhooks", h.handleCreateWebhook)
+	protected.DELETE("/webhooks/:id", h.handleDeleteWebhook)
+	protected.GET("/webhooks/deliveries", h.handleGetWebhookDeliveries)
+	protected.GET("/tokens", h.handleGetAPITokens)
+	protected.POST("/tokens", h.handleCreateAPIToken)
+	protected.DELETE("/tokens/:id", h.handleDeleteAPIToken)
+	protected.GET("/teams", h.handleGetTeams)
+	protected.POST("/teams", h.handleCreateTeam)
+	protected.GET("/teams/:id", h.handleGetTeam)
+	protected.POST("/teams/:id/members", h.handleAddTeamMember)
+	protected.DELETE("/teams/:id/members/*identity", h.handleRemoveTeamMember)
+
+	admin := h.engine.Group("/api/v1/admin")
+	admin.Use(authMiddleware, h.adminMiddleware)
+	admin.GET("/entries", h.handleAdminEntries)
+	admin.GET("/entries/:id", h.handleAdminEntry)
+	admin.DELETE("/entries/:id", h.handleAdminDeleteEntry)
+	admin.POST("/entries/:id/suspend", h.handleAdminSuspendEntry)
+	admin.GET("/users", h.handleAdminUsers)
+	admin.GET("/audit", h.handleAdminAudit)
 
 	h.engine.GET("/api/v1/info", h.handleInfo)
 	h.engine.GET("/api/v1/displayURL", h.handleDisplayURL)
 	h.engine.GET("/d/:id/:hash", h.handleDelete)
 	h.engine.GET("/ok", h.handleHealthcheck)
+	if conf := util.GetConfig().Metrics; conf.Enabled && conf.ListenAddr == "" {
+		h.engine.GET("/metrics", gin.WrapH(metrics.Handler(conf.Token)))
+	}
 
 	assetBox := packr.New("Assets", "../../web/build")
 
@@ -196,11 +260,15 @@ func (h *Handler) setHandlers() error {
 		// Pass down to the embedded FS, but let 404s escape via
 		// the interceptHandler.
 		gin.WrapH(interceptHandler(http.FileServer(assetBox), customErrorHandler)),
-		// not in FS; redirect to root with customURL target filled out
+		// neither a shortcut nor in FS; render the not found page
 		func(c *gin.Context) {
 			// if we get to this point we should not let the client cache
 			c.Header("Cache-Control", "no-cache, no-store")
-			c.Redirect(http.StatusTemporaryRedirect, "/?customUrl="+c.Request.URL.Path[1:])
+			metrics.NotFoundHits.Inc()
+			c.HTML(http.StatusNotFound, "error.html", gin.H{
+				"Title":   "Link not found",
+				"Message": "The link you followed does not exist or has been deleted.",
+			})
 		})
 	return nil
 }
@@ -238,15 +306,24 @@ func interceptHandler(next http.Handler, errH errorHandler) http.Handler {
 }
 
 func customErrorHandler(w http.ResponseWriter, status int) {
-	// let 404s fall through: the next NoRoute handler will redirect
-	// them back to the main page with the customURL box filled out.
+	// let 404s fall through: the next NoRoute handler will render
+	// the not found page.
 	if status != 404 {
 		http.Error(w, "error", status)
 	}
 }
 
-// Listen starts the http server
+// Listen starts the http server and, if configured, the
+// separate one of the metrics
 func (h *Handler) Listen() error {
+	if conf := util.GetConfig().Metrics; conf.Enabled && conf.ListenAddr != "" {
+		go func() {
+			logrus.Infof("Serving metrics on %s", conf.ListenAddr)
+			if err := http.ListenAndServe(conf.ListenAddr, metrics.Handler(conf.Token)); err != nil {
+				logrus.Errorf("could not serve metrics: %v", err)
+			}
+		}()
+	}
 	return h.engine.Run(util.GetConfig().ListenAddr)
 }
 
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mxschmitt/golang-url-shortener/internal/handlers/auth"
+)
+
+// liveKeepAliveInterval is the interval in which a comment is sent to keep
+// idle connections to the live stream open through proxies
+const liveKeepAliveInterval = 30 * time.Second
+
+// handleLive streams the visits of the entries which the user owns or which
+// are shared with the user, or only of one entry if the id query parameter
+// is given, as Server-Sent Events
+func (h *Handler) handleLive(c *gin.Context) {
+	onlyID := c.Query("id")
+	if onlyID != "" {
+		if _, ok := h.authorizeEntry(c, onlyID, permissionRead); !ok {
+			return
+		}
+	}
+	// included caches the roles of the user for the entries, entries which
+	// are created while the stream is open are looked up on their first visit
+	included := map[string]bool{}
+	user := c.MustGet("user").(*auth.JWTClaims)
+	isIncluded := func(id string) bool {
+		if onlyID != "" {
+			return id == onlyID
+		}
+		if ok, cached := included[id]; cached {
+			return ok
+		}
+		entry, err := h.store.GetEntryByID(id)
+		if err == nil {
+			// admins only see the entries which they own or which are
+			// shared with them, not the ones of all users
+			included[id] = h.roleOf(c, entry) == roleOwner || entry.IsSharedWith(user.OAuthProvider, user.OAuthID)
+		}
+		return included[id]
+	}
+	events, unsubscribe := h.store.SubscribeVisits()
+	defer unsubscribe()
+	keepAlive := time.NewTicker(liveKeepAliveInterval)
+	defer keepAlive.Stop()
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	// send the headers right away, so clients know the stream is open
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			if isIncluded(event.ID) {
+				c.SSEvent("visit", event)
+			}
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return false
+			}
+		case <-c.Request.Context().Done():
+			return false
+		}
+		return true
+	})
+}
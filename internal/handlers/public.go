@@ -13,9 +13,12 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/mxschmitt/golang-url-shortener/internal/handlers/auth"
+	"github.com/mxschmitt/golang-url-shortener/internal/metrics"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores"
 	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
 	"github.com/mxschmitt/golang-url-shortener/internal/util"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 // requestHelper is used to help in- and outgoing requests for json
@@ -23,6 +26,13 @@ import (
 type requestHelper struct {
 	URL                       string `binding:"required"`
 	ID, DeletionURL, Password string
+	FallbackURL               string               `json:",omitempty"`
+	Access                    *shared.AccessPolicy `json:",omitempty"`
+	AllowedCIDRs              []string             `json:",omitempty"`
+	SharedWith                []string             `json:",omitempty"`
+	TeamID                    string               `json:",omitempty"`
+	Tags                      []string             `json:",omitempty"`
+	Notes                     string               `json:",omitempty"`
 	Expiration                *time.Time
 }
 
@@ -40,7 +50,13 @@ func (h *Handler) handleLookup(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
-	if !h.oAuthPropertiesEquals(c, entry.OAuthID, entry.OAuthProvider) {
+	if !h.roleOf(c, entry).can(permissionRead) {
+		// users without access to the details only get the target URL,
+		// if they would be redirected to it when following the link
+		if !h.canFollow(c, data.ID, entry) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "access denied"})
+			return
+		}
 		c.JSON(http.StatusOK, shared.Entry{
 			Public: shared.EntryPublicData{
 				URL: entry.Public.URL,
@@ -48,46 +64,114 @@ func (h *Handler) handleLookup(c *gin.Context) {
 		})
 		return
 	}
+	if entry.Public.UniqueVisitorsToday, err = h.store.GetUniqueVisitors(data.ID, time.Now()); err != nil {
+		logrus.Warningf("could not get unique visitors of %s: %v", data.ID, err)
+	}
 	c.JSON(http.StatusOK, entry.Public)
 }
 
+// canFollow checks if the user would be redirected to the target of an entry
+// when following the link, as checked by handleAccess
+func (h *Handler) canFollow(c *gin.Context, id string, entry *shared.Entry) bool {
+	if _, err := h.store.GetActiveEntryByID(id); err != nil {
+		return false
+	}
+	user := c.MustGet("user").(*auth.JWTClaims)
+	return entry.AllowsIP(clientIP(c)) &&
+		entry.Access.Allows(user.OAuthProvider, user.OAuthID, user.OAuthEmail) &&
+		(len(entry.Password) == 0 || h.hasUnlockCookie(c, id, entry))
+}
+
 // handleAccess handles the access for incoming requests
 func (h *Handler) handleAccess(c *gin.Context) {
 	id := c.Request.URL.Path[1:]
-	entry, err := h.store.GetEntryAndIncrease(id)
-	if err != nil {
-		if strings.Contains(err.Error(), shared.ErrNoEntryFound.Error()) {
-			return
+	entry, err := h.store.GetActiveEntryByID(id)
+	if errors.Cause(err) == shared.ErrNoEntryFound {
+		// let the embedded FS and finally the not found page handle it
+		return
+	} else if err == stores.ErrEntryIsSuspended {
+		c.Header("Cache-Control", "no-cache, no-store")
+		c.HTML(http.StatusGone, "error.html", gin.H{
+			"Title":   "Link disabled",
+			"Message": "The link you followed has been disabled by an administrator.",
+		})
+		c.Abort()
+		return
+	} else if err == stores.ErrEntryIsExpired {
+		metrics.ExpiredHits.Inc()
+		c.Header("Cache-Control", "no-cache, no-store")
+		if entry.Public.FallbackURL != "" {
+			c.Redirect(http.StatusTemporaryRedirect, entry.Public.FallbackURL)
+		} else {
+			c.HTML(http.StatusGone, "error.html", gin.H{
+				"Title":   "Link expired",
+				"Message": "The link you followed has expired and is no longer available.",
+			})
 		}
-		http.Error(c.Writer, fmt.Sprintf("could not get and crease visitor counter: %v, ", err), http.StatusInternalServerError)
+		c.Abort()
+		return
+	} else if err != nil {
+		logrus.Errorf("could not get entry %s: %v", id, err)
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"Title":   "Something went wrong",
+			"Message": "The link could not be resolved, please try again later.",
+		})
+		c.Abort()
+		return
+	}
+	if !entry.AllowsIP(clientIP(c)) {
+		c.Header("Cache-Control", "no-cache, no-store")
+		c.HTML(http.StatusForbidden, "error.html", gin.H{
+			"Title":   "Access denied",
+			"Message": "This link is not accessible from your network.",
+		})
+		c.Abort()
+		return
+	}
+	if !h.checkAccessPolicy(c, entry) {
 		return
 	}
-	// No password set
-	if len(entry.Password) == 0 {
+	// No password set or already unlocked by the browser
+	if len(entry.Password) == 0 || h.hasUnlockCookie(c, id, entry) {
 		c.Redirect(http.StatusTemporaryRedirect, entry.Public.URL)
-		go h.registerVisitor(id, c)
+		metrics.Redirects.Inc()
+		h.registerVisitor(id, c)
 		c.Abort()
 	} else {
 		templateError := ""
+		status := http.StatusOK
 		if c.Request.Method == "POST" {
 			templateError = func() string {
 				pw, exists := c.GetPostForm("password")
-				if exists {
-					if err := bcrypt.CompareHashAndPassword(entry.Password, []byte(pw)); err != nil {
-						return fmt.Sprintf("could not validate password: %v", err)
-					}
+				if !exists {
+					return "No password set"
+				}
+				switch err := h.store.CheckPassword(id, c.ClientIP(), entry, pw); err {
+				case nil:
 					return ""
+				case stores.ErrInvalidPassword:
+					metrics.PasswordFailures.Inc()
+					status = http.StatusUnauthorized
+					return "The password is not correct."
+				case stores.ErrTooManyAttempts:
+					status = http.StatusTooManyRequests
+					return "Too many failed attempts, please try again later."
+				default:
+					logrus.Errorf("could not check password of %s: %v", id, err)
+					status = http.StatusInternalServerError
+					return "The password could not be checked, please try again later."
 				}
-				return "No password set"
 			}()
 			if templateError == "" {
+				h.setUnlockCookie(c, id, entry)
 				c.Redirect(http.StatusSeeOther, entry.Public.URL)
-				go h.registerVisitor(id, c)
+				metrics.Redirects.Inc()
+				h.registerVisitor(id, c)
 				c.Abort()
 				return
 			}
 		}
-		c.HTML(http.StatusOK, "protected.html", gin.H{
+		c.HTML(status, "protected.html", gin.H{
 			"ID":    id,
 			"Error": templateError,
 		})
@@ -101,12 +185,24 @@ func (h *Handler) handleCreate(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if data.TeamID != "" {
+		if _, ok := h.authorizeTeam(c, data.TeamID); !ok {
+			return
+		}
+	}
 	user := c.MustGet("user").(*auth.JWTClaims)
 	id, delID, err := h.store.CreateEntry(shared.Entry{
 		Public: shared.EntryPublicData{
-			URL:        data.URL,
-			Expiration: data.Expiration,
+			URL:         data.URL,
+			FallbackURL: data.FallbackURL,
+			Expiration:  data.Expiration,
 		},
+		Access:        data.Access,
+		AllowedCIDRs:  data.AllowedCIDRs,
+		SharedWith:    data.SharedWith,
+		TeamID:        data.TeamID,
+		Tags:          data.Tags,
+		Notes:         data.Notes,
 		RemoteAddr:    c.ClientIP(),
 		OAuthProvider: user.OAuthProvider,
 		OAuthID:       user.OAuthID,
@@ -126,13 +222,21 @@ func (h *Handler) handleCreate(c *gin.Context) {
 // handleGetVisitors handles requests to create an entry
 func (h *Handler) handleGetVisitors(c *gin.Context) {
 	var data struct {
-		ID string `binding:"required"`
+		ID   string `binding:"required"`
+		Bots bool
 	}
 	if err := c.ShouldBind(&data); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	dataSets, err := h.store.GetVisitors(data.ID)
+	if _, ok := h.authorizeEntry(c, data.ID, permissionRead); !ok {
+		return
+	}
+	getVisitors := h.store.GetVisitors
+	if data.Bots {
+		getVisitors = h.store.GetBotVisitors
+	}
+	dataSets, err := getVisitors(data.ID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -140,6 +244,132 @@ func (h *Handler) handleGetVisitors(c *gin.Context) {
 	c.JSON(http.StatusOK, dataSets)
 }
 
+// handleGetStats handles requests to get the aggregated visitors of an entry
+func (h *Handler) handleGetStats(c *gin.Context) {
+	var data struct {
+		ID       string `binding:"required"`
+		Interval string
+		TimeZone string
+		From, To time.Time
+	}
+	if err := c.ShouldBind(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := h.authorizeEntry(c, data.ID, permissionRead); !ok {
+		return
+	}
+	var err error
+	location := time.UTC
+	if data.TimeZone != "" {
+		if location, err = time.LoadLocation(data.TimeZone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("could not load time zone: %v", err)})
+			return
+		}
+	}
+	stats, err := h.store.GetStats(data.ID, stores.StatsQuery{
+		Interval: data.Interval,
+		Location: location,
+		From:     data.From,
+		To:       data.To,
+	})
+	if err == stores.ErrInvalidInterval {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// handleTransfer reassigns an entry to another user or to a team, entries
+// can only be transferred to teams of which the user is a member
+func (h *Handler) handleTransfer(c *gin.Context) {
+	var data struct {
+		ID string `binding:"required"`
+		To string `binding:"required"`
+	}
+	if err := c.ShouldBind(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := h.authorizeEntry(c, data.ID, permissionManage); !ok {
+		return
+	}
+	to := strings.TrimSpace(data.To)
+	if strings.HasPrefix(to, shared.TeamEntriesPrefix) {
+		if _, ok := h.authorizeTeam(c, strings.TrimPrefix(to, shared.TeamEntriesPrefix)); !ok {
+			return
+		}
+	}
+	user := c.MustGet("user").(*auth.JWTClaims)
+	err := h.store.TransferEntry(data.ID, to, shared.Identity(user.OAuthProvider, user.OAuthID))
+	switch errors.Cause(err) {
+	case nil:
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	case stores.ErrInvalidNewOwner, stores.ErrAlreadyOwner:
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.Cause(err).Error()})
+	case shared.ErrNoEntryFound, shared.ErrNoTeamFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": errors.Cause(err).Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// handleUpdate changes the tags and the notes of an entry
+func (h *Handler) handleUpdate(c *gin.Context) {
+	var data struct {
+		ID    string `binding:"required"`
+		Tags  []string
+		Notes string
+	}
+	if err := c.ShouldBind(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := h.authorizeEntry(c, data.ID, permissionManage); !ok {
+		return
+	}
+	switch err := h.store.UpdateEntryDetails(data.ID, data.Tags, data.Notes); errors.Cause(err) {
+	case nil:
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	case stores.ErrInvalidTags, stores.ErrNotesTooLong:
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.Cause(err).Error()})
+	case shared.ErrNoEntryFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": shared.ErrNoEntryFound.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// handleRefreshMetadata fetches the metadata of the target page of an entry again
+func (h *Handler) handleRefreshMetadata(c *gin.Context) {
+	var data struct {
+		ID string `binding:"required"`
+	}
+	if err := c.ShouldBind(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := h.authorizeEntry(c, data.ID, permissionManage); !ok {
+		return
+	}
+	pageMetadata, err := h.store.RefreshMetadata(c.Request.Context(), data.ID)
+	switch errors.Cause(err) {
+	case nil:
+		c.JSON(http.StatusOK, pageMetadata)
+	case stores.ErrMetadataDisabled:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	case stores.ErrFetchingMetadataFailed:
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	case shared.ErrNoEntryFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": shared.ErrNoEntryFound.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 // handleHealthcheck returns success for healthcheckers without polluting logs
 func (h *Handler) handleHealthcheck(c *gin.Context) {
 	out := struct {
@@ -171,7 +401,40 @@ func (h *Handler) handleDisplayURL(c *gin.Context) {
 
 func (h *Handler) handleRecent(c *gin.Context) {
 	user := c.MustGet("user").(*auth.JWTClaims)
-	entries, err := h.store.GetUserEntries(user.OAuthProvider, user.OAuthID)
+	var entries map[string]shared.Entry
+	var err error
+	if teamID := c.Query("team"); teamID != "" {
+		if _, ok := h.authorizeTeam(c, teamID); !ok {
+			return
+		}
+		entries, err = h.store.GetTeamEntries(teamID)
+	} else {
+		entries, err = h.store.GetUserEntries(user.OAuthProvider, user.OAuthID)
+	}
+	h.respondEntries(c, entries, err)
+}
+
+// handleSearch searches the entries of the user or, with the team query
+// parameter, of a team of the user
+func (h *Handler) handleSearch(c *gin.Context) {
+	user := c.MustGet("user").(*auth.JWTClaims)
+	teamID := c.Query("team")
+	if teamID != "" {
+		if _, ok := h.authorizeTeam(c, teamID); !ok {
+			return
+		}
+	}
+	entries, err := h.store.SearchUserEntries(user.OAuthProvider, user.OAuthID, teamID, c.Query("q"))
+	if err == stores.ErrNoValidQuery {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.respondEntries(c, entries, err)
+}
+
+// respondEntries responds with the entries together with their deletion
+// URLs or with the error of getting them
+func (h *Handler) respondEntries(c *gin.Context, entries map[string]shared.Entry, err error) {
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -210,8 +473,10 @@ func (h *Handler) getURLOrigin(c *gin.Context) string {
 	return fmt.Sprintf("%s://%s", protocol, c.Request.Host)
 }
 
+// registerVisitor collects the visitor data of the request and
+// registers the visit in the background
 func (h *Handler) registerVisitor(id string, c *gin.Context) {
-	h.store.RegisterVisit(id, shared.Visitor{
+	visitor := shared.Visitor{
 		IP:          c.ClientIP(),
 		Timestamp:   time.Now(),
 		Referer:     c.GetHeader("Referer"),
@@ -221,5 +486,27 @@ func (h *Handler) registerVisitor(id string, c *gin.Context) {
 		UTMCampaign: c.Query("utm_campaign"),
 		UTMContent:  c.Query("utm_content"),
 		UTMTerm:     c.Query("utm_term"),
-	})
+		Country:     visitorCountry(c),
+	}
+	if util.GetConfig().Privacy.RespectDoNotTrack && doNotTrack(c) {
+		go h.store.RegisterUntrackedVisit(id, visitor)
+		return
+	}
+	go h.store.RegisterVisit(id, visitor)
+}
+
+// doNotTrack checks if the client requested to not be tracked
+// via the Do Not Track or the Global Privacy Control header
+func doNotTrack(c *gin.Context) bool {
+	return c.GetHeader("DNT") == "1" || c.GetHeader("Sec-GPC") == "1"
+}
+
+// visitorCountry returns the country code of the client
+// if a header which contains it is configured
+func visitorCountry(c *gin.Context) string {
+	header := util.GetConfig().Visitors.CountryHeader
+	if header == "" {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimSpace(c.GetHeader(header)))
 }
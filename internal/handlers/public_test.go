@@ -1,18 +1,23 @@
 package handlers
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mxschmitt/golang-url-shortener/internal/stores"
 	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/mxschmitt/golang-url-shortener/internal/util"
 )
 
 const testURL = "https://www.google.de/"
@@ -275,11 +280,497 @@ func TestHandleDeletion(t *testing.T) {
 		t.Fatalf("could not send visit request: %v", err)
 	}
 	fmt.Println(body.URL)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status: %d; got: %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func TestHandleCreateBulk(t *testing.T) {
+	tt := []struct {
+		name       string
+		mode       string
+		urls       []string
+		statusCode int
+		created    []bool
+	}{
+		{"atomic", "", []string{testURL, testURL}, http.StatusOK, []bool{true, true}},
+		{"atomic with invalid URL", "atomic", []string{testURL, "this is no URL"}, http.StatusBadRequest, []bool{false, false}},
+		{"best-effort with invalid URL", "best-effort", []string{"this is no URL", testURL}, http.StatusOK, []bool{false, true}},
+		{"invalid mode", "some", []string{testURL}, http.StatusBadRequest, nil},
+		{"no entries", "", []string{}, http.StatusBadRequest, nil},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			entries := []gin.H{}
+			for _, u := range tc.urls {
+				entries = append(entries, gin.H{"URL": u})
+			}
+			reqBody, err := json.Marshal(gin.H{"Mode": tc.mode, "Entries": entries})
+			if err != nil {
+				t.Fatalf("could not marshal json: %v", err)
+			}
+			req, err := http.NewRequest("POST", server.URL+"/api/v1/protected/create/bulk", bytes.NewBuffer(reqBody))
+			if err != nil {
+				t.Fatalf("could not create request %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", tokenString)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("could not do request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.statusCode {
+				t.Fatalf("expected status %d; got %d", tc.statusCode, resp.StatusCode)
+			}
+			if tc.created == nil {
+				return
+			}
+			var body struct {
+				Results []bulkResult
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("could not decode response: %v", err)
+			}
+			if len(body.Results) != len(tc.created) {
+				t.Fatalf("expected %d results; got %d", len(tc.created), len(body.Results))
+			}
+			for i, result := range body.Results {
+				if created := result.Error == ""; created != tc.created[i] {
+					t.Fatalf("entry %d was created: %v; expected: %v, error: %s", i, created, tc.created[i], result.Error)
+				}
+				if tc.created[i] {
+					testRedirect(t, result.URL, testURL)
+					if !strings.Contains(result.DeletionURL, "/d/"+result.ID+"/") {
+						t.Fatalf("deletion URL is not correct: %s", result.DeletionURL)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHandleExpired(t *testing.T) {
+	expiration := time.Now().Add(-time.Hour)
+	tt := []struct {
+		name        string
+		requestBody requestHelper
+		statusCode  int
+		location    string
+	}{
+		{
+			name: "without fallback URL",
+			requestBody: requestHelper{
+				URL:        testURL,
+				Expiration: &expiration,
+			},
+			statusCode: http.StatusGone,
+		},
+		{
+			name: "with fallback URL",
+			requestBody: requestHelper{
+				URL:         testURL,
+				FallbackURL: "https://www.google.com/",
+				Expiration:  &expiration,
+			},
+			statusCode: http.StatusTemporaryRedirect,
+			location:   "https://www.google.com/",
+		},
+	}
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}, // don't follow redirects
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(tc.requestBody)
+			if err != nil {
+				t.Fatalf("could not marshal json: %v", err)
+			}
+			respBody := createEntryWithJSON(t, reqBody, "application/json; charset=utf-8", http.StatusOK)
+			var body requestHelper
+			if err := json.Unmarshal(respBody, &body); err != nil {
+				t.Fatal("could not unmarshal create response")
+			}
+			resp, err := client.Get(body.URL)
+			if err != nil {
+				t.Fatalf("could not send visit request: %v", err)
+			}
+			if resp.StatusCode != tc.statusCode {
+				t.Fatalf("expected status: %d; got: %d", tc.statusCode, resp.StatusCode)
+			}
+			if resp.Header.Get("Location") != tc.location {
+				t.Fatalf("expected location: %s; got: %s", tc.location, resp.Header.Get("Location"))
+			}
+		})
+	}
+}
+
+func TestHandleProtected(t *testing.T) {
+	reqBody, err := json.Marshal(requestHelper{
+		URL:      testURL,
+		Password: "secret",
+	})
+	if err != nil {
+		t.Fatalf("could not marshal json: %v", err)
+	}
+	respBody := createEntryWithJSON(t, reqBody, "application/json; charset=utf-8", http.StatusOK)
+	var body requestHelper
+	if err := json.Unmarshal(respBody, &body); err != nil {
+		t.Fatal("could not unmarshal create response")
+	}
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}, // don't follow redirects
+	}
+	resp, err := client.Get(body.URL)
+	if err != nil {
+		t.Fatalf("could not send visit request: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status: %d; got: %d", http.StatusOK, resp.StatusCode)
+	}
+	resp, err = client.PostForm(body.URL, url.Values{"password": {"wrong"}})
+	if err != nil {
+		t.Fatalf("could not send password: %v", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected status: %d; got: %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+	resp, err = client.PostForm(body.URL, url.Values{"password": {"secret"}})
+	if err != nil {
+		t.Fatalf("could not send password: %v", err)
+	}
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected status: %d; got: %d", http.StatusSeeOther, resp.StatusCode)
+	}
+	cookies := resp.Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected one unlock cookie; got: %d", len(cookies))
+	}
+	req, err := http.NewRequest("GET", body.URL, nil)
+	if err != nil {
+		t.Fatalf("could not create request %v", err)
+	}
+	req.AddCookie(cookies[0])
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("could not send visit request: %v", err)
+	}
+	if resp.StatusCode != http.StatusTemporaryRedirect {
+		t.Fatalf("expected status: %d; got: %d", http.StatusTemporaryRedirect, resp.StatusCode)
+	}
+}
+
+func TestHandleAccessPolicy(t *testing.T) {
+	reqBody, err := json.Marshal(requestHelper{
+		URL: testURL,
+		Access: &shared.AccessPolicy{
+			Mode:         shared.AccessRestricted,
+			EmailDomains: []string{"example.com"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not marshal json: %v", err)
+	}
+	respBody := createEntryWithJSON(t, reqBody, "application/json; charset=utf-8", http.StatusOK)
+	var body requestHelper
+	if err := json.Unmarshal(respBody, &body); err != nil {
+		t.Fatal("could not unmarshal create response")
+	}
+	resp, err := http.Get(body.URL)
+	if err != nil {
+		t.Fatalf("could not send visit request: %v", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected status: %d; got: %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func TestHandleAllowedCIDRs(t *testing.T) {
+	tt := []struct {
+		name         string
+		allowedCIDRs []string
+		forwardedFor string
+		statusCode   int
+	}{
+		{
+			name:         "client inside of the allowed CIDRs",
+			allowedCIDRs: []string{"192.0.2.0/24"},
+			forwardedFor: "192.0.2.1",
+			statusCode:   http.StatusTemporaryRedirect,
+		},
+		{
+			name:         "client outside of the allowed CIDRs",
+			allowedCIDRs: []string{"127.0.0.1"},
+			forwardedFor: "192.0.2.1",
+			statusCode:   http.StatusForbidden,
+		},
+		{
+			name:         "client with spoofed forwarding chain",
+			allowedCIDRs: []string{"192.0.2.0/24"},
+			forwardedFor: "192.0.2.1, 203.0.113.9",
+			statusCode:   http.StatusForbidden,
+		},
+	}
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}, // don't follow redirects
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(requestHelper{
+				URL:          testURL,
+				AllowedCIDRs: tc.allowedCIDRs,
+			})
+			if err != nil {
+				t.Fatalf("could not marshal json: %v", err)
+			}
+			respBody := createEntryWithJSON(t, reqBody, "application/json; charset=utf-8", http.StatusOK)
+			var body requestHelper
+			if err := json.Unmarshal(respBody, &body); err != nil {
+				t.Fatal("could not unmarshal create response")
+			}
+			req, err := http.NewRequest("GET", body.URL, nil)
+			if err != nil {
+				t.Fatalf("could not create request %v", err)
+			}
+			req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("could not send visit request: %v", err)
+			}
+			if resp.StatusCode != tc.statusCode {
+				t.Fatalf("expected status: %d; got: %d", tc.statusCode, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestHandleNotFound(t *testing.T) {
+	resp, err := http.Get(server.URL + "/this-id-does-not-exist")
+	if err != nil {
+		t.Fatalf("could not send visit request: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status: %d; got: %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func TestHandleExport(t *testing.T) {
+	respBody := createEntryWithJSON(t, []byte(makeJSON(t, requestHelper{URL: testURL})), "application/json; charset=utf-8", http.StatusOK)
+	var body requestHelper
+	if err := json.Unmarshal(respBody, &body); err != nil {
+		t.Fatal("could not unmarshal create response")
+	}
+	testRedirect(t, body.URL, testURL)
+	export := func(query string) (*http.Response, string) {
+		req, err := http.NewRequest("GET", server.URL+"/api/v1/protected/export/"+body.ID+query, nil)
+		if err != nil {
+			t.Fatalf("could not create request %v", err)
+		}
+		req.Header.Set("Authorization", tokenString)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("could not do request: %v", err)
+		}
+		defer resp.Body.Close()
+		raw, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read body: %v", err)
+		}
+		return resp, string(raw)
+	}
+	// the visit is registered in the background
+	var lines []string
+	for i := 0; i < 50 && len(lines) < 2; i++ {
+		time.Sleep(20 * time.Millisecond)
+		_, raw := export("?format=csv")
+		lines = strings.Split(strings.TrimSpace(raw), "\n")
+	}
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "ID,Timestamp,IP") || !strings.HasPrefix(lines[1], body.ID+",") {
+		t.Fatalf("csv export is not the expected one: %v", lines)
+	}
+	resp, raw := export("?format=ndjson")
+	if resp.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Errorf("content-type is not the expected one: %s", resp.Header.Get("Content-Type"))
+	}
+	var record exportRecord
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), &record); err != nil || record.ID != body.ID {
+		t.Errorf("ndjson export is not the expected one: %s", raw)
+	}
+	if _, raw := export("?format=ndjson&from=" + url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))); raw != "" {
+		t.Errorf("export contains visitors before from: %s", raw)
+	}
+	if resp, _ := export("?format=xml"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d for invalid format; got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestHandleLive(t *testing.T) {
+	respBody := createEntryWithJSON(t, []byte(makeJSON(t, requestHelper{URL: testURL})), "application/json; charset=utf-8", http.StatusOK)
+	var body requestHelper
+	if err := json.Unmarshal(respBody, &body); err != nil {
+		t.Fatal("could not unmarshal create response")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequest("GET", server.URL+"/api/v1/protected/live?id="+body.ID, nil)
+	if err != nil {
+		t.Fatalf("could not create request %v", err)
+	}
+	req.Header.Set("Authorization", tokenString)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("could not do request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("content-type is not the expected one: %s", resp.Header.Get("Content-Type"))
+	}
+	testRedirect(t, body.URL, testURL)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if !strings.HasPrefix(scanner.Text(), "data:") {
+			continue
+		}
+		var event shared.VisitEvent
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(scanner.Text(), "data:")), &event); err != nil {
+			t.Fatalf("could not unmarshal event: %v", err)
+		}
+		if event.ID != body.ID {
+			t.Fatalf("event is not the expected one: %+v", event)
+		}
+		return
+	}
+	t.Fatalf("no visit event received: %v", scanner.Err())
+}
+
+func TestHandleMetrics(t *testing.T) {
+	respBody := createEntryWithJSON(t, []byte(makeJSON(t, requestHelper{URL: testURL})), "application/json; charset=utf-8", http.StatusOK)
+	var body requestHelper
+	if err := json.Unmarshal(respBody, &body); err != nil {
+		t.Fatal("could not unmarshal create response")
+	}
+	testRedirect(t, body.URL, testURL)
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("could not get metrics: %v", err)
+	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		t.Fatalf("expected status: %d; got: %d", http.StatusOK, resp.StatusCode)
 	}
+	metrics, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("could not read metrics: %v", err)
+	}
+	for _, series := range []string{
+		"gus_redirects_total ",
+		"gus_entries_created_total ",
+		`gus_http_requests_total{method="POST",route="/api/v1/protected/create",status="200"}`,
+		`gus_storage_operation_duration_seconds_count{backend="boltdb",method="CreateEntry"}`,
+	} {
+		if !strings.Contains(string(metrics), series) {
+			t.Errorf("metrics do not contain %s", series)
+		}
+	}
+}
+
+func TestHandleSearch(t *testing.T) {
+	var created requestHelper
+	doJSONRequest(t, tokenString, "POST", "/api/v1/protected/create", makeJSON(t, requestHelper{
+		URL:   "https://example.com/quarterly-report",
+		Tags:  []string{"Finance", " finance ", "Q3"},
+		Notes: "Shared with the board",
+	}), http.StatusOK, &created)
+	tooMany := make([]string, 21)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("tag%d", i)
+	}
+	doJSONRequest(t, tokenString, "POST", "/api/v1/protected/create", makeJSON(t, requestHelper{URL: testURL, Tags: tooMany}), http.StatusBadRequest, nil)
+	search := func(token, query string, statusCode int) map[string]shared.Entry {
+		var entries map[string]shared.Entry
+		doJSONRequest(t, token, "GET", "/api/v1/protected/search?q="+url.QueryEscape(query), "", statusCode, &entries)
+		return entries
+	}
+	tt := []struct {
+		name  string
+		query string
+		found bool
+	}{
+		{name: "tag", query: "financ", found: true},
+		{name: "notes and URL", query: "BOARD quarterly", found: true},
+		{name: "ID", query: created.ID, found: true},
+		{name: "all words have to match", query: "finance unrelated", found: false},
+		{name: "words are matched by their beginning", query: "inance", found: false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			entry, ok := search(tokenString, tc.query, http.StatusOK)[created.ID]
+			if ok != tc.found {
+				t.Fatalf("expected entry to be found: %t", tc.found)
+			}
+			if ok && (len(entry.Tags) != 2 || entry.Notes != "Shared with the board") {
+				t.Fatalf("tags and notes are not the expected ones: %v, %q", entry.Tags, entry.Notes)
+			}
+		})
+	}
+	if _, ok := search(signTestToken(t, "stranger"), "finance", http.StatusOK)[created.ID]; ok {
+		t.Fatal("entry of another user was found")
+	}
+	doJSONRequest(t, tokenString, "GET", "/api/v1/protected/search?q=-", "", http.StatusBadRequest, nil)
+
+	update := makeJSON(t, map[string]interface{}{"ID": created.ID, "Tags": []string{"archive"}})
+	doJSONRequest(t, signTestToken(t, "stranger"), "POST", "/api/v1/protected/update", update, http.StatusForbidden, nil)
+	doJSONRequest(t, tokenString, "POST", "/api/v1/protected/update", update, http.StatusOK, nil)
+	if _, ok := search(tokenString, "finance", http.StatusOK)[created.ID]; ok {
+		t.Fatal("entry was found by a removed tag")
+	}
+	if _, ok := search(tokenString, "archive", http.StatusOK)[created.ID]; !ok {
+		t.Fatal("entry was not found by an added tag")
+	}
+	tooLong := makeJSON(t, map[string]interface{}{"ID": created.ID, "Tags": []string{strings.Repeat("a", 65)}})
+	doJSONRequest(t, tokenString, "POST", "/api/v1/protected/update", tooLong, http.StatusBadRequest, nil)
 }
 
 func TestCloseB(t *testing.T) {
 	TestCloseBackend(t)
 }
+
+func TestHandleMetadata(t *testing.T) {
+	title := "First title"
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<head><title>%s</title><meta name="description" content="A page"></head>`, title)
+	}))
+	defer page.Close()
+	config := util.GetConfig()
+	defer util.SetConfig(config)
+	metadataConfig := config
+	metadataConfig.Metadata.AllowPrivate = true
+	util.SetConfig(metadataConfig)
+	TestCreateBackend(t)
+	defer TestCloseBackend(t)
+	TestCreateNewJWT(t)
+	var created requestHelper
+	doJSONRequest(t, tokenString, "POST", "/api/v1/protected/create", makeJSON(t, requestHelper{URL: page.URL + "/"}), http.StatusOK, &created)
+	idBody := makeJSON(t, map[string]string{"ID": created.ID})
+	var entry shared.EntryPublicData
+	for deadline := time.Now().Add(5 * time.Second); entry.Metadata == nil && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		doJSONRequest(t, tokenString, "POST", "/api/v1/protected/lookup", idBody, http.StatusOK, &entry)
+	}
+	if entry.Metadata == nil || entry.Metadata.Title != "First title" || entry.Metadata.Description != "A page" {
+		t.Fatalf("metadata was not fetched on creation: %+v", entry.Metadata)
+	}
+	title = "Second title"
+	doJSONRequest(t, signTestToken(t, "stranger"), "POST", "/api/v1/protected/metadata", idBody, http.StatusForbidden, nil)
+	var metadata shared.PageMetadata
+	doJSONRequest(t, tokenString, "POST", "/api/v1/protected/metadata", idBody, http.StatusOK, &metadata)
+	if metadata.Title != "Second title" {
+		t.Fatalf("refreshed metadata is not the expected one: %+v", metadata)
+	}
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/mxschmitt/golang-url-shortener/internal/handlers/auth"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/mxschmitt/golang-url-shortener/internal/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultAccessTokenLifetime is the lifetime of the JWTs if nothing is configured
+const defaultAccessTokenLifetime = 15 * time.Minute
+
+// signAccessToken signs a short-lived JWT of the session, it is only
+// accepted as long as the session exists
+func (h *Handler) signAccessToken(session *shared.Session) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.JWTClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        session.ID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(h.accessTokenLifetime).Unix(),
+		},
+		OAuthProvider: session.OAuthProvider,
+		OAuthID:       session.OAuthID,
+		OAuthName:     session.OAuthName,
+		OAuthPicture:  session.OAuthPicture,
+		OAuthEmail:    session.OAuthEmail,
+	})
+	tokenString, err := token.SignedString(util.GetPrivateKey())
+	if err != nil {
+		return "", errors.Wrap(err, "could not sign token")
+	}
+	return tokenString, nil
+}
+
+// issueSession starts a session for the user who logged in and returns its
+// access token and its refresh token
+func (h *Handler) issueSession(claims auth.JWTClaims) (string, string, error) {
+	refreshToken, session, err := h.store.CreateSession(shared.Session{
+		OAuthProvider: claims.OAuthProvider,
+		OAuthID:       claims.OAuthID,
+		OAuthName:     claims.OAuthName,
+		OAuthPicture:  claims.OAuthPicture,
+		OAuthEmail:    claims.OAuthEmail,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	token, err := h.signAccessToken(session)
+	if err != nil {
+		return "", "", err
+	}
+	return token, refreshToken, nil
+}
+
+// refreshSession renews the session of the refresh token and returns a new
+// access token and a new refresh token
+func (h *Handler) refreshSession(refreshToken string) (string, string, error) {
+	newRefreshToken, session, err := h.store.RefreshSession(refreshToken)
+	if err != nil {
+		return "", "", err
+	}
+	token, err := h.signAccessToken(session)
+	if err != nil {
+		return "", "", err
+	}
+	return token, newRefreshToken, nil
+}
+
+// requestRefreshToken returns the refresh token of the request body or, if
+// there is none, the one of the browser session
+func requestRefreshToken(c *gin.Context) string {
+	var data struct {
+		RefreshToken string
+	}
+	// the body is optional, the browser sends the refresh token as a cookie
+	if err := c.ShouldBindJSON(&data); err == nil && data.RefreshToken != "" {
+		return data.RefreshToken
+	}
+	refreshToken, _ := sessions.Default(c).Get("refreshToken").(string)
+	return refreshToken
+}
+
+// saveBrowserSession stores the tokens in the browser session, empty tokens
+// remove them. Clients without a browser session don't get one.
+func saveBrowserSession(c *gin.Context, token, refreshToken string) error {
+	session := sessions.Default(c)
+	if token == "" {
+		if session.Get("token") == nil && session.Get("refreshToken") == nil {
+			return nil
+		}
+		session.Delete("token")
+		session.Delete("refreshToken")
+	} else {
+		session.Set("token", token)
+		session.Set("refreshToken", refreshToken)
+	}
+	return errors.Wrap(session.Save(), "could not save session")
+}
+
+// handleRefresh renews the session of the refresh token, the response
+// contains a new access token and a new refresh token since every refresh
+// token can only be used once
+func (h *Handler) handleRefresh(c *gin.Context) {
+	refreshToken := requestRefreshToken(c)
+	if refreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no refresh token provided"})
+		return
+	}
+	token, newRefreshToken, err := h.refreshSession(refreshToken)
+	if err == stores.ErrInvalidRefreshToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if cookie, _ := sessions.Default(c).Get("refreshToken").(string); cookie == refreshToken {
+		if err := saveBrowserSession(c, token, newRefreshToken); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Token":        token,
+		"RefreshToken": newRefreshToken,
+	})
+}
+
+// sessionClaims returns the claims of the access token of the request or,
+// if it is not valid, the ones of the session of the refresh token. So a
+// user can still log out when the access token is expired.
+func (h *Handler) sessionClaims(c *gin.Context) (*auth.JWTClaims, error) {
+	if token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "); token != "" {
+		claims, err := h.parseJWT(token)
+		if err == nil {
+			return claims, nil
+		}
+		logrus.Debugf("Could not parse JWT of logout: %v", err)
+	}
+	session, err := h.store.GetRefreshTokenSession(requestRefreshToken(c))
+	if err != nil {
+		return nil, err
+	}
+	return &auth.JWTClaims{
+		StandardClaims: jwt.StandardClaims{Id: session.ID},
+		OAuthProvider:  session.OAuthProvider,
+		OAuthID:        session.OAuthID,
+	}, nil
+}
+
+// handleLogout revokes the session of the request
+func (h *Handler) handleLogout(c *gin.Context) {
+	claims, err := h.sessionClaims(c)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "authentication failed"})
+		logrus.Debugf("Could not get session of logout: %v", err)
+		return
+	}
+	if err := h.store.RevokeSession(claims.Id); err != nil && errors.Cause(err) != shared.ErrNoSessionFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := saveBrowserSession(c, "", ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// handleLogoutAll revokes all sessions of the user of the request
+func (h *Handler) handleLogoutAll(c *gin.Context) {
+	claims, err := h.sessionClaims(c)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "authentication failed"})
+		logrus.Debugf("Could not get session of logout: %v", err)
+		return
+	}
+	if err := h.store.RevokeUserSessions(claims.OAuthProvider, claims.OAuthID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := saveBrowserSession(c, "", ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
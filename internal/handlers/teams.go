@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mxschmitt/golang-url-shortener/internal/handlers/auth"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+)
+
+// handleGetTeams returns the teams of the user
+func (h *Handler) handleGetTeams(c *gin.Context) {
+	user := c.MustGet("user").(*auth.JWTClaims)
+	teams, err := h.store.GetUserTeams(user.OAuthProvider, user.OAuthID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, teams)
+}
+
+// handleCreateTeam creates a team of which the user is the first member
+func (h *Handler) handleCreateTeam(c *gin.Context) {
+	var data struct {
+		Name string `binding:"required"`
+	}
+	if err := c.ShouldBind(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user := c.MustGet("user").(*auth.JWTClaims)
+	team, err := h.store.CreateTeam(data.Name, shared.Identity(user.OAuthProvider, user.OAuthID))
+	if err == stores.ErrNoValidTeamName {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, team)
+}
+
+// handleGetTeam returns a team of the user
+func (h *Handler) handleGetTeam(c *gin.Context) {
+	team, ok := h.authorizeTeam(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, team)
+}
+
+// handleAddTeamMember adds a user by its identity to a team of the user
+func (h *Handler) handleAddTeamMember(c *gin.Context) {
+	var data struct {
+		Identity string `binding:"required"`
+	}
+	if err := c.ShouldBind(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := h.authorizeTeam(c, c.Param("id")); !ok {
+		return
+	}
+	h.respondTeamChange(c, h.store.AddTeamMember(c.Param("id"), data.Identity))
+}
+
+// handleRemoveTeamMember removes a user by its identity from a team of the
+// user, members can leave a team by removing themselves
+func (h *Handler) handleRemoveTeamMember(c *gin.Context) {
+	if _, ok := h.authorizeTeam(c, c.Param("id")); !ok {
+		return
+	}
+	identity := strings.TrimPrefix(c.Param("identity"), "/")
+	h.respondTeamChange(c, h.store.RemoveTeamMember(c.Param("id"), identity))
+}
+
+// respondTeamChange responds with the changed team or the error of the change
+func (h *Handler) respondTeamChange(c *gin.Context, err error) {
+	switch errors.Cause(err) {
+	case nil:
+	case stores.ErrInvalidIdentity, shared.ErrLastTeamMember:
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.Cause(err).Error()})
+		return
+	case shared.ErrNoTeamFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": shared.ErrNoTeamFound.Error()})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	team, err := h.store.GetTeam(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, team)
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mxschmitt/golang-url-shortener/internal/handlers/auth"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+)
+
+// readScopeRoutes are the routes which an API token with the read scope can
+// access
+var readScopeRoutes = map[string]bool{
+	"POST /api/v1/protected/lookup":    true,
+	"POST /api/v1/protected/visitors":  true,
+	"POST /api/v1/protected/stats":     true,
+	"GET /api/v1/protected/recent":     true,
+	"GET /api/v1/protected/search":     true,
+	"GET /api/v1/protected/export":     true,
+	"GET /api/v1/protected/export/:id": true,
+	"GET /api/v1/protected/live":       true,
+}
+
+// tokenScopeAllows checks if an API token with the scope can do a request
+// with the method on the route
+func tokenScopeAllows(scope, method, route string) bool {
+	switch scope {
+	case shared.TokenScopeFull:
+		return true
+	case shared.TokenScopeRead:
+		return readScopeRoutes[method+" "+route]
+	case shared.TokenScopeCreate:
+		return method == "POST" && (route == "/api/v1/protected/create" || route == "/api/v1/protected/create/bulk")
+	}
+	return false
+}
+
+// apiTokenResponse is an API token as it is returned to its user, the hash
+// is never returned and the token itself only once after its creation
+type apiTokenResponse struct {
+	ID        string
+	Name      string
+	Scope     string
+	Token     string `json:",omitempty"`
+	CreatedOn time.Time
+	LastUsed  *time.Time `json:",omitempty"`
+}
+
+func newAPITokenResponse(token shared.APIToken) apiTokenResponse {
+	return apiTokenResponse{
+		ID:        token.ID,
+		Name:      token.Name,
+		Scope:     token.Scope,
+		CreatedOn: token.CreatedOn,
+		LastUsed:  token.LastUsed,
+	}
+}
+
+// handleGetAPITokens returns the personal API tokens of the user
+func (h *Handler) handleGetAPITokens(c *gin.Context) {
+	user := c.MustGet("user").(*auth.JWTClaims)
+	tokens, err := h.store.GetAPITokens(user.OAuthProvider, user.OAuthID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response := []apiTokenResponse{}
+	for _, token := range tokens {
+		response = append(response, newAPITokenResponse(token))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleCreateAPIToken creates a personal API token for the user, the
+// response contains the token itself, which can't be retrieved later on
+func (h *Handler) handleCreateAPIToken(c *gin.Context) {
+	var data struct {
+		Name  string `binding:"required"`
+		Scope string
+	}
+	if err := c.ShouldBind(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user := c.MustGet("user").(*auth.JWTClaims)
+	plain, token, err := h.store.CreateAPIToken(shared.APIToken{
+		Name:          data.Name,
+		Scope:         data.Scope,
+		OAuthProvider: user.OAuthProvider,
+		OAuthID:       user.OAuthID,
+		OAuthName:     user.OAuthName,
+		OAuthPicture:  user.OAuthPicture,
+		OAuthEmail:    user.OAuthEmail,
+	})
+	switch err {
+	case nil:
+		response := newAPITokenResponse(*token)
+		response.Token = plain
+		c.JSON(http.StatusOK, response)
+	case stores.ErrNoValidTokenName, stores.ErrInvalidTokenScope:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// handleDeleteAPIToken revokes a personal API token of the user
+func (h *Handler) handleDeleteAPIToken(c *gin.Context) {
+	user := c.MustGet("user").(*auth.JWTClaims)
+	err := h.store.RevokeAPIToken(user.OAuthProvider, user.OAuthID, c.Param("id"))
+	if errors.Cause(err) == shared.ErrNoAPITokenFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": shared.ErrNoAPITokenFound.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
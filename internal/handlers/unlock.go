@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/mxschmitt/golang-url-shortener/internal/util"
+)
+
+// unlockCookieName is the name of the cookie which remembers that a
+// password protected entry was unlocked by the browser
+const unlockCookieName = "gus_unlock"
+
+// unlockSignature signs the entry ID and the expiration of an unlock cookie
+// with the private key. The password hash of the entry is part of the
+// signature, so changing the password invalidates all issued cookies.
+func unlockSignature(id string, entry *shared.Entry, expires int64) string {
+	mac := hmac.New(sha256.New, util.GetPrivateKey())
+	fmt.Fprintf(mac, "%s\n%d\n", id, expires)
+	mac.Write(entry.Password)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// setUnlockCookie sets a cookie scoped to the path of the entry, so that
+// subsequent visits of the same browser skip the password form
+func (h *Handler) setUnlockCookie(c *gin.Context, id string, entry *shared.Entry) {
+	if h.unlockLifetime <= 0 {
+		return
+	}
+	expires := time.Now().Add(h.unlockLifetime)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     unlockCookieName,
+		Value:    fmt.Sprintf("%d.%s", expires.Unix(), unlockSignature(id, entry, expires.Unix())),
+		Path:     c.Request.URL.EscapedPath(),
+		Expires:  expires,
+		MaxAge:   int(h.unlockLifetime.Seconds()),
+		Secure:   c.Request.TLS != nil || util.GetConfig().UseSSL,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// hasUnlockCookie checks if the request contains a valid and not
+// expired unlock cookie for the entry
+func (h *Handler) hasUnlockCookie(c *gin.Context, id string, entry *shared.Entry) bool {
+	if h.unlockLifetime <= 0 {
+		return false
+	}
+	cookie, err := c.Request.Cookie(unlockCookieName)
+	if err != nil {
+		return false
+	}
+	parts := strings.SplitN(cookie.Value, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(parts[1]), []byte(unlockSignature(id, entry, expires)))
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mxschmitt/golang-url-shortener/internal/handlers/auth"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+)
+
+// handleGetWebhooks returns the webhooks of the user
+func (h *Handler) handleGetWebhooks(c *gin.Context) {
+	user := c.MustGet("user").(*auth.JWTClaims)
+	webhooks, err := h.store.GetWebhooks(user.OAuthProvider, user.OAuthID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// handleCreateWebhook creates a webhook for the user, the response
+// contains the secret which is used to sign the payloads
+func (h *Handler) handleCreateWebhook(c *gin.Context) {
+	var data struct {
+		URL    string `binding:"required"`
+		Secret string
+		Events []string
+	}
+	if err := c.ShouldBind(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user := c.MustGet("user").(*auth.JWTClaims)
+	webhook, err := h.store.CreateWebhook(user.OAuthProvider, user.OAuthID, shared.Webhook{
+		URL:    data.URL,
+		Secret: data.Secret,
+		Events: data.Events,
+	})
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, webhook)
+	case stores.ErrNoValidWebhookURL, stores.ErrForbiddenWebhookURL, stores.ErrInvalidWebhookEvent:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// handleDeleteWebhook deletes a webhook of the user
+func (h *Handler) handleDeleteWebhook(c *gin.Context) {
+	user := c.MustGet("user").(*auth.JWTClaims)
+	err := h.store.DeleteWebhook(user.OAuthProvider, user.OAuthID, c.Param("id"))
+	if errors.Cause(err) == shared.ErrNoWebhookFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": shared.ErrNoWebhookFound.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// handleGetWebhookDeliveries returns the latest deliveries to the webhooks of the user
+func (h *Handler) handleGetWebhookDeliveries(c *gin.Context) {
+	user := c.MustGet("user").(*auth.JWTClaims)
+	deliveries, err := h.store.GetWebhookDeliveries(user.OAuthProvider, user.OAuthID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
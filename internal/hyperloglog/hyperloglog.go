@@ -0,0 +1,99 @@
+// Package hyperloglog implements a HyperLogLog sketch to approximately
+// count the distinct elements of a set, e.g. the unique visitors of an entry
+package hyperloglog
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+
+	"github.com/pkg/errors"
+)
+
+// precision is the number of bits which are used to select a register,
+// 2^12 registers result in a standard error of about 1.6%
+const precision = 12
+
+const registerCount = 1 << precision
+
+// ErrInvalidSketch is returned when a serialized sketch could not be decoded
+var ErrInvalidSketch = errors.New("the given sketch is not valid")
+
+// Sketch is a HyperLogLog sketch, the zero value is not usable
+type Sketch struct {
+	registers []uint8
+}
+
+// New returns an empty sketch
+func New() *Sketch {
+	return &Sketch{registers: make([]uint8, registerCount)}
+}
+
+// FromBytes decodes a sketch which was serialized via Bytes
+func FromBytes(raw []byte) (*Sketch, error) {
+	if len(raw) != registerCount {
+		return nil, ErrInvalidSketch
+	}
+	s := New()
+	copy(s.registers, raw)
+	return s, nil
+}
+
+// Bytes serializes the sketch
+func (s *Sketch) Bytes() []byte {
+	raw := make([]byte, registerCount)
+	copy(raw, s.registers)
+	return raw
+}
+
+// Add adds an element to the sketch and reports if the sketch changed
+func (s *Sketch) Add(element []byte) bool {
+	h := fnv.New64a()
+	h.Write(element)
+	x := mix(h.Sum64())
+	index := x >> (64 - precision)
+	rank := uint8(bits.LeadingZeros64(x<<precision|1<<(precision-1))) + 1
+	if rank > s.registers[index] {
+		s.registers[index] = rank
+		return true
+	}
+	return false
+}
+
+// Merge adds all elements of another sketch to the sketch
+func (s *Sketch) Merge(other *Sketch) {
+	for i, rank := range other.registers {
+		if rank > s.registers[i] {
+			s.registers[i] = rank
+		}
+	}
+}
+
+// Count returns the approximate number of distinct elements of the sketch
+func (s *Sketch) Count() int {
+	sum, zeros := 0.0, 0
+	for _, rank := range s.registers {
+		sum += 1 / float64(uint64(1)<<rank)
+		if rank == 0 {
+			zeros++
+		}
+	}
+	m := float64(registerCount)
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// linear counting is more accurate for small cardinalities
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(estimate + 0.5)
+}
+
+// mix is the finalizer of MurmurHash3, which spreads the bits of the
+// FNV hash over the whole 64 bits
+func mix(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
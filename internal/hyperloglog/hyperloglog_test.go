@@ -0,0 +1,56 @@
+package hyperloglog
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	tt := []struct {
+		name     string
+		elements int
+	}{
+		{"empty", 0},
+		{"one", 1},
+		{"hundred", 100},
+		{"ten thousand", 10000},
+		{"million", 1000000},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := New()
+			for i := 0; i < tc.elements; i++ {
+				s.Add([]byte(fmt.Sprintf("visitor-%d", i)))
+				// duplicates must not be counted
+				s.Add([]byte(fmt.Sprintf("visitor-%d", i)))
+			}
+			count := s.Count()
+			if math.Abs(float64(count-tc.elements)) > 0.05*float64(tc.elements)+1 {
+				t.Fatalf("count %d is too far from %d", count, tc.elements)
+			}
+		})
+	}
+}
+
+func TestMergeAndBytes(t *testing.T) {
+	a, b := New(), New()
+	for i := 0; i < 1000; i++ {
+		a.Add([]byte(fmt.Sprintf("a-%d", i)))
+		b.Add([]byte(fmt.Sprintf("b-%d", i)))
+	}
+	restored, err := FromBytes(a.Bytes())
+	if err != nil {
+		t.Fatalf("could not restore sketch: %v", err)
+	}
+	if restored.Count() != a.Count() {
+		t.Fatalf("restored count %d does not match %d", restored.Count(), a.Count())
+	}
+	restored.Merge(b)
+	if count := restored.Count(); count < 1900 || count > 2100 {
+		t.Fatalf("merged count %d is too far from 2000", count)
+	}
+	if _, err := FromBytes([]byte("foo")); err != ErrInvalidSketch {
+		t.Fatalf("unexpected error for invalid sketch: %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+// Package metadata fetches web pages and extracts their title, description,
+// canonical URL and favicon
+package metadata
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+)
+
+// Limits of the extracted texts and of the followed redirects
+const (
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+	maxRedirects         = 5
+)
+
+// ErrForbiddenAddress is returned when the target of a request resolves to
+// an address which must not be accessed, e.g. a private or loopback one
+var ErrForbiddenAddress = errors.New("the address of the page is not allowed")
+
+// ErrNoHTMLPage is returned when the page is not an HTML document
+var ErrNoHTMLPage = errors.New("the page is not an HTML document")
+
+// Fetcher fetches the metadata of web pages
+type Fetcher struct {
+	client  *http.Client
+	maxSize int64
+}
+
+// New returns a fetcher whose requests time out after the timeout and which
+// reads at most maxSize bytes of a page. Unless allowPrivate is set, pages on
+// private, loopback and link-local addresses are not fetched.
+func New(timeout time.Duration, maxSize int64, allowPrivate bool) *Fetcher {
+	return &Fetcher{
+		client:  NewClient(timeout, allowPrivate),
+		maxSize: maxSize,
+	}
+}
+
+// NewClient returns an HTTP client whose requests time out after the timeout.
+// Unless allowPrivate is set, it refuses to connect to private, loopback and
+// link-local addresses, also when following a redirect.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		// the address is checked after it was resolved, so that host
+		// names which resolve to private addresses are denied as well
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return errors.Wrap(err, "could not split host and port")
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return ErrForbiddenAddress
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// a proxy of the environment would bypass the check of the addresses
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.Errorf("redirect to unsupported scheme %s", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// CheckURL checks that the URL is an HTTP or HTTPS one and, unless
+// allowPrivate is set, that its host only resolves to public addresses.
+// Requests are checked again when they connect, as the host may resolve
+// differently by then.
+func CheckURL(ctx context.Context, rawURL string, allowPrivate bool) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.Wrap(err, "could not parse URL")
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.Errorf("unsupported URL %s", rawURL)
+	}
+	if allowPrivate {
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return errors.Wrap(err, "could not resolve host")
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// sharedAddressSpace is the range of carrier-grade NATs, which is not
+// reachable from the internet either
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP checks if the IP address is a public unicast one
+func publicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() &&
+		!ip.IsLinkLocalUnicast() && !sharedAddressSpace.Contains(ip)
+}
+
+// Fetch fetches the page and extracts its metadata, relative URLs are
+// resolved against the URL of the page after all redirects
+func (f *Fetcher) Fetch(ctx context.Context, pageURL string) (*shared.PageMetadata, error) {
+	req, err := http.NewRequest("GET", pageURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create request")
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, errors.Errorf("unsupported scheme %s", req.URL.Scheme)
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	req.Header.Set("User-Agent", "golang-url-shortener metadata fetcher")
+	resp, err := f.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not fetch page")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errors.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrNoHTMLPage
+	}
+	metadata := parse(io.LimitReader(resp.Body, f.maxSize), resp.Request.URL)
+	metadata.FetchedOn = time.Now()
+	return metadata, nil
+}
+
+// parse extracts the metadata of the head of an HTML document, the title
+// and the description of Open Graph are used if the document has none
+func parse(r io.Reader, base *url.URL) *shared.PageMetadata {
+	metadata := &shared.PageMetadata{}
+	var ogTitle, ogDescription string
+	tokenizer := html.NewTokenizer(r)
+	inTitle := false
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return finish(metadata, base, ogTitle, ogDescription)
+		case html.TextToken:
+			if inTitle && metadata.Title == "" {
+				metadata.Title = string(tokenizer.Text())
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				return finish(metadata, base, ogTitle, ogDescription)
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			attrs := map[string]string{}
+			for hasAttr {
+				var key, value []byte
+				key, value, hasAttr = tokenizer.TagAttr()
+				attrs[string(key)] = string(value)
+			}
+			switch string(name) {
+			case "title":
+				inTitle = true
+			case "body":
+				return finish(metadata, base, ogTitle, ogDescription)
+			case "meta":
+				key := attrs["property"]
+				if key == "" {
+					key = attrs["name"]
+				}
+				switch strings.ToLower(key) {
+				case "description":
+					metadata.Description = attrs["content"]
+				case "og:title":
+					ogTitle = attrs["content"]
+				case "og:description":
+					ogDescription = attrs["content"]
+				}
+			case "link":
+				for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+					switch {
+					case rel == "canonical" && metadata.CanonicalURL == "":
+						metadata.CanonicalURL = resolve(base, attrs["href"])
+					case rel == "icon" && metadata.FaviconURL == "":
+						metadata.FaviconURL = resolve(base, attrs["href"])
+					}
+				}
+			}
+		}
+	}
+}
+
+// finish applies the fallbacks and the limits to the extracted metadata
+func finish(metadata *shared.PageMetadata, base *url.URL, ogTitle, ogDescription string) *shared.PageMetadata {
+	if strings.TrimSpace(metadata.Title) == "" {
+		metadata.Title = ogTitle
+	}
+	if strings.TrimSpace(metadata.Description) == "" {
+		metadata.Description = ogDescription
+	}
+	metadata.Title = truncate(strings.Join(strings.Fields(metadata.Title), " "), maxTitleLength)
+	metadata.Description = truncate(strings.Join(strings.Fields(metadata.Description), " "), maxDescriptionLength)
+	if metadata.FaviconURL == "" {
+		metadata.FaviconURL = resolve(base, "/favicon.ico")
+	}
+	return metadata
+}
+
+// resolve resolves the reference against the base URL, only absolute HTTP
+// and HTTPS URLs are returned
+func resolve(base *url.URL, ref string) string {
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
+
+// truncate shortens the text to at most max runes
+func truncate(text string, max int) string {
+	if runes := []rune(text); len(runes) > max {
+		return string(runes[:max])
+	}
+	return text
+}
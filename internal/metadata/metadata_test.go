@@ -0,0 +1,132 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestParse(t *testing.T) {
+	base, _ := url.Parse("https://example.com/blog/post")
+	tt := []struct {
+		name         string
+		document     string
+		title        string
+		description  string
+		canonicalURL string
+		faviconURL   string
+	}{
+		{
+			name: "complete head",
+			document: `<html><head><title> My
+				Post </title><meta name="description" content="About things">
+				<link rel="canonical" href="/blog/post"><link rel="shortcut icon" href="icon.png"></head></html>`,
+			title:        "My Post",
+			description:  "About things",
+			canonicalURL: "https://example.com/blog/post",
+			faviconURL:   "https://example.com/blog/icon.png",
+		},
+		{
+			name:        "open graph fallback",
+			document:    `<head><meta property="og:title" content="OG Title"><meta property="og:description" content="OG Description"></head>`,
+			title:       "OG Title",
+			description: "OG Description",
+			faviconURL:  "https://example.com/favicon.ico",
+		},
+		{
+			name:       "body is ignored",
+			document:   `<head></head><body><title>Not the title</title></body>`,
+			faviconURL: "https://example.com/favicon.ico",
+		},
+		{
+			name:       "unsafe URLs are dropped",
+			document:   `<link rel="canonical" href="javascript:alert(1)"><link rel="icon" href="data:image/png;base64,AAAA">`,
+			faviconURL: "https://example.com/favicon.ico",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			metadata := parse(strings.NewReader(tc.document), base)
+			if metadata.Title != tc.title || metadata.Description != tc.description ||
+				metadata.CanonicalURL != tc.canonicalURL || metadata.FaviconURL != tc.faviconURL {
+				t.Fatalf("metadata is not the expected one: %+v", metadata)
+			}
+		})
+	}
+}
+
+func TestFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/page", http.StatusFound)
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprintf(w, "<title>%s</title>", strings.Repeat("a", 2*maxTitleLength))
+		case "/large":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, "<head>%s<title>Too late</title>", strings.Repeat(" ", 1024))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	fetcher := New(time.Second, 512, true)
+	metadata, err := fetcher.Fetch(context.Background(), server.URL+"/redirect")
+	if err != nil {
+		t.Fatalf("could not fetch page: %v", err)
+	}
+	if len(metadata.Title) != maxTitleLength || metadata.FaviconURL != server.URL+"/favicon.ico" || metadata.FetchedOn.IsZero() {
+		t.Fatalf("metadata is not the expected one: %+v", metadata)
+	}
+	if metadata, err = fetcher.Fetch(context.Background(), server.URL+"/large"); err != nil || metadata.Title != "" {
+		t.Fatalf("page was not limited: %+v, %v", metadata, err)
+	}
+	if _, err := fetcher.Fetch(context.Background(), server.URL+"/image"); err != ErrNoHTMLPage {
+		t.Fatalf("unexpected error for an image: %v", err)
+	}
+	if _, err := fetcher.Fetch(context.Background(), server.URL+"/missing"); err == nil {
+		t.Fatal("missing page was fetched")
+	}
+	if _, err := fetcher.Fetch(context.Background(), "ftp://example.com/"); err == nil {
+		t.Fatal("page with unsupported scheme was fetched")
+	}
+	guarded := New(time.Second, 512, false)
+	if _, err := guarded.Fetch(context.Background(), server.URL+"/page"); errors.Cause(err) == nil || !strings.Contains(err.Error(), ErrForbiddenAddress.Error()) {
+		t.Fatalf("unexpected error for a loopback address: %v", err)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tt := []struct {
+		name         string
+		url          string
+		allowPrivate bool
+		valid        bool
+	}{
+		{"public address", "https://93.184.216.34/hook", false, true},
+		{"loopback address", "http://127.0.0.1:8080/hook", false, false},
+		{"loopback host name", "http://localhost/hook", false, false},
+		{"link-local address", "http://169.254.169.254/latest/meta-data", false, false},
+		{"private address", "http://10.0.0.1/hook", false, false},
+		{"allowed private address", "http://10.0.0.1/hook", true, true},
+		{"unsupported scheme", "ftp://93.184.216.34/", true, false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckURL(context.Background(), tc.url, tc.allowPrivate)
+			if (err == nil) != tc.valid {
+				t.Fatalf("unexpected result for %s: %v", tc.url, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Package metrics provides the Prometheus metrics of the URL Shortener
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gus"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of handled HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of the handled HTTP requests by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// Redirects counts the visitors which were redirected to the target of an entry
+	Redirects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redirects_total",
+		Help:      "Number of redirects to the target URL of an entry.",
+	})
+	// ExpiredHits counts the requests of expired entries
+	ExpiredHits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "expired_hits_total",
+		Help:      "Number of requests of expired entries.",
+	})
+	// NotFoundHits counts the requests which neither matched an entry nor a file
+	NotFoundHits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "not_found_hits_total",
+		Help:      "Number of requests which neither matched an entry nor a file.",
+	})
+	// PasswordFailures counts the wrong passwords of protected entries
+	PasswordFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "password_failures_total",
+		Help:      "Number of wrong passwords entered for protected entries.",
+	})
+	// EntriesCreated counts the created entries
+	EntriesCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "entries_created_total",
+		Help:      "Number of created entries.",
+	})
+	// EntriesDeleted counts the deleted entries
+	EntriesDeleted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "entries_deleted_total",
+		Help:      "Number of deleted entries.",
+	})
+	// IDRetries counts the generated IDs which were already taken
+	IDRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "id_generation_retries_total",
+		Help:      "Number of retries because a randomly generated ID was already taken.",
+	})
+
+	storageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Latency of the storage operations by backend and method.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"backend", "method"})
+	storageErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_errors_total",
+		Help:      "Number of failed storage operations by backend and method.",
+	}, []string{"backend", "method"})
+)
+
+// ObserveStorage records the latency of a storage operation which
+// was started at the given time and whether it failed
+func ObserveStorage(backend, method string, start time.Time, failed bool) {
+	storageDuration.WithLabelValues(backend, method).Observe(time.Since(start).Seconds())
+	if failed {
+		storageErrors.WithLabelValues(backend, method).Inc()
+	}
+}
+
+// knownMethods are the request methods which are used as label, others are
+// sent by any client and would add a series for each of them
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true,
+	http.MethodPut: true, http.MethodPatch: true, http.MethodDelete: true,
+	http.MethodConnect: true, http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// methodLabel returns the label of a request method, unknown ones share
+// the 'OTHER' one
+func methodLabel(method string) string {
+	if knownMethods[method] {
+		return method
+	}
+	return "OTHER"
+}
+
+// Middleware returns a gin.HandlerFunc which records the count and the
+// latency of the requests. The requests are labeled by their route
+// instead of their path and by their known method to keep the number of
+// series bounded, the requests of the short URLs and the static files share
+// the 'NoRoute' one.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "NoRoute"
+		}
+		method := methodLabel(c.Request.Method)
+		httpRequests.WithLabelValues(route, method, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler returns the http.Handler which exposes the metrics. If a token
+// is given, it has to be sent as bearer token in the Authorization header.
+func Handler(token string) http.Handler {
+	handler := promhttp.Handler()
+	if token == "" {
+		return handler
+	}
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
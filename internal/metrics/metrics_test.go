@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	tt := []struct {
+		name          string
+		token         string
+		authorization string
+		statusCode    int
+	}{
+		{name: "no token configured", statusCode: http.StatusOK},
+		{name: "valid token", token: "secret", authorization: "Bearer secret", statusCode: http.StatusOK},
+		{name: "missing token", token: "secret", statusCode: http.StatusUnauthorized},
+		{name: "wrong token", token: "secret", authorization: "Bearer wrong", statusCode: http.StatusUnauthorized},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			rec := httptest.NewRecorder()
+			Handler(tc.token).ServeHTTP(rec, req)
+			if rec.Code != tc.statusCode {
+				t.Fatalf("expected status: %d; got: %d", tc.statusCode, rec.Code)
+			}
+		})
+	}
+}
+
+func TestMethodLabel(t *testing.T) {
+	for method, expected := range map[string]string{
+		"GET":      "GET",
+		"DELETE":   "DELETE",
+		"get":      "OTHER",
+		"PROPFIND": "OTHER",
+		"":         "OTHER",
+	} {
+		if label := methodLabel(method); label != expected {
+			t.Errorf("expected label of %q: %s; got: %s", method, expected, label)
+		}
+	}
+}
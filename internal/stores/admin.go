@@ -0,0 +1,81 @@
+package stores
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+)
+
+// EntryOwnerIdentity returns the identity of the user who created an entry,
+// or the identifier of the team which owns it
+func EntryOwnerIdentity(entry shared.Entry) string {
+	if entry.TeamID != "" {
+		return shared.TeamEntriesPrefix + entry.TeamID
+	}
+	return shared.Identity(entry.OAuthProvider, entry.OAuthID)
+}
+
+// UserLinkCount is the number of entries which are owned by a user or a team
+type UserLinkCount struct {
+	Owner string
+	Links int
+}
+
+// SearchEntries returns all entries whose ID, URL or owner contains the
+// query, case-insensitively. An empty query matches every entry.
+func (s *Store) SearchEntries(query string) (map[string]shared.Entry, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	entries := map[string]shared.Entry{}
+	err := s.storage.IterateEntries(func(id string, entry shared.Entry) error {
+		if query == "" ||
+			strings.Contains(strings.ToLower(id), query) ||
+			strings.Contains(strings.ToLower(entry.Public.URL), query) ||
+			strings.Contains(strings.ToLower(EntryOwnerIdentity(entry)), query) {
+			entries[id] = entry
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not iterate entries")
+	}
+	return entries, nil
+}
+
+// GetUserLinkCounts returns the owners of entries together with the number
+// of their entries, the owners with the most entries first
+func (s *Store) GetUserLinkCounts() ([]UserLinkCount, error) {
+	counts := map[string]int{}
+	err := s.storage.IterateEntries(func(id string, entry shared.Entry) error {
+		counts[EntryOwnerIdentity(entry)]++
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not iterate entries")
+	}
+	users := make([]UserLinkCount, 0, len(counts))
+	for owner, links := range counts {
+		users = append(users, UserLinkCount{Owner: owner, Links: links})
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Links != users[j].Links {
+			return users[i].Links > users[j].Links
+		}
+		return users[i].Owner < users[j].Owner
+	})
+	return users, nil
+}
+
+// SuspendEntry disables or enables the redirect of an entry
+func (s *Store) SuspendEntry(id string, suspended bool) error {
+	return s.storage.UpdateEntry(id, func(entry *shared.Entry) error {
+		entry.Public.Suspended = suspended
+		return nil
+	})
+}
+
+// AdminDeleteEntry deletes an entry without its deletion URL
+func (s *Store) AdminDeleteEntry(id string) error {
+	return s.deleteEntry(id)
+}
@@ -0,0 +1,76 @@
+package boltdb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+)
+
+// TransferEntry changes the owner of an entry with the given function and
+// moves it to the entries of the new owner. The entry, the index and the
+// audit event which fn returns are written in one transaction.
+func (b *BoltStore) TransferEntry(id, userIdentifier string, fn func(*shared.Entry) (*shared.AuditEvent, error)) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(shortedURLsBucket)
+		raw := bucket.Get([]byte(id))
+		if raw == nil {
+			return shared.ErrNoEntryFound
+		}
+		var entry shared.Entry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return errors.Wrap(err, "could not unmarshal entry")
+		}
+		event, err := fn(&entry)
+		if err != nil {
+			return err
+		}
+		if raw, err = json.Marshal(entry); err != nil {
+			return errors.Wrap(err, "could not marshal entry")
+		}
+		if err := bucket.Put([]byte(id), raw); err != nil {
+			return errors.Wrap(err, "could not put entry")
+		}
+		if err := tx.Bucket(shortedIDsToUserBucket).Put([]byte(id), []byte(userIdentifier)); err != nil {
+			return errors.Wrap(err, "could not put owner of entry")
+		}
+		return putAuditEvent(tx, *event)
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// putAuditEvent appends the event to the audit log, the keys are sequence
+// numbers so that the events are ordered by their insertion
+func putAuditEvent(tx *bolt.Tx, event shared.AuditEvent) error {
+	bucket := tx.Bucket(auditBucket)
+	seq, err := bucket.NextSequence()
+	if err != nil {
+		return errors.Wrap(err, "could not get next sequence")
+	}
+	raw, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal audit event")
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return bucket.Put(key, raw)
+}
+
+// GetAuditEvents returns the latest events of the audit log, the newest first
+func (b *BoltStore) GetAuditEvents(limit int) ([]shared.AuditEvent, error) {
+	events := []shared.AuditEvent{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(auditBucket).Cursor()
+		for k, v := cursor.Last(); k != nil && len(events) < limit; k, v = cursor.Prev() {
+			var event shared.AuditEvent
+			if err := json.Unmarshal(v, &event); err != nil {
+				return errors.Wrap(err, "could not unmarshal audit event")
+			}
+			events = append(events, event)
+		}
+		return nil
+	})
+	return events, errors.Wrap(err, "could not view db")
+}
@@ -2,22 +2,67 @@ package boltdb
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
+	"math"
 	"time"
 
 	"github.com/boltdb/bolt"
+	"github.com/mxschmitt/golang-url-shortener/internal/hyperloglog"
 	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 var (
 	shortedURLsBucket      = []byte("shorted")
 	shortedIDsToUserBucket = []byte("shorted2Users")
+	visitorsBucket         = []byte("visitors")
+	attemptsBucket         = []byte("attempts")
+	rollupsBucket          = []byte("rollups")
+	botsBucket             = []byte("bots")
+	uniquesBucket          = []byte("uniques")
+	markersBucket          = []byte("markers")
+	webhooksBucket         = []byte("webhooks")
+	deliveriesBucket       = []byte("deliveries")
+	deliveryQueueBucket    = []byte("deliveryQueue")
+	userDeliveriesBucket   = []byte("userDeliveries")
+	deliveriesByTimeBucket = []byte("deliveriesByTime")
+	teamsBucket            = []byte("teams")
+	userTeamsBucket        = []byte("userTeams")
+	auditBucket            = []byte("audit")
+	searchIndexBucket      = []byte("searchIndex")
+	searchTermsBucket      = []byte("searchTerms")
+	apiTokensBucket        = []byte("apiTokens")
+	userAPITokensBucket    = []byte("userAPITokens")
+	sessionsBucket         = []byte("sessions")
+	userSessionsBucket     = []byte("userSessions")
 )
 
+// internalBuckets are the top-level buckets of the store, the
+// buckets of the entries are nested in them
+var internalBuckets = [][]byte{shortedURLsBucket, shortedIDsToUserBucket, visitorsBucket, attemptsBucket,
+	rollupsBucket, botsBucket, uniquesBucket, markersBucket, webhooksBucket, deliveriesBucket,
+	deliveryQueueBucket, userDeliveriesBucket, deliveriesByTimeBucket, teamsBucket, userTeamsBucket, auditBucket, searchIndexBucket,
+	searchTermsBucket, apiTokensBucket, userAPITokensBucket, sessionsBucket, userSessionsBucket}
+
+// visitorsLayoutMarker is set once the visitors of the entries are
+// moved into the visitors bucket
+var visitorsLayoutMarker = []byte("visitorsLayout:v2")
+
+// visitorKeysMarker is set once the visitors are keyed by
+// the time of the visit instead of only the visit ID
+var visitorKeysMarker = []byte("visitorKeys:v2")
+
+// janitorInterval is the interval in which expired markers are deleted
+const janitorInterval = time.Minute
+
 // BoltStore implements the stores.Storage interface
 type BoltStore struct {
-	db *bolt.DB
+	db          *bolt.DB
+	broker      *shared.Broker
+	stopJanitor chan struct{}
+	janitorDone chan struct{}
 }
 
 // New returns a bolt store which implements the stores.Storage interface
@@ -33,21 +78,268 @@ func New(path string) (*BoltStore, error) {
 		if _, err := tx.CreateBucketIfNotExists(shortedIDsToUserBucket); err != nil {
 			return errors.Wrapf(err, "could not create %s bucket", shortedIDsToUserBucket)
 		}
-		return err
+		// the visitors are migrated before any other bucket is created,
+		// since an entry might have the name of one of them
+		if err := migrateVisitors(tx); err != nil {
+			return errors.Wrap(err, "could not migrate visitors")
+		}
+		if err := migrateVisitorKeys(tx); err != nil {
+			return errors.Wrap(err, "could not migrate visitor keys")
+		}
+		if err := migrateDeliveryIndexes(tx); err != nil {
+			return errors.Wrap(err, "could not migrate delivery indexes")
+		}
+		for _, name := range internalBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return errors.Wrapf(err, "could not create %s bucket", name)
+			}
+		}
+		return nil
 	})
 	if err != nil {
 		return nil, errors.Wrap(err, "could not create buckets")
 	}
-	return &BoltStore{
-		db: db,
-	}, nil
+	b := &BoltStore{
+		db:          db,
+		broker:      shared.NewBroker(),
+		stopJanitor: make(chan struct{}),
+		janitorDone: make(chan struct{}),
+	}
+	go b.janitor()
+	return b, nil
 }
 
-// Close closes the bolt database
+// migrateVisitors moves the visitor buckets of the entries, which were
+// top-level buckets named by the entry ID, into the visitors bucket. It runs
+// once, afterwards every top-level bucket is one of the store. Before, the
+// store only had the entries buckets, every other top-level bucket of an
+// entry contains its visitors even if it has the name of a newer bucket.
+func migrateVisitors(tx *bolt.Tx) error {
+	if markers := tx.Bucket(markersBucket); markers != nil {
+		if raw := markers.Get(visitorsLayoutMarker); raw != nil && !markerExpired(raw, time.Now()) {
+			return nil
+		}
+	}
+	entries := tx.Bucket(shortedURLsBucket)
+	internal := map[string]bool{string(shortedURLsBucket): true, string(shortedIDsToUserBucket): true}
+	var ids [][]byte
+	err := tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+		if entries.Get(name) == nil {
+			return nil
+		}
+		// the visitors bucket of an entry named like it contains visitors
+		// instead of nested buckets, it is moved first so that it is not
+		// used as the parent of the others
+		if bytes.Equal(name, visitorsBucket) {
+			if k, v := bucket.Cursor().First(); k != nil && v != nil {
+				ids = append([][]byte{append([]byte(nil), name...)}, ids...)
+			}
+			return nil
+		}
+		if !internal[string(name)] {
+			ids = append(ids, append([]byte(nil), name...))
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "could not list buckets")
+	}
+	for _, id := range ids {
+		visitors := map[string][]byte{}
+		err := tx.Bucket(id).ForEach(func(k, v []byte) error {
+			visitors[string(k)] = append([]byte(nil), v...)
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "could not read visitors of %s", id)
+		}
+		if err := tx.DeleteBucket(id); err != nil {
+			return errors.Wrapf(err, "could not delete old visitors bucket of %s", id)
+		}
+		parent, err := tx.CreateBucketIfNotExists(visitorsBucket)
+		if err != nil {
+			return errors.Wrap(err, "could not create visitors bucket")
+		}
+		bucket, err := parent.CreateBucketIfNotExists(id)
+		if err != nil {
+			return errors.Wrapf(err, "could not create visitors bucket of %s", id)
+		}
+		for k, v := range visitors {
+			if err := bucket.Put([]byte(k), v); err != nil {
+				return errors.Wrapf(err, "could not move visitor of %s", id)
+			}
+		}
+	}
+	if len(ids) > 0 {
+		logrus.Infof("Moved the visitors of %d entries into the %s bucket", len(ids), visitorsBucket)
+	}
+	// a bucket named like the markers one was moved as the visitors of an entry
+	markers, err := tx.CreateBucketIfNotExists(markersBucket)
+	if err != nil {
+		return errors.Wrapf(err, "could not create %s bucket", markersBucket)
+	}
+	raw := make([]byte, 8)
+	binary.BigEndian.PutUint64(raw, uint64(math.MaxInt64))
+	return markers.Put(visitorsLayoutMarker, raw)
+}
+
+// migrateVisitorKeys prefixes the keys of the visitors and the bot visitors,
+// which were only the visit IDs, once with the time of the visit
+func migrateVisitorKeys(tx *bolt.Tx) error {
+	markers := tx.Bucket(markersBucket)
+	if raw := markers.Get(visitorKeysMarker); raw != nil && !markerExpired(raw, time.Now()) {
+		return nil
+	}
+	migrated := 0
+	for _, name := range [][]byte{visitorsBucket, botsBucket} {
+		parent, err := tx.CreateBucketIfNotExists(name)
+		if err != nil {
+			return errors.Wrapf(err, "could not create %s bucket", name)
+		}
+		var ids [][]byte
+		err = parent.ForEach(func(k, v []byte) error {
+			if v == nil {
+				ids = append(ids, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "could not list %s buckets", name)
+		}
+		for _, id := range ids {
+			bucket := parent.Bucket(id)
+			visitors := map[string][]byte{}
+			err := bucket.ForEach(func(k, v []byte) error {
+				visitors[string(k)] = append([]byte(nil), v...)
+				return nil
+			})
+			if err != nil {
+				return errors.Wrapf(err, "could not read visitors of %s", id)
+			}
+			for k, v := range visitors {
+				var visitor shared.Visitor
+				if err := json.Unmarshal(v, &visitor); err != nil {
+					return errors.Wrap(err, "could not unmarshal json")
+				}
+				if err := bucket.Delete([]byte(k)); err != nil {
+					return errors.Wrapf(err, "could not delete visitor of %s", id)
+				}
+				if err := bucket.Put(timeKey(visitor.Timestamp, k), v); err != nil {
+					return errors.Wrapf(err, "could not put visitor of %s", id)
+				}
+			}
+			migrated += len(visitors)
+		}
+	}
+	if migrated > 0 {
+		logrus.Infof("Keyed %d visitors by the time of their visit", migrated)
+	}
+	raw := make([]byte, 8)
+	binary.BigEndian.PutUint64(raw, uint64(math.MaxInt64))
+	return markers.Put(visitorKeysMarker, raw)
+}
+
+// Close stops the janitor and the broker and closes the bolt database
 func (b *BoltStore) Close() error {
+	close(b.stopJanitor)
+	<-b.janitorDone
+	b.broker.Close()
 	return b.db.Close()
 }
 
+// PublishVisit sends a visit event to all subscribers, bolt can only be
+// used by a single process so the in-process broker is sufficient
+func (b *BoltStore) PublishVisit(event shared.VisitEvent) error {
+	b.broker.Publish(event)
+	return nil
+}
+
+// SubscribeVisits returns a channel which receives all visit events
+// and a function which has to be called to unsubscribe
+func (b *BoltStore) SubscribeVisits() (<-chan shared.VisitEvent, func()) {
+	return b.broker.Subscribe()
+}
+
+// janitor periodically deletes the expired markers and attempts, the old
+// webhook deliveries and the expired sessions, since bolt has no TTLs
+func (b *BoltStore) janitor() {
+	defer close(b.janitorDone)
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.deleteExpiredMarkers(time.Now()); err != nil {
+				logrus.Warnf("could not delete expired markers: %v", err)
+			}
+			if err := b.deleteExpiredAttempts(time.Now()); err != nil {
+				logrus.Warnf("could not delete expired attempts: %v", err)
+			}
+			if err := b.deleteOldDeliveries(time.Now()); err != nil {
+				logrus.Warnf("could not delete old deliveries: %v", err)
+			}
+			if err := b.deleteExpiredSessions(time.Now()); err != nil {
+				logrus.Warnf("could not delete expired sessions: %v", err)
+			}
+		case <-b.stopJanitor:
+			return
+		}
+	}
+}
+
+// deleteExpiredMarkers deletes all markers which are expired at the given time
+func (b *BoltStore) deleteExpiredMarkers(now time.Time) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(markersBucket)
+		var keys [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			if markerExpired(v, now) {
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return errors.Wrap(err, "could not delete marker")
+			}
+		}
+		return nil
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// markerExpired checks if the big endian encoded expiration
+// of a marker is before the given time
+func markerExpired(raw []byte, now time.Time) bool {
+	return len(raw) != 8 || int64(binary.BigEndian.Uint64(raw)) < now.UnixNano()
+}
+
+// SetIfAbsent sets a marker with the given TTL if it is not set yet
+// or already expired and reports if the marker was set. Markers without
+// a TTL never expire.
+func (b *BoltStore) SetIfAbsent(key string, ttl time.Duration) (bool, error) {
+	set := false
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(markersBucket)
+		now := time.Now()
+		if raw := bucket.Get([]byte(key)); raw != nil && !markerExpired(raw, now) {
+			return nil
+		}
+		expiration := uint64(math.MaxInt64)
+		if ttl > 0 {
+			expiration = uint64(now.Add(ttl).UnixNano())
+		}
+		raw := make([]byte, 8)
+		binary.BigEndian.PutUint64(raw, expiration)
+		set = true
+		return bucket.Put([]byte(key), raw)
+	})
+	return set, errors.Wrap(err, "could not update db")
+}
+
 // GetEntryByID returns a entry and an error by the shorted ID
 func (b *BoltStore) GetEntryByID(id string) (*shared.Entry, error) {
 	var raw []byte
@@ -65,24 +357,52 @@ func (b *BoltStore) GetEntryByID(id string) (*shared.Entry, error) {
 	return entry, json.Unmarshal(raw, &entry)
 }
 
+// UpdateEntry changes an entry with the given function in one transaction
+func (b *BoltStore) UpdateEntry(id string, fn func(*shared.Entry) error) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(shortedURLsBucket)
+		raw := bucket.Get([]byte(id))
+		if raw == nil {
+			return shared.ErrNoEntryFound
+		}
+		var entry shared.Entry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return errors.Wrap(err, "could not unmarshal entry")
+		}
+		if err := fn(&entry); err != nil {
+			return err
+		}
+		raw, err := json.Marshal(entry)
+		if err != nil {
+			return errors.Wrap(err, "could not marshal entry")
+		}
+		return bucket.Put([]byte(id), raw)
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// IterateEntries calls fn for every entry, ordered by their IDs
+func (b *BoltStore) IterateEntries(fn func(string, shared.Entry) error) error {
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(shortedURLsBucket).ForEach(func(k, v []byte) error {
+			var entry shared.Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return errors.Wrap(err, "could not unmarshal entry")
+			}
+			return fn(string(k), entry)
+		})
+	})
+	return errors.Wrap(err, "could not view db")
+}
+
 // IncreaseVisitCounter increases the visit counter and sets the current
-// time as the last visit ones
+// time as the last visit ones, in one transaction so that concurrent
+// changes of the entry are not lost
 func (b *BoltStore) IncreaseVisitCounter(id string) error {
-	entry, err := b.GetEntryByID(id)
-	if err != nil {
-		return errors.Wrap(err, "could not get entry by ID")
-	}
-	entry.Public.VisitCount++
-	currentTime := time.Now()
-	entry.Public.LastVisit = &currentTime
-	raw, err := json.Marshal(entry)
-	if err != nil {
-		return errors.Wrap(err, "could not marshal json")
-	}
-	err = b.db.Update(func(tx *bolt.Tx) error {
-		if err := tx.Bucket(shortedURLsBucket).Put([]byte(id), raw); err != nil {
-			return errors.Wrap(err, "could not put updated visitor")
-		}
+	err := b.UpdateEntry(id, func(entry *shared.Entry) error {
+		entry.Public.VisitCount++
+		currentTime := time.Now()
+		entry.Public.LastVisit = &currentTime
 		return nil
 	})
 	return errors.Wrap(err, "could not update entry")
@@ -121,8 +441,17 @@ func (b *BoltStore) DeleteEntry(id string) error {
 		if err := bucket.Delete([]byte(id)); err != nil {
 			return errors.Wrap(err, "could not delete entry")
 		}
-		if err := tx.DeleteBucket([]byte(id)); err != nil && err != bolt.ErrBucketNotFound && err != bolt.ErrBucketExists {
-			return errors.Wrap(err, "could not delte bucket")
+		if err := tx.Bucket(visitorsBucket).DeleteBucket([]byte(id)); err != nil && err != bolt.ErrBucketNotFound {
+			return errors.Wrap(err, "could not delete visitors bucket")
+		}
+		if err := tx.Bucket(rollupsBucket).DeleteBucket([]byte(id)); err != nil && err != bolt.ErrBucketNotFound {
+			return errors.Wrap(err, "could not delete rollups bucket")
+		}
+		if err := tx.Bucket(botsBucket).DeleteBucket([]byte(id)); err != nil && err != bolt.ErrBucketNotFound {
+			return errors.Wrap(err, "could not delete bots bucket")
+		}
+		if err := tx.Bucket(uniquesBucket).DeleteBucket([]byte(id)); err != nil && err != bolt.ErrBucketNotFound {
+			return errors.Wrap(err, "could not delete uniques bucket")
 		}
 		uTsIDsBucket := tx.Bucket(shortedIDsToUserBucket)
 		return uTsIDsBucket.ForEach(func(k, v []byte) error {
@@ -138,10 +467,10 @@ func (b *BoltStore) DeleteEntry(id string) error {
 // GetVisitors returns the visitors and an error of an entry
 func (b *BoltStore) GetVisitors(id string) ([]shared.Visitor, error) {
 	output := []shared.Visitor{}
-	return output, b.db.Update(func(tx *bolt.Tx) error {
-		bucket, err := tx.CreateBucketIfNotExists([]byte(id))
-		if err != nil {
-			return errors.Wrap(err, "could not create bucket")
+	return output, b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(visitorsBucket).Bucket([]byte(id))
+		if bucket == nil {
+			return nil
 		}
 		return bucket.ForEach(func(k, v []byte) error {
 			var value shared.Visitor
@@ -154,6 +483,54 @@ func (b *BoltStore) GetVisitors(id string) ([]shared.Visitor, error) {
 	})
 }
 
+// visitorsBatchSize is the amount of visitors which are read in one
+// transaction when iterating over the visitors of an entry
+const visitorsBatchSize = 1000
+
+// IterateVisitors calls fn for every visitor of an entry in the order of
+// their visits, oldest first, without loading all of them into memory. They
+// are read in batches, each in its own short read transaction, so that fn
+// is never called within a transaction.
+func (b *BoltStore) IterateVisitors(id string, fn func(shared.Visitor) error) error {
+	var after []byte
+	for {
+		batch := make([]shared.Visitor, 0, visitorsBatchSize)
+		err := b.db.View(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket(visitorsBucket).Bucket([]byte(id))
+			if bucket == nil {
+				return nil
+			}
+			c := bucket.Cursor()
+			k, v := c.First()
+			if after != nil {
+				if k, v = c.Seek(after); k != nil && bytes.Equal(k, after) {
+					k, v = c.Next()
+				}
+			}
+			for ; k != nil && len(batch) < visitorsBatchSize; k, v = c.Next() {
+				var value shared.Visitor
+				if err := json.Unmarshal(v, &value); err != nil {
+					return errors.Wrap(err, "could not unmarshal json")
+				}
+				batch = append(batch, value)
+				after = append(after[:0], k...)
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrap(err, "could not view db")
+		}
+		for _, visitor := range batch {
+			if err := fn(visitor); err != nil {
+				return err
+			}
+		}
+		if len(batch) < visitorsBatchSize {
+			return nil
+		}
+	}
+}
+
 // GetUserEntries returns all user entries of an given user identifier
 func (b *BoltStore) GetUserEntries(userIdentifier string) (map[string]shared.Entry, error) {
 	entries := map[string]shared.Entry{}
@@ -176,18 +553,330 @@ func (b *BoltStore) GetUserEntries(userIdentifier string) (map[string]shared.Ent
 	return entries, errors.Wrap(err, "could not update db")
 }
 
-// RegisterVisitor saves the visitor in the database
+// RegisterVisitor saves the visitor in the database and increases the
+// rollup counters of the entry. The visitors are keyed by the time of the
+// visit, so that they are ordered by it.
 func (b *BoltStore) RegisterVisitor(id, visitID string, visitor shared.Visitor) error {
 	err := b.db.Update(func(tx *bolt.Tx) error {
-		bucket, err := tx.CreateBucketIfNotExists([]byte(id))
+		bucket, err := tx.Bucket(visitorsBucket).CreateBucketIfNotExists([]byte(id))
 		if err != nil {
-			return errors.Wrap(err, "could not create bucket")
+			return errors.Wrap(err, "could not create visitors bucket")
 		}
 		data, err := json.Marshal(visitor)
 		if err != nil {
 			return errors.Wrap(err, "could not create json")
 		}
-		return bucket.Put([]byte(visitID), data)
+		if err := bucket.Put(timeKey(visitor.Timestamp, visitID), data); err != nil {
+			return errors.Wrap(err, "could not put visitor")
+		}
+		rollups, err := tx.Bucket(rollupsBucket).CreateBucketIfNotExists([]byte(id))
+		if err != nil {
+			return errors.Wrap(err, "could not create rollups bucket")
+		}
+		for _, counter := range shared.RollupCounters(visitor) {
+			if err := increaseCounter(rollups, []byte(counter)); err != nil {
+				return errors.Wrapf(err, "could not increase counter %s", counter)
+			}
+		}
+		return nil
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// increaseCounter increases a big endian encoded uint64 counter by one
+func increaseCounter(bucket *bolt.Bucket, key []byte) error {
+	return addToCounter(bucket, key, 1)
+}
+
+// addToCounter adds the delta to a big endian encoded uint64 counter
+func addToCounter(bucket *bolt.Bucket, key []byte, delta uint64) error {
+	var count uint64
+	if raw := bucket.Get(key); len(raw) == 8 {
+		count = binary.BigEndian.Uint64(raw)
+	}
+	raw := make([]byte, 8)
+	binary.BigEndian.PutUint64(raw, count+delta)
+	return bucket.Put(key, raw)
+}
+
+// AddRollups adds the given counts to the rollup counters of an entry
+func (b *BoltStore) AddRollups(id string, counters map[string]int) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		rollups, err := tx.Bucket(rollupsBucket).CreateBucketIfNotExists([]byte(id))
+		if err != nil {
+			return errors.Wrap(err, "could not create rollups bucket")
+		}
+		for counter, count := range counters {
+			if err := addToCounter(rollups, []byte(counter), uint64(count)); err != nil {
+				return errors.Wrapf(err, "could not add to counter %s", counter)
+			}
+		}
+		return nil
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// GetRollups returns the rollup counters of an entry
+func (b *BoltStore) GetRollups(id string) (map[string]int, error) {
+	rollups := map[string]int{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(rollupsBucket).Bucket([]byte(id))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			if len(v) == 8 {
+				rollups[string(k)] = int(binary.BigEndian.Uint64(v))
+			}
+			return nil
+		})
+	})
+	return rollups, errors.Wrap(err, "could not view db")
+}
+
+// PruneVisitors deletes all visitors and bot visitors which visited before
+// the given time, their history is still available via the rollup counters.
+// Since the visitors are keyed by the time of the visit, only the pruned
+// ones are read. They are deleted per entry in batches, each in
+// its own write transaction, so that other writes are not blocked for long.
+func (b *BoltStore) PruneVisitors(before time.Time) (int, error) {
+	var ids [][]byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(shortedURLsBucket).ForEach(func(id, _ []byte) error {
+			ids = append(ids, append([]byte(nil), id...))
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "could not view db")
+	}
+	pruned := 0
+	for _, id := range ids {
+		for _, parent := range [][]byte{visitorsBucket, botsBucket} {
+			for {
+				count, err := b.pruneBatch(parent, id, before)
+				pruned += count
+				if err != nil {
+					return pruned, err
+				}
+				if count < visitorsBatchSize {
+					break
+				}
+			}
+		}
+	}
+	return pruned, nil
+}
+
+// pruneBatch deletes up to visitorsBatchSize of the oldest visitors of an
+// entry which visited before the given time
+func (b *BoltStore) pruneBatch(parent, id []byte, before time.Time) (int, error) {
+	pruned := 0
+	end := timeKey(before, "")
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(parent).Bucket(id)
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, end) < 0 && pruned < visitorsBatchSize; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return errors.Wrap(err, "could not delete visitor")
+			}
+			pruned++
+		}
+		return nil
+	})
+	return pruned, errors.Wrap(err, "could not update db")
+}
+
+// RegisterBotVisitor saves a visit of a bot separately from the other
+// visitors and increases the bot visit counter of the entry
+func (b *BoltStore) RegisterBotVisitor(id, visitID string, visitor shared.Visitor) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		entries := tx.Bucket(shortedURLsBucket)
+		raw := entries.Get([]byte(id))
+		if raw == nil {
+			return shared.ErrNoEntryFound
+		}
+		var entry shared.Entry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return errors.Wrap(err, "could not unmarshal entry")
+		}
+		entry.Public.BotVisitCount++
+		raw, err := json.Marshal(entry)
+		if err != nil {
+			return errors.Wrap(err, "could not marshal entry")
+		}
+		if err := entries.Put([]byte(id), raw); err != nil {
+			return errors.Wrap(err, "could not put updated entry")
+		}
+		bucket, err := tx.Bucket(botsBucket).CreateBucketIfNotExists([]byte(id))
+		if err != nil {
+			return errors.Wrap(err, "could not create bots bucket")
+		}
+		data, err := json.Marshal(visitor)
+		if err != nil {
+			return errors.Wrap(err, "could not create json")
+		}
+		return bucket.Put(timeKey(visitor.Timestamp, visitID), data)
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// AddUniqueVisitor adds the fingerprint of a visitor to the unique
+// visitors sketch of an entry for the given day
+func (b *BoltStore) AddUniqueVisitor(id string, day time.Time, fingerprint []byte) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(uniquesBucket).CreateBucketIfNotExists([]byte(id))
+		if err != nil {
+			return errors.Wrap(err, "could not create uniques bucket")
+		}
+		key := []byte(shared.UniquesDay(day))
+		sketch := hyperloglog.New()
+		if raw := bucket.Get(key); raw != nil {
+			if sketch, err = hyperloglog.FromBytes(raw); err != nil {
+				return errors.Wrap(err, "could not decode sketch")
+			}
+		}
+		if !sketch.Add(fingerprint) {
+			return nil
+		}
+		return bucket.Put(key, sketch.Bytes())
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// CountUniqueVisitors returns the approximate number of unique
+// visitors of an entry over the given days
+func (b *BoltStore) CountUniqueVisitors(id string, days []time.Time) (int, error) {
+	sketch := hyperloglog.New()
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(uniquesBucket).Bucket([]byte(id))
+		if bucket == nil {
+			return nil
+		}
+		for _, day := range days {
+			raw := bucket.Get([]byte(shared.UniquesDay(day)))
+			if raw == nil {
+				continue
+			}
+			other, err := hyperloglog.FromBytes(raw)
+			if err != nil {
+				return errors.Wrap(err, "could not decode sketch")
+			}
+			sketch.Merge(other)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "could not view db")
+	}
+	return sketch.Count(), nil
+}
+
+// GetBotVisitors returns all the visits of bots of an entry
+func (b *BoltStore) GetBotVisitors(id string) ([]shared.Visitor, error) {
+	output := []shared.Visitor{}
+	return output, b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(botsBucket).Bucket([]byte(id))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var value shared.Visitor
+			if err := json.Unmarshal(v, &value); err != nil {
+				return errors.Wrap(err, "could not unmarshal json")
+			}
+			output = append(output, value)
+			return nil
+		})
+	})
+}
+
+// storedAttempts is the representation of shared.Attempts in the
+// attempts bucket, bolt has no TTLs so the expiration is stored as well
+type storedAttempts struct {
+	shared.Attempts
+	Expiration time.Time
+}
+
+// getAttempts returns the not yet expired attempts of a key from the bucket
+func getAttempts(bucket *bolt.Bucket, key string) (*storedAttempts, error) {
+	stored := &storedAttempts{}
+	raw := bucket.Get([]byte(key))
+	if raw == nil {
+		return stored, nil
+	}
+	if err := json.Unmarshal(raw, stored); err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal json")
+	}
+	if time.Now().After(stored.Expiration) {
+		return &storedAttempts{}, nil
+	}
+	return stored, nil
+}
+
+// ReserveAttempt registers an attempt of a given throttling key if allow
+// permits it for the previous attempts, in one transaction so that concurrent
+// attempts can't pass the check together. The attempts of the key are
+// forgotten after the expiration.
+func (b *BoltStore) ReserveAttempt(key string, expiration time.Duration, allow func(*shared.Attempts) bool) (bool, error) {
+	reserved := false
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(attemptsBucket)
+		attempts, err := getAttempts(bucket, key)
+		if err != nil {
+			return errors.Wrap(err, "could not get attempts")
+		}
+		if !allow(&attempts.Attempts) {
+			return nil
+		}
+		attempts.Count++
+		attempts.LastAttempt = time.Now()
+		attempts.Expiration = attempts.LastAttempt.Add(expiration)
+		raw, err := json.Marshal(attempts)
+		if err != nil {
+			return errors.Wrap(err, "could not marshal json")
+		}
+		reserved = true
+		return bucket.Put([]byte(key), raw)
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "could not update db")
+	}
+	return reserved, nil
+}
+
+// deleteExpiredAttempts deletes all attempts which are expired at the given time
+func (b *BoltStore) deleteExpiredAttempts(now time.Time) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(attemptsBucket)
+		var keys [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var stored storedAttempts
+			if err := json.Unmarshal(v, &stored); err != nil || now.After(stored.Expiration) {
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return errors.Wrap(err, "could not delete attempts")
+			}
+		}
+		return nil
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// ResetAttempts forgets the failed attempts of a given throttling key
+func (b *BoltStore) ResetAttempts(key string) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(attemptsBucket).Delete([]byte(key))
 	})
 	return errors.Wrap(err, "could not update db")
 }
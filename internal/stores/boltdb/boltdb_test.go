@@ -0,0 +1,235 @@
+package boltdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+)
+
+func newTestStore(t *testing.T, setup func(*bolt.Tx) error) *BoltStore {
+	dir, err := ioutil.TempDir("", "boltdb")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "main.db")
+	if setup != nil {
+		db, err := bolt.Open(path, 0644, nil)
+		if err != nil {
+			t.Fatalf("could not open database: %v", err)
+		}
+		if err := db.Update(setup); err != nil {
+			t.Fatalf("could not set up database: %v", err)
+		}
+		db.Close()
+	}
+	store, err := New(path)
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestEntriesNamedLikeBuckets(t *testing.T) {
+	store := newTestStore(t, nil)
+	session := shared.Session{ID: "session", OAuthProvider: "google", OAuthID: "12345678", ExpiresOn: time.Now().Add(time.Hour)}
+	if err := store.CreateSession("google12345678", session); err != nil {
+		t.Fatalf("could not create session: %v", err)
+	}
+	for _, id := range []string{"sessions", "visitors", "shorted"} {
+		if err := store.CreateEntry(shared.Entry{}, id, "google12345678"); err != nil {
+			t.Fatalf("could not create entry %s: %v", id, err)
+		}
+		if err := store.RegisterVisitor(id, "visit", shared.Visitor{IP: "203.0.113.6"}); err != nil {
+			t.Fatalf("could not register visitor of %s: %v", id, err)
+		}
+		if visitors, err := store.GetVisitors(id); err != nil || len(visitors) != 1 {
+			t.Fatalf("visitors of %s are not the expected ones: %+v, %v", id, visitors, err)
+		}
+		if err := store.DeleteEntry(id); err != nil {
+			t.Fatalf("could not delete entry %s: %v", id, err)
+		}
+	}
+	if _, err := store.GetSession(session.ID); err != nil {
+		t.Fatalf("session was deleted with an entry: %v", err)
+	}
+}
+
+func TestMigrateVisitors(t *testing.T) {
+	visitor, _ := json.Marshal(shared.Visitor{IP: "203.0.113.6"})
+	dir, err := ioutil.TempDir("", "boltdb")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "main.db")
+	db, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		t.Fatalf("could not open database: %v", err)
+	}
+	// the entries of the previous layout are named like buckets which
+	// did not exist yet
+	ids := []string{"visitors", "abcd", "rollups", "markers"}
+	err = db.Update(func(tx *bolt.Tx) error {
+		entries, err := tx.CreateBucket(shortedURLsBucket)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := entries.Put([]byte(id), []byte("{}")); err != nil {
+				return err
+			}
+			bucket, err := tx.CreateBucket([]byte(id))
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte("visit"), visitor); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	db.Close()
+	if err != nil {
+		t.Fatalf("could not set up database: %v", err)
+	}
+	// the second time the internal buckets must not be moved again
+	for i := 0; i < 2; i++ {
+		store, err := New(path)
+		if err != nil {
+			t.Fatalf("could not create store: %v", err)
+		}
+		if _, err := store.SetIfAbsent("test", 0); err != nil {
+			t.Fatalf("could not set marker: %v", err)
+		}
+		for _, id := range ids {
+			if visitors, err := store.GetVisitors(id); err != nil || len(visitors) != 1 || visitors[0].IP != "203.0.113.6" {
+				t.Errorf("visitors of %s were not migrated: %+v, %v", id, visitors, err)
+			}
+		}
+		err = store.db.View(func(tx *bolt.Tx) error {
+			if tx.Bucket([]byte("abcd")) != nil {
+				t.Error("old visitors bucket was not deleted")
+			}
+			if tx.Bucket(rollupsBucket).Get([]byte("visit")) != nil {
+				t.Error("old visitors bucket is used as rollups bucket")
+			}
+			if tx.Bucket(markersBucket).Get([]byte("test")) == nil {
+				t.Error("markers bucket was moved")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("could not view db: %v", err)
+		}
+		store.Close()
+	}
+}
+
+func TestDeliveryIndexes(t *testing.T) {
+	now := time.Now()
+	old := shared.WebhookDelivery{ID: "old", UserIdentifier: "google12345678", Status: shared.DeliveryDelivered,
+		CreatedOn: now.Add(-10 * 24 * time.Hour), UpdatedOn: now.Add(-9 * 24 * time.Hour)}
+	raw, _ := json.Marshal(old)
+	store := newTestStore(t, func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucket(deliveriesBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(old.ID), raw)
+	})
+	for i, delivery := range []shared.WebhookDelivery{
+		{ID: "pending", UserIdentifier: "google12345678", Status: shared.DeliveryPending, CreatedOn: now.Add(-8 * 24 * time.Hour)},
+		{ID: "new", UserIdentifier: "google12345678", Status: shared.DeliveryDelivered, CreatedOn: now, UpdatedOn: now},
+		{ID: "other", UserIdentifier: "github1", Status: shared.DeliveryDelivered, CreatedOn: now, UpdatedOn: now},
+		{ID: "global", Status: shared.DeliveryDelivered, CreatedOn: now, UpdatedOn: now},
+	} {
+		if err := store.SaveDelivery(delivery); err != nil {
+			t.Fatalf("could not save delivery %d: %v", i, err)
+		}
+	}
+	deliveries, err := store.GetDeliveries("google12345678", 10)
+	if err != nil || len(deliveries) != 3 || deliveries[0].ID != "new" || deliveries[1].ID != "pending" || deliveries[2].ID != "old" {
+		t.Fatalf("deliveries are not the expected ones: %+v, %v", deliveries, err)
+	}
+	if deliveries, err := store.GetDeliveries("google12345678", 1); err != nil || len(deliveries) != 1 || deliveries[0].ID != "new" {
+		t.Fatalf("deliveries are not limited: %+v, %v", deliveries, err)
+	}
+	if err := store.deleteOldDeliveries(now); err != nil {
+		t.Fatalf("could not delete old deliveries: %v", err)
+	}
+	deliveries, err = store.GetDeliveries("google12345678", 10)
+	if err != nil || len(deliveries) != 2 || deliveries[0].ID != "new" || deliveries[1].ID != "pending" {
+		t.Fatalf("old deliveries are not the expected ones: %+v, %v", deliveries, err)
+	}
+}
+
+func TestIterateVisitorsInBatches(t *testing.T) {
+	store := newTestStore(t, nil)
+	store.db.NoSync = true
+	for i := 0; i < visitorsBatchSize+1; i++ {
+		if err := store.RegisterVisitor("abcd", fmt.Sprintf("visit%05d", i), shared.Visitor{IP: "203.0.113.6"}); err != nil {
+			t.Fatalf("could not register visitor: %v", err)
+		}
+	}
+	count := 0
+	err := store.IterateVisitors("abcd", func(visitor shared.Visitor) error {
+		count++
+		// fn is not called within a transaction, so it can write
+		return store.RegisterVisitor("efgh", fmt.Sprintf("visit%05d", count), visitor)
+	})
+	if err != nil || count != visitorsBatchSize+1 {
+		t.Fatalf("visitors were not iterated: %d, %v", count, err)
+	}
+}
+
+func TestVisitorsOrderedByTime(t *testing.T) {
+	day := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+	legacy, _ := json.Marshal(shared.Visitor{Timestamp: day.Add(time.Hour)})
+	store := newTestStore(t, func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucket(shortedURLsBucket); err != nil {
+			return err
+		}
+		if err := tx.Bucket(shortedURLsBucket).Put([]byte("abcd"), []byte("{}")); err != nil {
+			return err
+		}
+		bucket, err := tx.CreateBucket([]byte("abcd"))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte("ffffffff-legacy"), legacy)
+	})
+	for i, offset := range []time.Duration{3 * time.Hour, 0, 2 * time.Hour} {
+		if err := store.RegisterVisitor("abcd", fmt.Sprintf("%d-visit", 9-i), shared.Visitor{Timestamp: day.Add(offset)}); err != nil {
+			t.Fatalf("could not register visitor: %v", err)
+		}
+	}
+	var visits []time.Time
+	err := store.IterateVisitors("abcd", func(visitor shared.Visitor) error {
+		visits = append(visits, visitor.Timestamp)
+		return nil
+	})
+	if err != nil || len(visits) != 4 {
+		t.Fatalf("visitors were not iterated: %v, %v", visits, err)
+	}
+	for i, visit := range visits {
+		if !visit.Equal(day.Add(time.Duration(i) * time.Hour)) {
+			t.Fatalf("visitors are not ordered by time: %v", visits)
+		}
+	}
+	pruned, err := store.PruneVisitors(day.Add(90 * time.Minute))
+	if err != nil || pruned != 2 {
+		t.Fatalf("visitors were not pruned: %d, %v", pruned, err)
+	}
+	if visitors, err := store.GetVisitors("abcd"); err != nil || len(visitors) != 2 || !visitors[0].Timestamp.Equal(day.Add(2*time.Hour)) {
+		t.Fatalf("remaining visitors are not the expected ones: %+v, %v", visitors, err)
+	}
+}
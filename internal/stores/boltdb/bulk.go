@@ -0,0 +1,54 @@
+package boltdb
+
+import (
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+)
+
+// CreateEntries creates the entries in a single transaction and returns the
+// error of each entry whose ID already exists. If atomic is set, none of the
+// entries is created if one of them can't be created.
+func (b *BoltStore) CreateEntries(entries []shared.NewEntry, atomic bool) ([]error, error) {
+	raws := make([][]byte, len(entries))
+	for i, entry := range entries {
+		raw, err := json.Marshal(entry.Entry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not marshal entry %s", entry.ID)
+		}
+		raws[i] = raw
+	}
+	errs := make([]error, len(entries))
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(shortedURLsBucket)
+		failed := false
+		for i, entry := range entries {
+			if bucket.Get([]byte(entry.ID)) != nil {
+				errs[i] = shared.ErrEntryAlreadyExists
+				failed = true
+			}
+		}
+		if failed && atomic {
+			return nil
+		}
+		users := tx.Bucket(shortedIDsToUserBucket)
+		for i, entry := range entries {
+			if errs[i] != nil {
+				continue
+			}
+			if err := bucket.Put([]byte(entry.ID), raws[i]); err != nil {
+				return errors.Wrap(err, "could not put data into bucket")
+			}
+			if err := users.Put([]byte(entry.ID), []byte(entry.Owner)); err != nil {
+				return errors.Wrap(err, "could not put owner into bucket")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not update db")
+	}
+	return errs, nil
+}
@@ -0,0 +1,84 @@
+package boltdb
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// indexedEntry is the owner and the terms under which an entry is indexed,
+// they are needed to remove the entry from the index again
+type indexedEntry struct {
+	Owner string
+	Terms []string
+}
+
+// indexKey is the key of a term of an entry in the index bucket of its owner,
+// the terms only consist of letters and digits so the separator is unique
+func indexKey(term, id string) []byte {
+	return []byte(term + "\x00" + id)
+}
+
+// IndexEntry replaces the terms under which an entry is found in the search
+// index of its owner, without an owner the entry is removed from the index
+func (b *BoltStore) IndexEntry(id, owner string, terms []string) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		termsBucket := tx.Bucket(searchTermsBucket)
+		if raw := termsBucket.Get([]byte(id)); raw != nil {
+			var previous indexedEntry
+			if err := json.Unmarshal(raw, &previous); err != nil {
+				return errors.Wrap(err, "could not unmarshal indexed entry")
+			}
+			if bucket := tx.Bucket(searchIndexBucket).Bucket([]byte(previous.Owner)); bucket != nil {
+				for _, term := range previous.Terms {
+					if err := bucket.Delete(indexKey(term, id)); err != nil {
+						return errors.Wrap(err, "could not delete term")
+					}
+				}
+			}
+		}
+		if owner == "" {
+			return termsBucket.Delete([]byte(id))
+		}
+		bucket, err := tx.Bucket(searchIndexBucket).CreateBucketIfNotExists([]byte(owner))
+		if err != nil {
+			return errors.Wrap(err, "could not create bucket")
+		}
+		for _, term := range terms {
+			if err := bucket.Put(indexKey(term, id), []byte{}); err != nil {
+				return errors.Wrap(err, "could not put term")
+			}
+		}
+		raw, err := json.Marshal(indexedEntry{Owner: owner, Terms: terms})
+		if err != nil {
+			return errors.Wrap(err, "could not marshal indexed entry")
+		}
+		return termsBucket.Put([]byte(id), raw)
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// SearchEntryIDs returns the IDs of the entries of the owner which have a
+// term that begins with the prefix
+func (b *BoltStore) SearchEntryIDs(owner, prefix string) ([]string, error) {
+	ids := []string{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(searchIndexBucket).Bucket([]byte(owner))
+		if bucket == nil {
+			return nil
+		}
+		seen := map[string]bool{}
+		cursor := bucket.Cursor()
+		for k, _ := cursor.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = cursor.Next() {
+			id := string(k[bytes.IndexByte(k, 0)+1:])
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		return nil
+	})
+	return ids, errors.Wrap(err, "could not view db")
+}
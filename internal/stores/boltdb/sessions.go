@@ -0,0 +1,149 @@
+package boltdb
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+)
+
+// CreateSession saves a session of a user, it is referenced by its ID from
+// the sessions of the user
+func (b *BoltStore) CreateSession(identity string, session shared.Session) error {
+	raw, err := json.Marshal(session)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal session")
+	}
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		sessions := tx.Bucket(sessionsBucket)
+		if sessions.Get([]byte(session.ID)) != nil {
+			return errors.New("session already exists")
+		}
+		bucket, err := tx.Bucket(userSessionsBucket).CreateBucketIfNotExists([]byte(identity))
+		if err != nil {
+			return errors.Wrap(err, "could not create user sessions bucket")
+		}
+		if err := bucket.Put([]byte(session.ID), []byte{}); err != nil {
+			return errors.Wrap(err, "could not put session of user")
+		}
+		return sessions.Put([]byte(session.ID), raw)
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// getSession returns a session by its ID
+func getSession(tx *bolt.Tx, id string) (*shared.Session, error) {
+	raw := tx.Bucket(sessionsBucket).Get([]byte(id))
+	if raw == nil {
+		return nil, shared.ErrNoSessionFound
+	}
+	var session shared.Session
+	if err := json.Unmarshal(raw, &session); err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal session")
+	}
+	return &session, nil
+}
+
+// deleteSession deletes a session and its reference from the sessions of
+// its user
+func deleteSession(tx *bolt.Tx, session *shared.Session) error {
+	if err := tx.Bucket(sessionsBucket).Delete([]byte(session.ID)); err != nil {
+		return errors.Wrap(err, "could not delete session")
+	}
+	bucket := tx.Bucket(userSessionsBucket).Bucket([]byte(shared.Identity(session.OAuthProvider, session.OAuthID)))
+	if bucket == nil {
+		return nil
+	}
+	return bucket.Delete([]byte(session.ID))
+}
+
+// GetSession returns a session by its ID
+func (b *BoltStore) GetSession(id string) (*shared.Session, error) {
+	var session *shared.Session
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		session, err = getSession(tx, id)
+		return err
+	})
+	return session, errors.Wrap(err, "could not view db")
+}
+
+// UpdateSession updates a session in a single transaction
+func (b *BoltStore) UpdateSession(id string, fn func(*shared.Session) error) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		session, err := getSession(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := fn(session); err != nil {
+			return err
+		}
+		raw, err := json.Marshal(session)
+		if err != nil {
+			return errors.Wrap(err, "could not marshal session")
+		}
+		return tx.Bucket(sessionsBucket).Put([]byte(id), raw)
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// DeleteSession deletes a session by its ID
+func (b *BoltStore) DeleteSession(id string) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		session, err := getSession(tx, id)
+		if err != nil {
+			return err
+		}
+		return deleteSession(tx, session)
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// DeleteUserSessions deletes all sessions of a user
+func (b *BoltStore) DeleteUserSessions(identity string) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		userSessions := tx.Bucket(userSessionsBucket)
+		bucket := userSessions.Bucket([]byte(identity))
+		if bucket == nil {
+			return nil
+		}
+		sessions := tx.Bucket(sessionsBucket)
+		err := bucket.ForEach(func(k, v []byte) error {
+			return sessions.Delete(k)
+		})
+		if err != nil {
+			return errors.Wrap(err, "could not delete sessions")
+		}
+		return userSessions.DeleteBucket([]byte(identity))
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// deleteExpiredSessions deletes all sessions which are expired at the given time
+func (b *BoltStore) deleteExpiredSessions(now time.Time) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		var expired []*shared.Session
+		err := tx.Bucket(sessionsBucket).ForEach(func(k, v []byte) error {
+			var session shared.Session
+			if err := json.Unmarshal(v, &session); err != nil {
+				return errors.Wrap(err, "could not unmarshal session")
+			}
+			if session.Expired(now) {
+				expired = append(expired, &session)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, session := range expired {
+			if err := deleteSession(tx, session); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return errors.Wrap(err, "could not update db")
+}
@@ -0,0 +1,123 @@
+package boltdb
+
+import (
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+)
+
+// CreateTeam saves a new team and adds it to the teams of its members
+func (b *BoltStore) CreateTeam(team shared.Team) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(teamsBucket).Get([]byte(team.ID)) != nil {
+			return errors.New("team already exists")
+		}
+		for _, member := range team.Members {
+			if err := addUserTeam(tx, member, team.ID); err != nil {
+				return err
+			}
+		}
+		return putTeam(tx, team)
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// GetTeam returns a team by its ID
+func (b *BoltStore) GetTeam(id string) (*shared.Team, error) {
+	var team *shared.Team
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		team, err = getTeam(tx, id)
+		return err
+	})
+	return team, errors.Wrap(err, "could not view db")
+}
+
+// GetUserTeams returns the teams of which the user is a member
+func (b *BoltStore) GetUserTeams(identity string) ([]shared.Team, error) {
+	teams := []shared.Team{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(userTeamsBucket).Bucket([]byte(identity))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			team, err := getTeam(tx, string(k))
+			if err != nil {
+				return err
+			}
+			teams = append(teams, *team)
+			return nil
+		})
+	})
+	return teams, errors.Wrap(err, "could not view db")
+}
+
+// AddTeamMember adds a user to the members of a team
+func (b *BoltStore) AddTeamMember(id, identity string) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		team, err := getTeam(tx, id)
+		if err != nil {
+			return err
+		}
+		if !team.AddMember(identity) {
+			return nil
+		}
+		if err := addUserTeam(tx, identity, id); err != nil {
+			return err
+		}
+		return putTeam(tx, *team)
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// RemoveTeamMember removes a user from the members of a team, the last
+// member can not be removed
+func (b *BoltStore) RemoveTeamMember(id, identity string) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		team, err := getTeam(tx, id)
+		if err != nil {
+			return err
+		}
+		if removed, err := team.RemoveMember(identity); err != nil || !removed {
+			return err
+		}
+		if bucket := tx.Bucket(userTeamsBucket).Bucket([]byte(identity)); bucket != nil {
+			if err := bucket.Delete([]byte(id)); err != nil {
+				return errors.Wrap(err, "could not remove team of user")
+			}
+		}
+		return putTeam(tx, *team)
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+func getTeam(tx *bolt.Tx, id string) (*shared.Team, error) {
+	raw := tx.Bucket(teamsBucket).Get([]byte(id))
+	if raw == nil {
+		return nil, shared.ErrNoTeamFound
+	}
+	var team shared.Team
+	if err := json.Unmarshal(raw, &team); err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal team")
+	}
+	return &team, nil
+}
+
+func putTeam(tx *bolt.Tx, team shared.Team) error {
+	raw, err := json.Marshal(team)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal team")
+	}
+	return errors.Wrap(tx.Bucket(teamsBucket).Put([]byte(team.ID), raw), "could not put team")
+}
+
+func addUserTeam(tx *bolt.Tx, identity, id string) error {
+	bucket, err := tx.Bucket(userTeamsBucket).CreateBucketIfNotExists([]byte(identity))
+	if err != nil {
+		return errors.Wrap(err, "could not create user teams bucket")
+	}
+	return errors.Wrap(bucket.Put([]byte(id), []byte{}), "could not add team of user")
+}
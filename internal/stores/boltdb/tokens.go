@@ -0,0 +1,114 @@
+package boltdb
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+)
+
+// CreateAPIToken saves an API token of a user, it is stored by its hash and
+// referenced by its ID from the tokens of the user
+func (b *BoltStore) CreateAPIToken(identity string, token shared.APIToken) error {
+	raw, err := json.Marshal(token)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal API token")
+	}
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		tokens := tx.Bucket(apiTokensBucket)
+		if tokens.Get([]byte(token.Hash)) != nil {
+			return errors.New("API token already exists")
+		}
+		bucket, err := tx.Bucket(userAPITokensBucket).CreateBucketIfNotExists([]byte(identity))
+		if err != nil {
+			return errors.Wrap(err, "could not create user API tokens bucket")
+		}
+		if err := bucket.Put([]byte(token.ID), []byte(token.Hash)); err != nil {
+			return errors.Wrap(err, "could not put API token of user")
+		}
+		return tokens.Put([]byte(token.Hash), raw)
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// getAPIToken returns an API token by its hash
+func getAPIToken(tx *bolt.Tx, hash string) (*shared.APIToken, error) {
+	raw := tx.Bucket(apiTokensBucket).Get([]byte(hash))
+	if raw == nil {
+		return nil, shared.ErrNoAPITokenFound
+	}
+	var token shared.APIToken
+	if err := json.Unmarshal(raw, &token); err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal API token")
+	}
+	return &token, nil
+}
+
+// GetAPIToken returns an API token by its hash
+func (b *BoltStore) GetAPIToken(hash string) (*shared.APIToken, error) {
+	var token *shared.APIToken
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		token, err = getAPIToken(tx, hash)
+		return err
+	})
+	return token, errors.Wrap(err, "could not view db")
+}
+
+// GetAPITokens returns all API tokens of a user
+func (b *BoltStore) GetAPITokens(identity string) ([]shared.APIToken, error) {
+	tokens := []shared.APIToken{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(userAPITokensBucket).Bucket([]byte(identity))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			token, err := getAPIToken(tx, string(v))
+			if err != nil {
+				return err
+			}
+			tokens = append(tokens, *token)
+			return nil
+		})
+	})
+	return tokens, errors.Wrap(err, "could not view db")
+}
+
+// DeleteAPIToken deletes an API token of a user by its ID
+func (b *BoltStore) DeleteAPIToken(identity, id string) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(userAPITokensBucket).Bucket([]byte(identity))
+		if bucket == nil {
+			return shared.ErrNoAPITokenFound
+		}
+		hash := bucket.Get([]byte(id))
+		if hash == nil {
+			return shared.ErrNoAPITokenFound
+		}
+		if err := tx.Bucket(apiTokensBucket).Delete(hash); err != nil {
+			return errors.Wrap(err, "could not delete API token")
+		}
+		return bucket.Delete([]byte(id))
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// TouchAPIToken sets the time at which an API token was used the last time
+func (b *BoltStore) TouchAPIToken(hash string, lastUsed time.Time) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		token, err := getAPIToken(tx, hash)
+		if err != nil {
+			return err
+		}
+		token.LastUsed = &lastUsed
+		raw, err := json.Marshal(token)
+		if err != nil {
+			return errors.Wrap(err, "could not marshal API token")
+		}
+		return tx.Bucket(apiTokensBucket).Put([]byte(hash), raw)
+	})
+	return errors.Wrap(err, "could not update db")
+}
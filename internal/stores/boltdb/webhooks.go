@@ -0,0 +1,270 @@
+package boltdb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+)
+
+// CreateWebhook saves a webhook of a user
+func (b *BoltStore) CreateWebhook(userIdentifier string, webhook shared.Webhook) error {
+	raw, err := json.Marshal(webhook)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal webhook")
+	}
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(webhooksBucket).CreateBucketIfNotExists([]byte(userIdentifier))
+		if err != nil {
+			return errors.Wrap(err, "could not create user webhooks bucket")
+		}
+		return bucket.Put([]byte(webhook.ID), raw)
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// GetWebhooks returns all webhooks of a user
+func (b *BoltStore) GetWebhooks(userIdentifier string) ([]shared.Webhook, error) {
+	webhooks := []shared.Webhook{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(webhooksBucket).Bucket([]byte(userIdentifier))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var webhook shared.Webhook
+			if err := json.Unmarshal(v, &webhook); err != nil {
+				return errors.Wrap(err, "could not unmarshal webhook")
+			}
+			webhooks = append(webhooks, webhook)
+			return nil
+		})
+	})
+	return webhooks, errors.Wrap(err, "could not view db")
+}
+
+// DeleteWebhook deletes a webhook of a user
+func (b *BoltStore) DeleteWebhook(userIdentifier, id string) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(webhooksBucket).Bucket([]byte(userIdentifier))
+		if bucket == nil || bucket.Get([]byte(id)) == nil {
+			return shared.ErrNoWebhookFound
+		}
+		return bucket.Delete([]byte(id))
+	})
+	return errors.Wrap(err, "could not update db")
+}
+
+// timeKey returns a key which is ordered by the given time, the ID
+// keeps the keys of the same time apart
+func timeKey(t time.Time, id string) []byte {
+	key := make([]byte, 8, 8+len(id))
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return append(key, id...)
+}
+
+// queueKey returns the key of a delivery in the queue, which is ordered by
+// the time of the next attempt
+func queueKey(delivery shared.WebhookDelivery) []byte {
+	return timeKey(delivery.NextAttempt, delivery.ID)
+}
+
+// indexDelivery adds a delivery to the index of its user and to the index by
+// creation time, deliveries of the global webhooks have no user
+func indexDelivery(tx *bolt.Tx, delivery shared.WebhookDelivery) error {
+	key := timeKey(delivery.CreatedOn, delivery.ID)
+	if delivery.UserIdentifier != "" {
+		bucket, err := tx.Bucket(userDeliveriesBucket).CreateBucketIfNotExists([]byte(delivery.UserIdentifier))
+		if err != nil {
+			return errors.Wrap(err, "could not create user deliveries bucket")
+		}
+		if err := bucket.Put(key, []byte(delivery.ID)); err != nil {
+			return errors.Wrap(err, "could not index delivery of user")
+		}
+	}
+	return errors.Wrap(tx.Bucket(deliveriesByTimeBucket).Put(key, []byte(delivery.ID)), "could not index delivery by time")
+}
+
+// migrateDeliveryIndexes indexes the deliveries once, which were saved
+// before the deliveries were indexed by user and by time
+func migrateDeliveryIndexes(tx *bolt.Tx) error {
+	if tx.Bucket(deliveriesByTimeBucket) != nil {
+		return nil
+	}
+	for _, name := range [][]byte{userDeliveriesBucket, deliveriesByTimeBucket} {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return errors.Wrapf(err, "could not create %s bucket", name)
+		}
+	}
+	deliveries := tx.Bucket(deliveriesBucket)
+	if deliveries == nil {
+		return nil
+	}
+	var existing []shared.WebhookDelivery
+	err := deliveries.ForEach(func(k, v []byte) error {
+		var delivery shared.WebhookDelivery
+		if err := json.Unmarshal(v, &delivery); err != nil {
+			return errors.Wrap(err, "could not unmarshal delivery")
+		}
+		existing = append(existing, delivery)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, delivery := range existing {
+		if err := indexDelivery(tx, delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putDelivery saves a delivery and queues it if it is pending, a previously
+// queued attempt of the delivery is removed from the queue. New deliveries
+// are indexed, their user and creation time don't change afterwards.
+func putDelivery(tx *bolt.Tx, delivery shared.WebhookDelivery) error {
+	deliveries, queue := tx.Bucket(deliveriesBucket), tx.Bucket(deliveryQueueBucket)
+	if raw := deliveries.Get([]byte(delivery.ID)); raw != nil {
+		var previous shared.WebhookDelivery
+		if err := json.Unmarshal(raw, &previous); err != nil {
+			return errors.Wrap(err, "could not unmarshal delivery")
+		}
+		if err := queue.Delete(queueKey(previous)); err != nil {
+			return errors.Wrap(err, "could not dequeue delivery")
+		}
+	} else if err := indexDelivery(tx, delivery); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(delivery)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal delivery")
+	}
+	if err := deliveries.Put([]byte(delivery.ID), raw); err != nil {
+		return errors.Wrap(err, "could not put delivery")
+	}
+	if delivery.Status == shared.DeliveryPending {
+		return queue.Put(queueKey(delivery), []byte(delivery.ID))
+	}
+	return nil
+}
+
+// SaveDelivery saves a webhook delivery in the delivery log and
+// queues it for its next attempt if it is pending
+func (b *BoltStore) SaveDelivery(delivery shared.WebhookDelivery) error {
+	return errors.Wrap(b.db.Update(func(tx *bolt.Tx) error {
+		return putDelivery(tx, delivery)
+	}), "could not update db")
+}
+
+// ClaimDeliveries returns up to limit pending deliveries which are due. They
+// are requeued after the lease, so they are retried if the claiming process
+// stops before it saves the result.
+func (b *BoltStore) ClaimDeliveries(now time.Time, lease time.Duration, limit int) ([]shared.WebhookDelivery, error) {
+	var claimed []shared.WebhookDelivery
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		var ids [][]byte
+		c := tx.Bucket(deliveryQueueBucket).Cursor()
+		for k, v := c.First(); k != nil && len(ids) < limit; k, v = c.Next() {
+			if int64(binary.BigEndian.Uint64(k[:8])) > now.UnixNano() {
+				break
+			}
+			ids = append(ids, append([]byte{}, v...))
+		}
+		for _, id := range ids {
+			var delivery shared.WebhookDelivery
+			if err := json.Unmarshal(tx.Bucket(deliveriesBucket).Get(id), &delivery); err != nil {
+				return errors.Wrap(err, "could not unmarshal delivery")
+			}
+			delivery.NextAttempt = now.Add(lease)
+			if err := putDelivery(tx, delivery); err != nil {
+				return err
+			}
+			claimed = append(claimed, delivery)
+		}
+		return nil
+	})
+	return claimed, errors.Wrap(err, "could not update db")
+}
+
+// GetDeliveries returns the latest deliveries of a user, newest first. They
+// are read backwards from the index of the user, which is ordered by the
+// creation time.
+func (b *BoltStore) GetDeliveries(userIdentifier string, limit int) ([]shared.WebhookDelivery, error) {
+	deliveries := []shared.WebhookDelivery{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		index := tx.Bucket(userDeliveriesBucket).Bucket([]byte(userIdentifier))
+		if index == nil {
+			return nil
+		}
+		bucket := tx.Bucket(deliveriesBucket)
+		c := index.Cursor()
+		for k, id := c.Last(); k != nil && len(deliveries) < limit; k, id = c.Prev() {
+			raw := bucket.Get(id)
+			if raw == nil {
+				continue
+			}
+			var delivery shared.WebhookDelivery
+			if err := json.Unmarshal(raw, &delivery); err != nil {
+				return errors.Wrap(err, "could not unmarshal delivery")
+			}
+			deliveries = append(deliveries, delivery)
+		}
+		return nil
+	})
+	return deliveries, errors.Wrap(err, "could not view db")
+}
+
+// deleteOldDeliveries deletes the finished deliveries which are older than
+// the retention of the delivery log. Only the deliveries which were created
+// before the retention are read from the index by time, since a delivery
+// can't be updated before it was created.
+func (b *BoltStore) deleteOldDeliveries(now time.Time) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket, byTime := tx.Bucket(deliveriesBucket), tx.Bucket(deliveriesByTimeBucket)
+		var old []shared.WebhookDelivery
+		var orphaned [][]byte
+		c := byTime.Cursor()
+		for k, id := c.First(); k != nil; k, id = c.Next() {
+			if now.Sub(time.Unix(0, int64(binary.BigEndian.Uint64(k[:8])))) <= shared.WebhookDeliveryRetention {
+				break
+			}
+			raw := bucket.Get(id)
+			if raw == nil {
+				orphaned = append(orphaned, append([]byte(nil), k...))
+				continue
+			}
+			var delivery shared.WebhookDelivery
+			if err := json.Unmarshal(raw, &delivery); err != nil {
+				return errors.Wrap(err, "could not unmarshal delivery")
+			}
+			if delivery.Status != shared.DeliveryPending && now.Sub(delivery.UpdatedOn) > shared.WebhookDeliveryRetention {
+				old = append(old, delivery)
+			}
+		}
+		for _, k := range orphaned {
+			if err := byTime.Delete(k); err != nil {
+				return errors.Wrap(err, "could not delete delivery index")
+			}
+		}
+		for _, delivery := range old {
+			key := timeKey(delivery.CreatedOn, delivery.ID)
+			if err := byTime.Delete(key); err != nil {
+				return errors.Wrap(err, "could not delete delivery index")
+			}
+			if index := tx.Bucket(userDeliveriesBucket).Bucket([]byte(delivery.UserIdentifier)); index != nil {
+				if err := index.Delete(key); err != nil {
+					return errors.Wrap(err, "could not delete delivery index of user")
+				}
+			}
+			if err := bucket.Delete([]byte(delivery.ID)); err != nil {
+				return errors.Wrap(err, "could not delete delivery")
+			}
+		}
+		return nil
+	})
+	return errors.Wrap(err, "could not update db")
+}
@@ -0,0 +1,198 @@
+package stores
+
+import (
+	"time"
+
+	"github.com/mxschmitt/golang-url-shortener/internal/metrics"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+)
+
+// maxBulkEntries is the number of entries which can be created at once
+const maxBulkEntries = 1000
+
+// maxBulkPasswords is the number of distinct passwords which are hashed for
+// the entries of a bulk creation, entries with further passwords fail, so
+// they can be created with another request
+const maxBulkPasswords = 50
+
+// ErrNoEntries is returned when a bulk creation does not contain any entry
+var ErrNoEntries = errors.New("no entries given")
+
+// ErrTooManyEntries is returned when a bulk creation contains too many entries
+var ErrTooManyEntries = errors.Errorf("at most %d entries can be created at once", maxBulkEntries)
+
+// ErrTooManyPasswords is returned for the entries of a bulk creation whose
+// password exceeds the number of distinct passwords which are hashed at once
+var ErrTooManyPasswords = errors.Errorf("at most %d distinct passwords can be used at once", maxBulkPasswords)
+
+// ErrDuplicateID is returned when two entries of a bulk creation have the same ID
+var ErrDuplicateID = errors.New("the ID is used by another entry of the same request")
+
+// ErrBulkAborted is returned for the valid entries of an all-or-nothing bulk
+// creation which were not created since another entry failed
+var ErrBulkAborted = errors.New("the entry was not created since another entry failed")
+
+// BulkEntry is an entry of a bulk creation, the ID is generated if it is empty
+type BulkEntry struct {
+	Entry    shared.Entry
+	ID       string
+	Password string
+}
+
+// BulkResult is the result of an entry of a bulk creation, it contains
+// either the ID and the deletion HMAC of the created entry or the error
+type BulkResult struct {
+	ID           string
+	DeletionHMAC []byte
+	Err          error
+}
+
+// CreateEntries validates all entries up front and creates them in as few
+// storage transactions as possible. If atomic is set, either all entries are
+// created or none, otherwise every valid entry is created. Random IDs which
+// are already taken are generated again. Every distinct password is only
+// hashed once and only the first maxBulkPasswords of them are accepted.
+func (s *Store) CreateEntries(entries []BulkEntry, atomic bool) ([]BulkResult, error) {
+	if len(entries) == 0 {
+		return nil, ErrNoEntries
+	} else if len(entries) > maxBulkEntries {
+		return nil, ErrTooManyEntries
+	}
+	hashes := map[string][]byte{}
+	results := make([]BulkResult, len(entries))
+	prepared := make([]shared.Entry, len(entries))
+	usedIDs := map[string]bool{}
+	now := time.Now()
+	for i, bulkEntry := range entries {
+		entry := bulkEntry.Entry
+		if err := validateID(bulkEntry.ID); err != nil {
+			results[i].Err = err
+			continue
+		}
+		if err := prepareEntry(&entry, ""); err != nil {
+			results[i].Err = err
+			continue
+		}
+		if bulkEntry.Password != "" && hashes[bulkEntry.Password] == nil {
+			if len(hashes) >= maxBulkPasswords {
+				results[i].Err = ErrTooManyPasswords
+				continue
+			}
+			hash, err := hashPassword(bulkEntry.Password)
+			if err != nil {
+				return nil, err
+			}
+			hashes[bulkEntry.Password] = hash
+		}
+		if bulkEntry.ID != "" {
+			if usedIDs[bulkEntry.ID] {
+				results[i].Err = ErrDuplicateID
+				continue
+			}
+			usedIDs[bulkEntry.ID] = true
+		}
+		if bulkEntry.Password != "" {
+			entry.Password = hashes[bulkEntry.Password]
+		}
+		entry.Public.CreatedOn = now
+		prepared[i] = entry
+	}
+	if atomic && abortOnFailure(results) {
+		return results, nil
+	}
+	ids := make([]string, len(entries))
+	var pending []int
+	for i, result := range results {
+		if result.Err == nil {
+			ids[i] = entries[i].ID
+			pending = append(pending, i)
+		}
+	}
+	// try it 10 times to find unused random IDs
+	for attempt := 1; attempt <= 10 && len(pending) > 0; attempt++ {
+		batch := make([]shared.NewEntry, len(pending))
+		for j, i := range pending {
+			for ids[i] == "" {
+				id, err := generateRandomString(s.idLength)
+				if err != nil {
+					return nil, errors.Wrap(err, "could not generate random string")
+				}
+				if !usedIDs[id] {
+					usedIDs[id], ids[i] = true, id
+				}
+			}
+			batch[j] = shared.NewEntry{ID: ids[i], Owner: getEntryOwner(prepared[i]), Entry: prepared[i]}
+		}
+		errs, err := s.storage.CreateEntries(batch, atomic)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create entries")
+		}
+		var created, retry []int
+		failed := false
+		for j, i := range pending {
+			switch {
+			case errs[j] == nil:
+				created = append(created, i)
+			case errors.Cause(errs[j]) == shared.ErrEntryAlreadyExists && entries[i].ID == "":
+				metrics.IDRetries.Inc()
+				ids[i] = ""
+				retry = append(retry, i)
+			default:
+				results[i].Err = errs[j]
+				failed = true
+			}
+		}
+		if atomic && failed {
+			abortOnFailure(results)
+			return results, nil
+		} else if atomic && len(retry) > 0 {
+			// nothing was created, so all entries are tried again
+			continue
+		}
+		s.finishEntries(created, ids, prepared, results)
+		pending = retry
+	}
+	for _, i := range pending {
+		results[i].Err = ErrGeneratingIDFailed
+	}
+	if atomic && len(pending) > 0 {
+		abortOnFailure(results)
+	}
+	return results, nil
+}
+
+// abortOnFailure marks all entries as aborted if one of them failed and
+// reports whether this was the case
+func abortOnFailure(results []BulkResult) bool {
+	failed := false
+	for _, result := range results {
+		if result.Err != nil {
+			failed = true
+			break
+		}
+	}
+	if !failed {
+		return false
+	}
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Err = ErrBulkAborted
+		}
+	}
+	return true
+}
+
+// finishEntries fills the results of the created entries and triggers
+// everything which follows the creation of an entry
+func (s *Store) finishEntries(created []int, ids []string, prepared []shared.Entry, results []BulkResult) {
+	createdIDs := make([]string, len(created))
+	for j, i := range created {
+		results[i].ID, results[i].DeletionHMAC = ids[i], deletionHMAC(ids[i])
+		createdIDs[j] = ids[i]
+		metrics.EntriesCreated.Inc()
+		s.indexEntry(ids[i], prepared[i])
+		s.dispatch(shared.EventEntryCreated, getUserIdentifier(prepared[i].OAuthProvider, prepared[i].OAuthID), ids[i], prepared[i].Public)
+	}
+	s.fetchMetadataInBackground(createdIDs...)
+}
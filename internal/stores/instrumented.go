@@ -0,0 +1,274 @@
+package stores
+
+import (
+	"time"
+
+	"github.com/mxschmitt/golang-url-shortener/internal/metrics"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+)
+
+// instrumentedStorage records the latency and the errors of every
+// operation of the wrapped storage backend
+type instrumentedStorage struct {
+	storage shared.Storage
+	backend string
+}
+
+func instrumentStorage(backend string, s shared.Storage) shared.Storage {
+	return &instrumentedStorage{storage: s, backend: backend}
+}
+
+// observe has to be deferred at the beginning of an operation, lookups of
+// things which do not exist are not counted as errors
+func (i *instrumentedStorage) observe(method string, start time.Time, err *error) {
+	cause := errors.Cause(*err)
+	failed := cause != nil && cause != shared.ErrNoEntryFound && cause != shared.ErrNoWebhookFound &&
+		cause != shared.ErrNoTeamFound && cause != shared.ErrLastTeamMember && cause != shared.ErrNoAPITokenFound &&
+		cause != shared.ErrNoSessionFound && cause != shared.ErrEntryAlreadyExists
+	metrics.ObserveStorage(i.backend, method, start, failed)
+}
+
+func (i *instrumentedStorage) GetEntryByID(id string) (entry *shared.Entry, err error) {
+	defer i.observe("GetEntryByID", time.Now(), &err)
+	return i.storage.GetEntryByID(id)
+}
+
+func (i *instrumentedStorage) UpdateEntry(id string, fn func(*shared.Entry) error) (err error) {
+	defer i.observe("UpdateEntry", time.Now(), &err)
+	return i.storage.UpdateEntry(id, fn)
+}
+
+func (i *instrumentedStorage) IterateEntries(fn func(string, shared.Entry) error) (err error) {
+	defer i.observe("IterateEntries", time.Now(), &err)
+	return i.storage.IterateEntries(fn)
+}
+
+func (i *instrumentedStorage) TransferEntry(id, userIdentifier string, fn func(*shared.Entry) (*shared.AuditEvent, error)) (err error) {
+	defer i.observe("TransferEntry", time.Now(), &err)
+	return i.storage.TransferEntry(id, userIdentifier, fn)
+}
+
+func (i *instrumentedStorage) GetAuditEvents(limit int) (events []shared.AuditEvent, err error) {
+	defer i.observe("GetAuditEvents", time.Now(), &err)
+	return i.storage.GetAuditEvents(limit)
+}
+
+func (i *instrumentedStorage) IndexEntry(id, owner string, terms []string) (err error) {
+	defer i.observe("IndexEntry", time.Now(), &err)
+	return i.storage.IndexEntry(id, owner, terms)
+}
+
+func (i *instrumentedStorage) SearchEntryIDs(owner, prefix string) (ids []string, err error) {
+	defer i.observe("SearchEntryIDs", time.Now(), &err)
+	return i.storage.SearchEntryIDs(owner, prefix)
+}
+
+func (i *instrumentedStorage) GetVisitors(id string) (visitors []shared.Visitor, err error) {
+	defer i.observe("GetVisitors", time.Now(), &err)
+	return i.storage.GetVisitors(id)
+}
+
+func (i *instrumentedStorage) IterateVisitors(id string, fn func(shared.Visitor) error) (err error) {
+	defer i.observe("IterateVisitors", time.Now(), &err)
+	return i.storage.IterateVisitors(id, fn)
+}
+
+func (i *instrumentedStorage) PruneVisitors(before time.Time) (pruned int, err error) {
+	defer i.observe("PruneVisitors", time.Now(), &err)
+	return i.storage.PruneVisitors(before)
+}
+
+func (i *instrumentedStorage) GetRollups(id string) (rollups map[string]int, err error) {
+	defer i.observe("GetRollups", time.Now(), &err)
+	return i.storage.GetRollups(id)
+}
+
+func (i *instrumentedStorage) AddRollups(id string, counters map[string]int) (err error) {
+	defer i.observe("AddRollups", time.Now(), &err)
+	return i.storage.AddRollups(id, counters)
+}
+
+func (i *instrumentedStorage) DeleteEntry(id string) (err error) {
+	defer i.observe("DeleteEntry", time.Now(), &err)
+	return i.storage.DeleteEntry(id)
+}
+
+func (i *instrumentedStorage) IncreaseVisitCounter(id string) (err error) {
+	defer i.observe("IncreaseVisitCounter", time.Now(), &err)
+	return i.storage.IncreaseVisitCounter(id)
+}
+
+func (i *instrumentedStorage) CreateEntry(entry shared.Entry, id, userIdentifier string) (err error) {
+	defer i.observe("CreateEntry", time.Now(), &err)
+	return i.storage.CreateEntry(entry, id, userIdentifier)
+}
+
+func (i *instrumentedStorage) CreateEntries(entries []shared.NewEntry, atomic bool) (errs []error, err error) {
+	defer i.observe("CreateEntries", time.Now(), &err)
+	return i.storage.CreateEntries(entries, atomic)
+}
+
+func (i *instrumentedStorage) GetUserEntries(userIdentifier string) (entries map[string]shared.Entry, err error) {
+	defer i.observe("GetUserEntries", time.Now(), &err)
+	return i.storage.GetUserEntries(userIdentifier)
+}
+
+func (i *instrumentedStorage) RegisterVisitor(id, visitID string, visitor shared.Visitor) (err error) {
+	defer i.observe("RegisterVisitor", time.Now(), &err)
+	return i.storage.RegisterVisitor(id, visitID, visitor)
+}
+
+func (i *instrumentedStorage) RegisterBotVisitor(id, visitID string, visitor shared.Visitor) (err error) {
+	defer i.observe("RegisterBotVisitor", time.Now(), &err)
+	return i.storage.RegisterBotVisitor(id, visitID, visitor)
+}
+
+func (i *instrumentedStorage) GetBotVisitors(id string) (visitors []shared.Visitor, err error) {
+	defer i.observe("GetBotVisitors", time.Now(), &err)
+	return i.storage.GetBotVisitors(id)
+}
+
+func (i *instrumentedStorage) AddUniqueVisitor(id string, t time.Time, fingerprint []byte) (err error) {
+	defer i.observe("AddUniqueVisitor", time.Now(), &err)
+	return i.storage.AddUniqueVisitor(id, t, fingerprint)
+}
+
+func (i *instrumentedStorage) CountUniqueVisitors(id string, days []time.Time) (count int, err error) {
+	defer i.observe("CountUniqueVisitors", time.Now(), &err)
+	return i.storage.CountUniqueVisitors(id, days)
+}
+
+func (i *instrumentedStorage) ReserveAttempt(key string, ttl time.Duration, allow func(*shared.Attempts) bool) (reserved bool, err error) {
+	defer i.observe("ReserveAttempt", time.Now(), &err)
+	return i.storage.ReserveAttempt(key, ttl, allow)
+}
+
+func (i *instrumentedStorage) ResetAttempts(key string) (err error) {
+	defer i.observe("ResetAttempts", time.Now(), &err)
+	return i.storage.ResetAttempts(key)
+}
+
+func (i *instrumentedStorage) SetIfAbsent(key string, ttl time.Duration) (set bool, err error) {
+	defer i.observe("SetIfAbsent", time.Now(), &err)
+	return i.storage.SetIfAbsent(key, ttl)
+}
+
+func (i *instrumentedStorage) PublishVisit(event shared.VisitEvent) (err error) {
+	defer i.observe("PublishVisit", time.Now(), &err)
+	return i.storage.PublishVisit(event)
+}
+
+func (i *instrumentedStorage) SubscribeVisits() (<-chan shared.VisitEvent, func()) {
+	return i.storage.SubscribeVisits()
+}
+
+func (i *instrumentedStorage) CreateWebhook(userIdentifier string, webhook shared.Webhook) (err error) {
+	defer i.observe("CreateWebhook", time.Now(), &err)
+	return i.storage.CreateWebhook(userIdentifier, webhook)
+}
+
+func (i *instrumentedStorage) GetWebhooks(userIdentifier string) (webhooks []shared.Webhook, err error) {
+	defer i.observe("GetWebhooks", time.Now(), &err)
+	return i.storage.GetWebhooks(userIdentifier)
+}
+
+func (i *instrumentedStorage) DeleteWebhook(userIdentifier, id string) (err error) {
+	defer i.observe("DeleteWebhook", time.Now(), &err)
+	return i.storage.DeleteWebhook(userIdentifier, id)
+}
+
+func (i *instrumentedStorage) SaveDelivery(delivery shared.WebhookDelivery) (err error) {
+	defer i.observe("SaveDelivery", time.Now(), &err)
+	return i.storage.SaveDelivery(delivery)
+}
+
+func (i *instrumentedStorage) ClaimDeliveries(now time.Time, lease time.Duration, limit int) (deliveries []shared.WebhookDelivery, err error) {
+	defer i.observe("ClaimDeliveries", time.Now(), &err)
+	return i.storage.ClaimDeliveries(now, lease, limit)
+}
+
+func (i *instrumentedStorage) GetDeliveries(userIdentifier string, limit int) (deliveries []shared.WebhookDelivery, err error) {
+	defer i.observe("GetDeliveries", time.Now(), &err)
+	return i.storage.GetDeliveries(userIdentifier, limit)
+}
+
+func (i *instrumentedStorage) CreateTeam(team shared.Team) (err error) {
+	defer i.observe("CreateTeam", time.Now(), &err)
+	return i.storage.CreateTeam(team)
+}
+
+func (i *instrumentedStorage) GetTeam(id string) (team *shared.Team, err error) {
+	defer i.observe("GetTeam", time.Now(), &err)
+	return i.storage.GetTeam(id)
+}
+
+func (i *instrumentedStorage) GetUserTeams(identity string) (teams []shared.Team, err error) {
+	defer i.observe("GetUserTeams", time.Now(), &err)
+	return i.storage.GetUserTeams(identity)
+}
+
+func (i *instrumentedStorage) AddTeamMember(id, identity string) (err error) {
+	defer i.observe("AddTeamMember", time.Now(), &err)
+	return i.storage.AddTeamMember(id, identity)
+}
+
+func (i *instrumentedStorage) RemoveTeamMember(id, identity string) (err error) {
+	defer i.observe("RemoveTeamMember", time.Now(), &err)
+	return i.storage.RemoveTeamMember(id, identity)
+}
+
+func (i *instrumentedStorage) CreateAPIToken(identity string, token shared.APIToken) (err error) {
+	defer i.observe("CreateAPIToken", time.Now(), &err)
+	return i.storage.CreateAPIToken(identity, token)
+}
+
+func (i *instrumentedStorage) GetAPIToken(hash string) (token *shared.APIToken, err error) {
+	defer i.observe("GetAPIToken", time.Now(), &err)
+	return i.storage.GetAPIToken(hash)
+}
+
+func (i *instrumentedStorage) GetAPITokens(identity string) (tokens []shared.APIToken, err error) {
+	defer i.observe("GetAPITokens", time.Now(), &err)
+	return i.storage.GetAPITokens(identity)
+}
+
+func (i *instrumentedStorage) DeleteAPIToken(identity, id string) (err error) {
+	defer i.observe("DeleteAPIToken", time.Now(), &err)
+	return i.storage.DeleteAPIToken(identity, id)
+}
+
+func (i *instrumentedStorage) TouchAPIToken(hash string, lastUsed time.Time) (err error) {
+	defer i.observe("TouchAPIToken", time.Now(), &err)
+	return i.storage.TouchAPIToken(hash, lastUsed)
+}
+
+func (i *instrumentedStorage) CreateSession(identity string, session shared.Session) (err error) {
+	defer i.observe("CreateSession", time.Now(), &err)
+	return i.storage.CreateSession(identity, session)
+}
+
+func (i *instrumentedStorage) GetSession(id string) (session *shared.Session, err error) {
+	defer i.observe("GetSession", time.Now(), &err)
+	return i.storage.GetSession(id)
+}
+
+func (i *instrumentedStorage) UpdateSession(id string, update func(*shared.Session) error) (err error) {
+	defer i.observe("UpdateSession", time.Now(), &err)
+	return i.storage.UpdateSession(id, update)
+}
+
+func (i *instrumentedStorage) DeleteSession(id string) (err error) {
+	defer i.observe("DeleteSession", time.Now(), &err)
+	return i.storage.DeleteSession(id)
+}
+
+func (i *instrumentedStorage) DeleteUserSessions(identity string) (err error) {
+	defer i.observe("DeleteUserSessions", time.Now(), &err)
+	return i.storage.DeleteUserSessions(identity)
+}
+
+func (i *instrumentedStorage) Close() (err error) {
+	defer i.observe("Close", time.Now(), &err)
+	return i.storage.Close()
+}
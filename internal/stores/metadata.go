@@ -0,0 +1,91 @@
+package stores
+
+import (
+	"context"
+	"time"
+
+	"github.com/mxschmitt/golang-url-shortener/internal/metadata"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/mxschmitt/golang-url-shortener/internal/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrMetadataDisabled is returned when the metadata of an entry should be
+// refreshed but fetching it is disabled
+var ErrMetadataDisabled = errors.New("fetching the metadata of pages is disabled")
+
+// ErrFetchingMetadataFailed is the cause of the errors of fetching the target page of an entry
+var ErrFetchingMetadataFailed = errors.New("the target page could not be fetched")
+
+// newMetadataFetcher returns the fetcher of the metadata of the target pages
+// of entries, or nil if it is disabled
+func newMetadataFetcher() (*metadata.Fetcher, error) {
+	conf := util.GetConfig().Metadata
+	if !conf.Enabled {
+		return nil, nil
+	}
+	timeout, err := parseDurationOr(conf.Timeout, 5*time.Second)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse timeout")
+	}
+	maxSize := int64(conf.MaxSize)
+	if maxSize <= 0 {
+		maxSize = 1 << 20
+	}
+	return metadata.New(timeout, maxSize, conf.AllowPrivate), nil
+}
+
+// fetchMetadataInBackground fetches the metadata of the target pages of new
+// entries one after another without delaying their creation, the fetch is
+// canceled when the store is closed
+func (s *Store) fetchMetadataInBackground(ids ...string) {
+	if s.metadata == nil {
+		return
+	}
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-s.stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		for _, id := range ids {
+			if ctx.Err() != nil {
+				return
+			}
+			if _, err := s.RefreshMetadata(ctx, id); err != nil {
+				logrus.Debugf("could not fetch metadata of entry %s: %v", id, err)
+			}
+		}
+	}()
+}
+
+// RefreshMetadata fetches the metadata of the target page of an entry again
+// and stores it on the entry
+func (s *Store) RefreshMetadata(ctx context.Context, id string) (*shared.PageMetadata, error) {
+	if s.metadata == nil {
+		return nil, ErrMetadataDisabled
+	}
+	entry, err := s.storage.GetEntryByID(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get entry")
+	}
+	pageMetadata, err := s.metadata.Fetch(ctx, entry.Public.URL)
+	if err != nil {
+		return nil, errors.Wrap(ErrFetchingMetadataFailed, err.Error())
+	}
+	err = s.storage.UpdateEntry(id, func(entry *shared.Entry) error {
+		entry.Public.Metadata = pageMetadata
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not update entry")
+	}
+	return pageMetadata, nil
+}
@@ -0,0 +1,112 @@
+package stores
+
+import (
+	"time"
+
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/mxschmitt/golang-url-shortener/internal/util"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidPassword is returned when the given password of a protected entry is wrong
+var ErrInvalidPassword = errors.New("the given password is not correct")
+
+// ErrTooManyAttempts is returned when a protected entry is throttled
+// because of too many failed password attempts
+var ErrTooManyAttempts = errors.New("too many failed password attempts")
+
+// maxPasswordBackoff caps the exponential backoff if no lockout is configured
+const maxPasswordBackoff = 24 * time.Hour
+
+// passwordProtection holds the parsed throttling settings for
+// password protected entries
+type passwordProtection struct {
+	freeAttempts, maxAttempts int
+	backoffBase, lockout      time.Duration
+}
+
+func newPasswordProtection() (passwordProtection, error) {
+	conf := util.GetConfig().PasswordProtection
+	p := passwordProtection{
+		freeAttempts: conf.FreeAttempts,
+		maxAttempts:  conf.MaxAttempts,
+	}
+	var err error
+	if conf.BackoffBase != "" {
+		if p.backoffBase, err = time.ParseDuration(conf.BackoffBase); err != nil {
+			return p, errors.Wrap(err, "could not parse backoff base")
+		}
+	}
+	if conf.LockoutDuration != "" {
+		if p.lockout, err = time.ParseDuration(conf.LockoutDuration); err != nil {
+			return p, errors.Wrap(err, "could not parse lockout duration")
+		}
+	}
+	return p, nil
+}
+
+// waitTime returns how long a key has to wait until the next
+// attempt is allowed. Once the free attempts are used up the wait
+// time doubles with every failure until the key is locked out.
+func (p passwordProtection) waitTime(attempts *shared.Attempts) time.Duration {
+	var wait time.Duration
+	switch {
+	case p.maxAttempts > 0 && attempts.Count >= p.maxAttempts:
+		wait = p.lockout
+	case attempts.Count >= p.freeAttempts && p.backoffBase > 0:
+		// doubled step by step, so that it can't overflow
+		wait = p.backoffBase
+		for i := attempts.Count - p.freeAttempts; i > 0 && wait < maxPasswordBackoff; i-- {
+			wait *= 2
+		}
+		if wait > maxPasswordBackoff {
+			wait = maxPasswordBackoff
+		}
+		if p.lockout > 0 && wait > p.lockout {
+			wait = p.lockout
+		}
+	}
+	return time.Until(attempts.LastAttempt.Add(wait))
+}
+
+// expiration returns how long failed attempts are remembered
+func (p passwordProtection) expiration() time.Duration {
+	if p.lockout > 0 {
+		return p.lockout
+	}
+	return time.Hour
+}
+
+// CheckPassword validates the password of a protected entry. Failed
+// attempts are throttled per client IP and per entry with an exponential
+// backoff, after too many failures both are locked out for a while. Every
+// attempt is registered before the password is compared, so that concurrent
+// attempts can't pass the throttling together, and forgotten if it succeeds.
+func (s *Store) CheckPassword(id, clientIP string, entry *shared.Entry, password string) error {
+	keys := []string{"ip:" + clientIP, "id:" + id}
+	allow := func(attempts *shared.Attempts) bool {
+		return s.passwordProtection.waitTime(attempts) <= 0
+	}
+	for _, key := range keys {
+		reserved, err := s.storage.ReserveAttempt(key, s.passwordProtection.expiration(), allow)
+		if err != nil {
+			return errors.Wrap(err, "could not reserve attempt")
+		}
+		if !reserved {
+			return ErrTooManyAttempts
+		}
+	}
+	if err := bcrypt.CompareHashAndPassword(entry.Password, []byte(password)); err != nil {
+		if err != bcrypt.ErrMismatchedHashAndPassword {
+			return errors.Wrap(err, "could not compare password")
+		}
+		return ErrInvalidPassword
+	}
+	for _, key := range keys {
+		if err := s.storage.ResetAttempts(key); err != nil {
+			return errors.Wrap(err, "could not reset attempts")
+		}
+	}
+	return nil
+}
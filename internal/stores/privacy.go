@@ -0,0 +1,85 @@
+package stores
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"time"
+
+	"github.com/mxschmitt/golang-url-shortener/internal/util"
+	"github.com/pkg/errors"
+)
+
+// Modes how the IP addresses of visitors are stored and logged
+const (
+	IPModeFull     = "full"
+	IPModeTruncate = "truncate"
+	IPModeHash     = "hash"
+	IPModeDrop     = "drop"
+)
+
+// ErrInvalidIPMode is returned when the configured IP mode is not supported
+var ErrInvalidIPMode = errors.New("the given IP mode is not valid, it has to be full, truncate, hash or drop")
+
+// privacy holds the parsed privacy settings which are
+// applied to the visitors before they are stored
+type privacy struct {
+	ipMode string
+}
+
+func newPrivacy() (privacy, error) {
+	switch mode := util.GetConfig().Privacy.IPMode; mode {
+	case "":
+		return privacy{ipMode: IPModeFull}, nil
+	case IPModeFull, IPModeTruncate, IPModeHash, IPModeDrop:
+		return privacy{ipMode: mode}, nil
+	default:
+		return privacy{}, ErrInvalidIPMode
+	}
+}
+
+// anonymizeIP applies the IP mode to the IP address of a visitor. Truncated
+// addresses keep their /24 or /48 network, hashed ones are keyed with a key
+// which is derived from the private key and rotated daily, so visitors can
+// only be recognized within the same day.
+func (p privacy) anonymizeIP(ip string, now time.Time) string {
+	switch p.ipMode {
+	case IPModeDrop:
+		return ""
+	case IPModeTruncate:
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return ""
+		}
+		if v4 := parsed.To4(); v4 != nil {
+			return v4.Mask(net.CIDRMask(24, 32)).String()
+		}
+		return parsed.Mask(net.CIDRMask(48, 128)).String()
+	case IPModeHash:
+		if ip == "" {
+			return ""
+		}
+		mac := hmac.New(sha256.New, dailyKey(now))
+		mac.Write([]byte(ip))
+		return hex.EncodeToString(mac.Sum(nil)[:16])
+	default:
+		return ip
+	}
+}
+
+// visitorFingerprint identifies a visitor within a day for the unique visitor
+// counting. It is keyed with the daily key, so neither the IP address nor the
+// User-Agent can be recovered and fingerprints of different days can't be linked.
+func visitorFingerprint(ip, userAgent string, now time.Time) []byte {
+	mac := hmac.New(sha256.New, dailyKey(now))
+	mac.Write([]byte(ip + "\n" + userAgent))
+	return mac.Sum(nil)
+}
+
+// dailyKey derives a key from the private key which changes every day (UTC)
+func dailyKey(now time.Time) []byte {
+	mac := hmac.New(sha256.New, util.GetPrivateKey())
+	mac.Write([]byte(now.UTC().Format("2006-01-02")))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,85 @@
+package redis
+
+import (
+	"encoding/json"
+
+	"github.com/go-redis/redis"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var auditKey = "audit" // audit log, newest first (redis LIST)
+
+// TransferEntry changes the owner of an entry with the given function and
+// moves it to the entries of the new owner. The entry, the path-to-user
+// mapping, the sets of entries of both users and the audit event which fn
+// returns are written in one transaction, which is retried if the entry or
+// its owner was modified concurrently.
+func (r *Store) TransferEntry(id, userIdentifier string, fn func(*shared.Entry) (*shared.AuditEvent, error)) error {
+	entryKey := entryPathPrefix + id
+	userKey := entryUserPrefix + id
+	for i := 0; i < 10; i++ {
+		err := r.c.Watch(func(tx *redis.Tx) error {
+			raw, err := tx.Get(entryKey).Bytes()
+			if err == redis.Nil {
+				return shared.ErrNoEntryFound
+			} else if err != nil {
+				return errors.Wrapf(err, "Could not get entry '%s'", id)
+			}
+			previousUser, err := tx.Get(userKey).Result()
+			if err != nil && err != redis.Nil {
+				return errors.Wrapf(err, "Could not fetch id to user mapping for id '%s'", id)
+			}
+			var entry shared.Entry
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return errors.Wrapf(err, "Could not unmarshal entry '%s'", id)
+			}
+			event, err := fn(&entry)
+			if err != nil {
+				return err
+			}
+			if raw, err = json.Marshal(entry); err != nil {
+				return errors.Wrapf(err, "Could not marshal entry '%s'", id)
+			}
+			rawEvent, err := json.Marshal(event)
+			if err != nil {
+				return errors.Wrap(err, "Could not marshal audit event")
+			}
+			_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+				pipe.Set(entryKey, raw, 0)
+				pipe.Set(userKey, userIdentifier, 0)
+				if previousUser != "" {
+					pipe.SRem(userToEntriesPrefix+previousUser, id)
+				}
+				pipe.SAdd(userToEntriesPrefix+userIdentifier, id)
+				pipe.LPush(auditKey, rawEvent)
+				return nil
+			})
+			return err
+		}, entryKey, userKey)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return errors.Errorf("Could not transfer entry '%s', it was modified concurrently", id)
+}
+
+// GetAuditEvents returns the latest events of the audit log, the newest first
+func (r *Store) GetAuditEvents(limit int) ([]shared.AuditEvent, error) {
+	values, err := r.c.LRange(auditKey, 0, int64(limit)-1).Result()
+	if err != nil {
+		msg := "Could not get audit events"
+		logrus.Error(msg)
+		return nil, errors.Wrap(err, msg)
+	}
+	events := make([]shared.AuditEvent, 0, len(values))
+	for _, raw := range values {
+		var event shared.AuditEvent
+		if err := json.Unmarshal([]byte(raw), &event); err != nil {
+			return nil, errors.Wrap(err, "Could not unmarshal audit event")
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
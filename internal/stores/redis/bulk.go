@@ -0,0 +1,115 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// CreateEntries creates the entries and returns the error of each entry whose
+// ID already exists. If atomic is set, the entries are created in a single
+// transaction and none of them is created if one of them can't be created.
+// Otherwise every entry is created unless its ID exists.
+func (r *Store) CreateEntries(entries []shared.NewEntry, atomic bool) ([]error, error) {
+	raws := make([][]byte, len(entries))
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		raw, err := json.Marshal(entry.Entry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not marshal entry %s", entry.ID)
+		}
+		raws[i] = raw
+		keys[i] = entryPathPrefix + entry.ID
+	}
+	var errs []error
+	var err error
+	if atomic {
+		errs, err = r.createEntriesAtomically(entries, raws, keys)
+	} else {
+		errs, err = r.createEntries(entries, raws, keys)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Could not create %d entries", len(entries))
+		logrus.Error(msg)
+		return nil, errors.Wrap(err, msg)
+	}
+	return errs, nil
+}
+
+// addEntries queues the commands which add the entries to the pipeline
+func addEntries(pipe redis.Pipeliner, entries []shared.NewEntry, raws [][]byte, errs []error) {
+	for i, entry := range entries {
+		if errs[i] != nil {
+			continue
+		}
+		pipe.Set(entryPathPrefix+entry.ID, raws[i], 0)
+		pipe.Set(entryUserPrefix+entry.ID, entry.Owner, 0)
+		pipe.SAdd(userToEntriesPrefix+entry.Owner, entry.ID)
+	}
+}
+
+// createEntriesAtomically creates all entries in a transaction if none of
+// them exists, it is retried if one of them was created concurrently
+func (r *Store) createEntriesAtomically(entries []shared.NewEntry, raws [][]byte, keys []string) ([]error, error) {
+	for attempt := 0; attempt < 10; attempt++ {
+		errs := make([]error, len(entries))
+		err := r.c.Watch(func(tx *redis.Tx) error {
+			existing, err := tx.MGet(keys...).Result()
+			if err != nil {
+				return errors.Wrap(err, "Could not check existence of entries")
+			}
+			failed := false
+			for i, value := range existing {
+				if value != nil {
+					errs[i] = shared.ErrEntryAlreadyExists
+					failed = true
+				}
+			}
+			if failed {
+				return nil
+			}
+			_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+				addEntries(pipe, entries, raws, errs)
+				return nil
+			})
+			return err
+		}, keys...)
+		if err != redis.TxFailedErr {
+			return errs, err
+		}
+	}
+	return nil, errors.New("the entries were modified concurrently")
+}
+
+// createEntries reserves the IDs of the entries with SETNX and creates the
+// ones whose IDs were not taken
+func (r *Store) createEntries(entries []shared.NewEntry, raws [][]byte, keys []string) ([]error, error) {
+	errs := make([]error, len(entries))
+	reservations := make([]*redis.BoolCmd, len(entries))
+	_, err := r.c.Pipelined(func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			reservations[i] = pipe.SetNX(key, raws[i], 0)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not reserve IDs of entries")
+	}
+	for i, reservation := range reservations {
+		if !reservation.Val() {
+			errs[i] = shared.ErrEntryAlreadyExists
+		}
+	}
+	_, err = r.c.TxPipelined(func(pipe redis.Pipeliner) error {
+		addEntries(pipe, entries, raws, errs)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not add entries")
+	}
+	return errs, nil
+}
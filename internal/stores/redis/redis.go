@@ -3,6 +3,7 @@ package redis
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis"
@@ -12,15 +13,26 @@ import (
 )
 
 var (
-	entryPathPrefix     = "entry:"       // prefix for path-to-url mappings
-	entryUserPrefix     = "user:"        // prefix for path-to-user mappings
-	userToEntriesPrefix = "userEntries:" // prefix for user-to-[]entries mappings (redis SET)
-	entryVisitsPrefix   = "entryVisits:" // prefix for entry-to-[]visit mappings (redis LIST)
+	entryPathPrefix     = "entry:"         // prefix for path-to-url mappings
+	entryUserPrefix     = "user:"          // prefix for path-to-user mappings
+	userToEntriesPrefix = "userEntries:"   // prefix for user-to-[]entries mappings (redis SET)
+	entryVisitsPrefix   = "entryVisits:"   // prefix for entry-to-[]visit mappings (redis LIST)
+	attemptsPrefix      = "attempts:"      // prefix for failed password attempts (redis HASH)
+	entryRollupsPrefix  = "entryRollups:"  // prefix for entry-to-rollup counters (redis HASH)
+	entryCounterPrefix  = "entryCounter:"  // prefix for entry visit count and last visit (redis HASH)
+	entryBotsPrefix     = "entryBots:"     // prefix for entry-to-[]bot visit mappings (redis LIST)
+	entryUniquesPrefix  = "entryUniques:"  // prefix for entry-and-day to unique visitors mappings (redis HyperLogLog)
+	entrySketchesPrefix = "entrySketches:" // prefix for entry-to-[]unique visitors keys mappings (redis SET)
+	markerPrefix        = "marker:"        // prefix for markers which expire after a TTL (redis STRING)
+	visitsChannelPrefix = "visits:"        // prefix for the pub/sub channel of visit events, the db index is appended
 )
 
 // Store implements the stores.Storage interface
 type Store struct {
-	c *redis.Client
+	c             *redis.Client
+	broker        *shared.Broker
+	pubsub        *redis.PubSub
+	visitsChannel string
 }
 
 // New initializes connection to the redis instance.
@@ -46,10 +58,55 @@ func New(hostaddr, password string, db int, maxRetries int, readTimeout string,
 	if _, err = c.Ping().Result(); err != nil {
 		return nil, errors.Wrap(err, "Could not connect to redis db0")
 	}
-	ret := &Store{c: c}
+	ret := &Store{
+		c:             c,
+		broker:        shared.NewBroker(),
+		visitsChannel: visitsChannelPrefix + strconv.Itoa(db),
+	}
+	// pub/sub channels are shared between all databases, so the channel
+	// is scoped by the db index
+	ret.pubsub = c.Subscribe(ret.visitsChannel)
+	if _, err = ret.pubsub.Receive(); err != nil {
+		return nil, errors.Wrap(err, "Could not subscribe to the visits channel")
+	}
+	go ret.forwardVisits()
 	return ret, nil
 }
 
+// forwardVisits passes the visit events of all instances
+// from the redis channel to the local subscribers
+func (r *Store) forwardVisits() {
+	for msg := range r.pubsub.Channel() {
+		var event shared.VisitEvent
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			logrus.Warnf("Could not unmarshal visit event: %v", err)
+			continue
+		}
+		r.broker.Publish(event)
+	}
+}
+
+// PublishVisit publishes a visit event on the redis channel,
+// so that the subscribers of every instance receive it.
+func (r *Store) PublishVisit(event shared.VisitEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "Could not marshal visit event")
+	}
+	if err := r.c.Publish(r.visitsChannel, data).Err(); err != nil {
+		msg := fmt.Sprintf("Could not publish visit event for ID %s", event.ID)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	return nil
+}
+
+// SubscribeVisits returns a channel which receives the visit events of all
+// instances and a function which has to be called to unsubscribe.
+func (r *Store) SubscribeVisits() (<-chan shared.VisitEvent, func()) {
+	return r.broker.Subscribe()
+}
+
 // keyExists checks for the existence of a key in redis.
 func (r *Store) keyExists(key string) (exists bool, err error) {
 	logrus.Debugf("Checking for existence of key: %s", key)
@@ -180,6 +237,27 @@ func (r *Store) DeleteEntry(id string) error {
 		logrus.Error(msg)
 		return errors.Wrap(err, msg)
 	}
+	// delete the rollups, the visit counter and the bot visits for the id
+	if err = r.c.Del(entryRollupsPrefix+id, entryCounterPrefix+id, entryBotsPrefix+id).Err(); err != nil {
+		msg := fmt.Sprintf("Could not delete counters for id %s: %v", id, err)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+
+	// delete the unique visitor sketches for the id, their keys are kept in
+	// a set since a pattern of the id could match the keys of other entries
+	sketchesKey := entrySketchesPrefix + id
+	sketches, err := r.c.SMembers(sketchesKey).Result()
+	if err != nil {
+		msg := fmt.Sprintf("Could not get unique visitors keys for id %s: %v", id, err)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	if err = r.c.Del(append(sketches, sketchesKey)...).Err(); err != nil {
+		msg := fmt.Sprintf("Could not delete unique visitors for id %s: %v", id, err)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
 
 	// get the user for the id
 	userKey := entryUserPrefix + id
@@ -239,21 +317,32 @@ func (r *Store) GetEntryByID(id string) (*shared.Entry, error) {
 	// from the redis sources (we do this so we don't have to rewrite
 	// the entry every time someone visits which is madness)
 	//
-	// first, the visit count is just the length of the visitors list
+	// the counter hash is maintained by IncreaseVisitCounter, entries which
+	// were visited before it existed fall back to the visitors list
 	entryVisitsKey := entryVisitsPrefix + id
-	visitCount, err := r.c.LLen(entryVisitsKey).Result()
+	counter, err := r.c.HGetAll(entryCounterPrefix + id).Result()
 	if err != nil {
+		logrus.Warnf("Could not get visit counter for id '%s': '%v'", id, err)
+	}
+	if total, err := strconv.Atoi(counter["total"]); err == nil {
+		entry.Public.VisitCount = total
+	} else if visitCount, err := r.c.LLen(entryVisitsKey).Result(); err != nil {
 		logrus.Warnf("Could not get length of visitor list for id '%s': '%v'", id, err)
 		entry.Public.VisitCount = int(0) // or zero if nobody's visited, that's fine.
 	} else {
 		entry.Public.VisitCount = int(visitCount)
 	}
 
-	// grab the timestamp out of the last visitor on the list
+	if bots, err := strconv.Atoi(counter["bots"]); err == nil {
+		entry.Public.BotVisitCount = bots
+	}
+
+	// grab the timestamp out of the counter or the last visitor on the list
 	var visitor *shared.Visitor
 	lastVisit := time.Time(time.Unix(0, 0)) // default to start-of-epoch if we can't figure it out
-	raw, err = r.c.LIndex(entryVisitsKey, 0).Bytes()
-	if err != nil {
+	if last, err := time.Parse(time.RFC3339Nano, counter["last"]); err == nil {
+		lastVisit = last
+	} else if raw, err = r.c.LIndex(entryVisitsKey, 0).Bytes(); err != nil {
 		logrus.Warnf("Could not fetch visitor list for entry '%s': %v", id, err)
 	} else {
 		err = json.Unmarshal(raw, &visitor)
@@ -295,7 +384,68 @@ func (r *Store) GetUserEntries(userIdentifier string) (map[string]shared.Entry,
 	return entries, nil
 }
 
-// RegisterVisitor adds a shared.Visitor to the list of visits for a path.
+// UpdateEntry changes an entry with the given function, the change is
+// retried if the entry was modified concurrently.
+func (r *Store) UpdateEntry(id string, fn func(*shared.Entry) error) error {
+	entryKey := entryPathPrefix + id
+	for i := 0; i < 10; i++ {
+		err := r.c.Watch(func(tx *redis.Tx) error {
+			raw, err := tx.Get(entryKey).Bytes()
+			if err == redis.Nil {
+				return shared.ErrNoEntryFound
+			} else if err != nil {
+				return errors.Wrapf(err, "Could not get entry '%s'", id)
+			}
+			var entry shared.Entry
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return errors.Wrapf(err, "Could not unmarshal entry '%s'", id)
+			}
+			if err := fn(&entry); err != nil {
+				return err
+			}
+			if raw, err = json.Marshal(entry); err != nil {
+				return errors.Wrapf(err, "Could not marshal entry '%s'", id)
+			}
+			_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+				pipe.Set(entryKey, raw, 0)
+				return nil
+			})
+			return err
+		}, entryKey)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return errors.Errorf("Could not update entry '%s', it was modified concurrently", id)
+}
+
+// IterateEntries calls fn for every entry, the entries are scanned so
+// they are not loaded into memory at once.
+func (r *Store) IterateEntries(fn func(string, shared.Entry) error) error {
+	iter := r.c.Scan(0, entryPathPrefix+"*", visitorsPageSize).Iterator()
+	for iter.Next() {
+		id := iter.Val()[len(entryPathPrefix):]
+		entry, err := r.GetEntryByID(id)
+		if err == shared.ErrNoEntryFound {
+			// deleted since it was scanned
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := fn(id, *entry); err != nil {
+			return err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		msg := "Could not scan entries"
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	return nil
+}
+
+// RegisterVisitor adds a shared.Visitor to the list of visits for a path
+// and increases the rollup counters of it.
 func (r *Store) RegisterVisitor(id, visitID string, visitor shared.Visitor) error {
 	data, err := json.Marshal(visitor)
 	if err != nil {
@@ -303,15 +453,177 @@ func (r *Store) RegisterVisitor(id, visitID string, visitor shared.Visitor) erro
 		logrus.Error(msg)
 		return errors.Wrap(err, msg)
 	}
-	// push the visit data onto a redis list who's key is the url id
-	key := entryVisitsPrefix + id
-	result := r.c.LPush(key, data)
-	if result.Err() != nil {
+	// push the visit data onto a redis list who's key is the url id and
+	// increase the rollups in the same transaction
+	pipe := r.c.TxPipeline()
+	pipe.LPush(entryVisitsPrefix+id, data)
+	for _, counter := range shared.RollupCounters(visitor) {
+		pipe.HIncrBy(entryRollupsPrefix+id, counter, 1)
+	}
+	if _, err := pipe.Exec(); err != nil {
 		msg := fmt.Sprintf("Could not register visitor for ID %s", id)
 		logrus.Error(msg)
-		return errors.Wrap(result.Err(), msg)
+		return errors.Wrap(err, msg)
 	}
-	return err
+	return nil
+}
+
+// GetRollups returns the rollup counters of a path.
+func (r *Store) GetRollups(id string) (map[string]int, error) {
+	result, err := r.c.HGetAll(entryRollupsPrefix + id).Result()
+	if err != nil {
+		msg := fmt.Sprintf("Could not get rollups for id '%s'", id)
+		logrus.Error(msg)
+		return nil, errors.Wrap(err, msg)
+	}
+	rollups := make(map[string]int, len(result))
+	for counter, value := range result {
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			logrus.Warnf("Could not parse rollup counter '%s' of id '%s': %v", counter, id, err)
+			continue
+		}
+		rollups[counter] = count
+	}
+	return rollups, nil
+}
+
+// AddRollups adds the given counts to the rollup counters of a path.
+func (r *Store) AddRollups(id string, counters map[string]int) error {
+	if len(counters) == 0 {
+		return nil
+	}
+	pipe := r.c.TxPipeline()
+	for counter, count := range counters {
+		pipe.HIncrBy(entryRollupsPrefix+id, counter, int64(count))
+	}
+	if _, err := pipe.Exec(); err != nil {
+		msg := fmt.Sprintf("Could not add rollups for ID %s", id)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	return nil
+}
+
+// PruneVisitors removes all visits which happened before the given time from
+// the visitors and bot visitors lists. As new visits are pushed to the head of
+// the lists, the oldest ones are popped from their tail until a newer one is found.
+func (r *Store) PruneVisitors(before time.Time) (int, error) {
+	pruned := 0
+	for _, prefix := range []string{entryVisitsPrefix, entryBotsPrefix} {
+		iter := r.c.Scan(0, prefix+"*", visitorsPageSize).Iterator()
+		for iter.Next() {
+			count, err := r.pruneList(iter.Val(), before)
+			pruned += count
+			if err != nil {
+				return pruned, err
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return pruned, errors.Wrap(err, "could not scan visitor lists")
+		}
+	}
+	return pruned, nil
+}
+
+// pruneList pops all visits which happened before the given time from the tail of a list.
+func (r *Store) pruneList(key string, before time.Time) (int, error) {
+	pruned := 0
+	for {
+		raw, err := r.c.LIndex(key, -1).Bytes()
+		if err == redis.Nil {
+			return pruned, nil
+		} else if err != nil {
+			return pruned, errors.Wrapf(err, "could not get oldest visitor of '%s'", key)
+		}
+		var visitor shared.Visitor
+		if err := json.Unmarshal(raw, &visitor); err != nil {
+			return pruned, errors.Wrapf(err, "could not unmarshal oldest visitor of '%s'", key)
+		}
+		if !visitor.Timestamp.Before(before) {
+			return pruned, nil
+		}
+		if err := r.c.RPop(key).Err(); err != nil {
+			return pruned, errors.Wrapf(err, "could not prune visitor of '%s'", key)
+		}
+		pruned++
+	}
+}
+
+// RegisterBotVisitor adds a visit of a bot to the bot visitors list of a
+// path and increases its bot visit counter.
+func (r *Store) RegisterBotVisitor(id, visitID string, visitor shared.Visitor) error {
+	data, err := json.Marshal(visitor)
+	if err != nil {
+		msg := fmt.Sprintf("Could not marshal JSON for entry %s, visitID %s", id, visitID)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	pipe := r.c.TxPipeline()
+	pipe.LPush(entryBotsPrefix+id, data)
+	pipe.HIncrBy(entryCounterPrefix+id, "bots", 1)
+	if _, err := pipe.Exec(); err != nil {
+		msg := fmt.Sprintf("Could not register bot visitor for ID %s", id)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	return nil
+}
+
+// AddUniqueVisitor adds the fingerprint of a visitor to the unique
+// visitors HyperLogLog of a path for the given day. The key of the
+// HyperLogLog is remembered, so that it is deleted with the path.
+func (r *Store) AddUniqueVisitor(id string, day time.Time, fingerprint []byte) error {
+	key := entryUniquesPrefix + id + ":" + shared.UniquesDay(day)
+	pipe := r.c.TxPipeline()
+	pipe.PFAdd(key, fingerprint)
+	pipe.SAdd(entrySketchesPrefix+id, key)
+	if _, err := pipe.Exec(); err != nil {
+		msg := fmt.Sprintf("Could not add unique visitor for ID %s", id)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	return nil
+}
+
+// CountUniqueVisitors returns the approximate number of unique visitors
+// of a path over the given days.
+func (r *Store) CountUniqueVisitors(id string, days []time.Time) (int, error) {
+	if len(days) == 0 {
+		return 0, nil
+	}
+	keys := make([]string, len(days))
+	for i, day := range days {
+		keys[i] = entryUniquesPrefix + id + ":" + shared.UniquesDay(day)
+	}
+	count, err := r.c.PFCount(keys...).Result()
+	if err != nil {
+		msg := fmt.Sprintf("Could not count unique visitors for ID %s", id)
+		logrus.Error(msg)
+		return 0, errors.Wrap(err, msg)
+	}
+	return int(count), nil
+}
+
+// GetBotVisitors returns the full list of bot visitors for a path.
+func (r *Store) GetBotVisitors(id string) ([]shared.Visitor, error) {
+	visitors := []shared.Visitor{}
+	result, err := r.c.LRange(entryBotsPrefix+id, 0, -1).Result()
+	if err != nil {
+		msg := fmt.Sprintf("Could not get bot visitors for id '%s'", id)
+		logrus.Error(msg)
+		return nil, errors.Wrap(err, msg)
+	}
+	for _, v := range result {
+		var value shared.Visitor
+		if err := json.Unmarshal([]byte(v), &value); err != nil {
+			msg := fmt.Sprintf("Could not unmarshal json for bot visit '%s': %v", id, err)
+			logrus.Error(msg)
+			return nil, errors.Wrap(err, msg)
+		}
+		visitors = append(visitors, value)
+	}
+	return visitors, nil
 }
 
 // GetVisitors returns the full list of visitors for a path.
@@ -338,20 +650,159 @@ func (r *Store) GetVisitors(id string) ([]shared.Visitor, error) {
 	return visitors, nil
 }
 
-// IncreaseVisitCounter is a no-op and returns nil for all values.
-//
-// This function is unnecessary for the redis backend: we already
-// have a redis LIST of visitors, and we can derive the visit count
-// by calling redis.client.LLen(list) (which is a constant-time op)
-// during GetEntryByID().  If we want the timestamp of the most recent
-// visit we can pull the most recent visit off with redis.client.LIndex(0)
-// (also constant-time) and reading the timetamp field.
+// visitorsPageSize is the amount of visitors which are fetched at once
+// when iterating over the visitors list of an entry
+const visitorsPageSize = 1000
+
+// IterateVisitors calls fn for every visitor of a path, oldest first. The
+// visitors list is fetched in pages from its tail, so it is never loaded into
+// memory at once and new visits which are pushed to its head don't shift it.
+func (r *Store) IterateVisitors(id string, fn func(shared.Visitor) error) error {
+	key := entryVisitsPrefix + id
+	for end := int64(-1); ; end -= visitorsPageSize {
+		result, err := r.c.LRange(key, end-visitorsPageSize+1, end).Result()
+		if err != nil {
+			msg := fmt.Sprintf("Could not get visitors for id '%s'", id)
+			logrus.Error(msg)
+			return errors.Wrap(err, msg)
+		}
+		for i := len(result) - 1; i >= 0; i-- {
+			var value shared.Visitor
+			if err := json.Unmarshal([]byte(result[i]), &value); err != nil {
+				msg := fmt.Sprintf("Could not unmarshal json for visit '%s': %v", id, err)
+				logrus.Error(msg)
+				return errors.Wrap(err, msg)
+			}
+			if err := fn(value); err != nil {
+				return err
+			}
+		}
+		if len(result) < visitorsPageSize {
+			return nil
+		}
+	}
+}
+
+// IncreaseVisitCounter increases the visit count and sets the last visit of
+// a path. The visitors list can't be used for that, since it gets pruned.
+// Entries which were visited before the counter existed are initialized
+// with the length of their visitors list.
 func (r *Store) IncreaseVisitCounter(id string) error {
+	key := entryCounterPrefix + id
+	exists, err := r.c.HExists(key, "total").Result()
+	if err != nil {
+		return errors.Wrapf(err, "could not check visit counter of '%s'", id)
+	}
+	if !exists {
+		visitCount, err := r.c.LLen(entryVisitsPrefix + id).Result()
+		if err != nil {
+			return errors.Wrapf(err, "could not get length of visitor list for id '%s'", id)
+		}
+		if err := r.c.HSetNX(key, "total", visitCount).Err(); err != nil {
+			return errors.Wrapf(err, "could not initialize visit counter of '%s'", id)
+		}
+	}
+	pipe := r.c.TxPipeline()
+	pipe.HIncrBy(key, "total", 1)
+	pipe.HSet(key, "last", time.Now().Format(time.RFC3339Nano))
+	if _, err := pipe.Exec(); err != nil {
+		msg := fmt.Sprintf("Could not increase visit counter for ID %s", id)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
 	return nil
 }
 
+// ReserveAttempt registers an attempt of a given throttling key if allow
+// permits it for the previous attempts. The check and the registration are
+// done in one transaction, which is retried if the key was modified
+// concurrently. The redis key expires after the given expiration, so the
+// attempts are forgotten.
+func (r *Store) ReserveAttempt(key string, expiration time.Duration, allow func(*shared.Attempts) bool) (bool, error) {
+	attemptsKey := attemptsPrefix + key
+	for i := 0; i < 10; i++ {
+		reserved := false
+		err := r.c.Watch(func(tx *redis.Tx) error {
+			fields, err := tx.HGetAll(attemptsKey).Result()
+			if err != nil {
+				return errors.Wrapf(err, "could not get attempts for key '%s'", key)
+			}
+			attempts, err := parseAttempts(fields)
+			if err != nil {
+				return err
+			}
+			if !allow(attempts) {
+				return nil
+			}
+			_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+				pipe.HSet(attemptsKey, "count", attempts.Count+1)
+				pipe.HSet(attemptsKey, "last", time.Now().UnixNano())
+				pipe.Expire(attemptsKey, expiration)
+				return nil
+			})
+			reserved = err == nil
+			return err
+		}, attemptsKey)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			msg := fmt.Sprintf("Could not reserve attempt for key '%s': %v", key, err)
+			logrus.Error(msg)
+			return false, errors.Wrap(err, msg)
+		}
+		return reserved, nil
+	}
+	return false, errors.Errorf("Could not reserve attempt for key '%s', it was modified concurrently", key)
+}
+
+// ResetAttempts forgets the failed attempts of a given throttling key.
+func (r *Store) ResetAttempts(key string) error {
+	if err := r.c.Del(attemptsPrefix + key).Err(); err != nil {
+		msg := fmt.Sprintf("Could not reset attempts for key '%s': %v", key, err)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	return nil
+}
+
+// SetIfAbsent sets a marker with the given TTL if it is not set yet
+// and reports if the marker was set.
+func (r *Store) SetIfAbsent(key string, ttl time.Duration) (bool, error) {
+	set, err := r.c.SetNX(markerPrefix+key, 1, ttl).Result()
+	if err != nil {
+		msg := fmt.Sprintf("Could not set marker '%s': %v", key, err)
+		logrus.Error(msg)
+		return false, errors.Wrap(err, msg)
+	}
+	return set, nil
+}
+
+// parseAttempts converts the fields of an attempts HASH into shared.Attempts.
+func parseAttempts(fields map[string]string) (*shared.Attempts, error) {
+	attempts := &shared.Attempts{}
+	if len(fields) == 0 {
+		return attempts, nil
+	}
+	count, err := strconv.Atoi(fields["count"])
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse attempts count")
+	}
+	last, err := strconv.ParseInt(fields["last"], 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse last attempt")
+	}
+	attempts.Count = count
+	attempts.LastAttempt = time.Unix(0, last)
+	return attempts, nil
+}
+
 // Close closes the connection to redis.
 func (r *Store) Close() error {
+	if err := r.pubsub.Close(); err != nil {
+		logrus.Warnf("Could not close the visits subscription: %v", err)
+	}
+	r.broker.Close()
 	err := r.c.Close()
 	if err != nil {
 		msg := "Cloud not close the redis connection"
@@ -0,0 +1,124 @@
+package redis
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+)
+
+func newTestStore(t *testing.T) *Store {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start redis server: %v", err)
+	}
+	t.Cleanup(server.Close)
+	store, err := New(server.Addr(), "", 0, 0, "3s", "3s")
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestCreateAndDeleteEntry(t *testing.T) {
+	store := newTestStore(t)
+	entry := shared.Entry{
+		Public: shared.EntryPublicData{
+			URL: "https://google.com",
+		},
+	}
+	if err := store.CreateEntry(entry, "such-a-great-id", "google12345678"); err != nil {
+		t.Fatalf("could not create entry: %v", err)
+	}
+	if err := store.CreateEntry(entry, "such-a-great-id", "google12345678"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected an already exists error when creating a duplicate; got: %v", err)
+	}
+	if err := store.IncreaseVisitCounter("such-a-great-id"); err != nil {
+		t.Fatalf("could not increase visit counter: %v", err)
+	}
+	if err := store.RegisterVisitor("such-a-great-id", "visit", shared.Visitor{IP: "203.0.113.6"}); err != nil {
+		t.Fatalf("could not register visitor: %v", err)
+	}
+	got, err := store.GetEntryByID("such-a-great-id")
+	if err != nil {
+		t.Fatalf("could not get entry: %v", err)
+	}
+	if got.Public.VisitCount != 1 {
+		t.Errorf("expected a visit count of 1; got: %d", got.Public.VisitCount)
+	}
+	if err := store.DeleteEntry("such-a-great-id"); err != nil {
+		t.Fatalf("could not delete entry: %v", err)
+	}
+	if _, err := store.GetEntryByID("such-a-great-id"); errors.Cause(err) != shared.ErrNoEntryFound {
+		t.Errorf("error is not expected one: %v", err)
+	}
+	entries, err := store.GetUserEntries("google12345678")
+	if err != nil {
+		t.Fatalf("could not get user entries: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no entries after the deletion; got: %d", len(entries))
+	}
+}
+
+func TestClaimDeliveries(t *testing.T) {
+	store := newTestStore(t)
+	now := time.Now()
+	delivery := shared.WebhookDelivery{ID: "delivery", UserIdentifier: "google12345678", Status: shared.DeliveryPending, NextAttempt: now, CreatedOn: now}
+	if err := store.SaveDelivery(delivery); err != nil {
+		t.Fatalf("could not save delivery: %v", err)
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var claimed []shared.WebhookDelivery
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			deliveries, err := store.ClaimDeliveries(now, time.Minute, 10)
+			if err != nil {
+				t.Errorf("could not claim deliveries: %v", err)
+			}
+			mu.Lock()
+			claimed = append(claimed, deliveries...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if len(claimed) != 1 || claimed[0].ID != delivery.ID {
+		t.Fatalf("delivery was not claimed once: %+v", claimed)
+	}
+	// the delivery stays queued until the lease ends
+	if deliveries, err := store.ClaimDeliveries(now.Add(2*time.Minute), time.Minute, 10); err != nil || len(deliveries) != 1 {
+		t.Fatalf("delivery was not requeued after the lease: %+v, %v", deliveries, err)
+	}
+}
+
+func TestDeleteEntryUniques(t *testing.T) {
+	store := newTestStore(t)
+	day := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, id := range []string{"a", "a:b", "*"} {
+		if err := store.CreateEntry(shared.Entry{}, id, "google12345678"); err != nil {
+			t.Fatalf("could not create entry %s: %v", id, err)
+		}
+		if err := store.AddUniqueVisitor(id, day, []byte("visitor")); err != nil {
+			t.Fatalf("could not add unique visitor of %s: %v", id, err)
+		}
+	}
+	for _, id := range []string{"*", "a"} {
+		if err := store.DeleteEntry(id); err != nil {
+			t.Fatalf("could not delete entry %s: %v", id, err)
+		}
+		if count, err := store.CountUniqueVisitors(id, []time.Time{day}); err != nil || count != 0 {
+			t.Fatalf("unique visitors of %s were not deleted: %d, %v", id, count, err)
+		}
+	}
+	if count, err := store.CountUniqueVisitors("a:b", []time.Time{day}); err != nil || count != 1 {
+		t.Fatalf("unique visitors of another entry were deleted: %d, %v", count, err)
+	}
+}
@@ -0,0 +1,99 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	searchIndexPrefix = "searchIndex:" // prefix for owner-to-'term\x00id' mappings, ordered lexicographically (redis ZSET)
+	searchTermsPrefix = "searchTerms:" // prefix for the owner and the terms of an indexed entry (redis STRING)
+)
+
+// indexedEntry is the owner and the terms under which an entry is indexed,
+// they are needed to remove the entry from the index again
+type indexedEntry struct {
+	Owner string
+	Terms []string
+}
+
+// indexMember is the member of a term of an entry in the index of its owner,
+// the terms only consist of letters and digits so the separator is unique
+func indexMember(term, id string) string {
+	return term + "\x00" + id
+}
+
+// IndexEntry replaces the terms under which an entry is found in the search
+// index of its owner, without an owner the entry is removed from the index.
+// The change is retried if the entry was indexed concurrently.
+func (r *Store) IndexEntry(id, owner string, terms []string) error {
+	termsKey := searchTermsPrefix + id
+	for i := 0; i < 10; i++ {
+		err := r.c.Watch(func(tx *redis.Tx) error {
+			var previous indexedEntry
+			raw, err := tx.Get(termsKey).Bytes()
+			if err != nil && err != redis.Nil {
+				return errors.Wrapf(err, "Could not get indexed entry '%s'", id)
+			} else if err == nil {
+				if err := json.Unmarshal(raw, &previous); err != nil {
+					return errors.Wrapf(err, "Could not unmarshal indexed entry '%s'", id)
+				}
+			}
+			if raw, err = json.Marshal(indexedEntry{Owner: owner, Terms: terms}); err != nil {
+				return errors.Wrapf(err, "Could not marshal indexed entry '%s'", id)
+			}
+			_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+				for _, term := range previous.Terms {
+					pipe.ZRem(searchIndexPrefix+previous.Owner, indexMember(term, id))
+				}
+				if owner == "" {
+					pipe.Del(termsKey)
+					return nil
+				}
+				members := make([]redis.Z, len(terms))
+				for i, term := range terms {
+					members[i] = redis.Z{Member: indexMember(term, id)}
+				}
+				if len(members) > 0 {
+					pipe.ZAdd(searchIndexPrefix+owner, members...)
+				}
+				pipe.Set(termsKey, raw, 0)
+				return nil
+			})
+			return err
+		}, termsKey)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return errors.Errorf("Could not index entry '%s', it was indexed concurrently", id)
+}
+
+// SearchEntryIDs returns the IDs of the entries of the owner which have a
+// term that begins with the prefix
+func (r *Store) SearchEntryIDs(owner, prefix string) ([]string, error) {
+	members, err := r.c.ZRangeByLex(searchIndexPrefix+owner, redis.ZRangeBy{
+		Min: "[" + prefix,
+		Max: "[" + prefix + "\xff",
+	}).Result()
+	if err != nil {
+		msg := fmt.Sprintf("Could not search entries of user '%s'", owner)
+		logrus.Error(msg)
+		return nil, errors.Wrap(err, msg)
+	}
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, member := range members {
+		id := member[strings.IndexByte(member, 0)+1:]
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
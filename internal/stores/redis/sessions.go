@@ -0,0 +1,145 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	sessionPrefix      = "session:"      // prefix for session-ID-to-session mappings (redis STRING), they expire with the session
+	userSessionsPrefix = "userSessions:" // prefix for user-to-session IDs mappings (redis ZSET), scored by the expiration
+)
+
+// sessionTTL returns how long a session has to be kept in redis
+func sessionTTL(session shared.Session) time.Duration {
+	if ttl := time.Until(session.ExpiresOn); ttl > time.Second {
+		return ttl
+	}
+	return time.Second
+}
+
+// CreateSession saves a session of a user, it is referenced by its ID from
+// the sessions of the user. The expired sessions of the user are removed
+// from them at the same time.
+func (r *Store) CreateSession(identity string, session shared.Session) error {
+	raw, err := json.Marshal(session)
+	if err != nil {
+		return errors.Wrap(err, "Could not marshal session")
+	}
+	userSessionsKey := userSessionsPrefix + identity
+	_, err = r.c.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(sessionPrefix+session.ID, raw, sessionTTL(session))
+		pipe.ZRemRangeByScore(userSessionsKey, "-inf", strconv.FormatInt(time.Now().Unix(), 10))
+		pipe.ZAdd(userSessionsKey, redis.Z{Score: float64(session.ExpiresOn.Unix()), Member: session.ID})
+		return nil
+	})
+	if err != nil {
+		msg := fmt.Sprintf("Could not create session for user '%s'", identity)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	return nil
+}
+
+// getSession returns a session by its ID from the given client
+func getSession(c redis.Cmdable, id string) (*shared.Session, error) {
+	raw, err := c.Get(sessionPrefix + id).Bytes()
+	if err == redis.Nil {
+		return nil, shared.ErrNoSessionFound
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Could not get session '%s'", id)
+	}
+	var session shared.Session
+	if err := json.Unmarshal(raw, &session); err != nil {
+		return nil, errors.Wrapf(err, "Could not unmarshal session '%s'", id)
+	}
+	return &session, nil
+}
+
+// GetSession returns a session by its ID
+func (r *Store) GetSession(id string) (*shared.Session, error) {
+	return getSession(r.c, id)
+}
+
+// UpdateSession changes a session with the given function, the change is
+// retried if the session was modified concurrently.
+func (r *Store) UpdateSession(id string, fn func(*shared.Session) error) error {
+	sessionKey := sessionPrefix + id
+	for i := 0; i < 10; i++ {
+		err := r.c.Watch(func(tx *redis.Tx) error {
+			session, err := getSession(tx, id)
+			if err != nil {
+				return err
+			}
+			if err := fn(session); err != nil {
+				return err
+			}
+			raw, err := json.Marshal(session)
+			if err != nil {
+				return errors.Wrapf(err, "Could not marshal session '%s'", id)
+			}
+			_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+				pipe.Set(sessionKey, raw, sessionTTL(*session))
+				pipe.ZAdd(userSessionsPrefix+shared.Identity(session.OAuthProvider, session.OAuthID), redis.Z{Score: float64(session.ExpiresOn.Unix()), Member: id})
+				return nil
+			})
+			return err
+		}, sessionKey)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return errors.Errorf("Could not update session '%s', it was modified concurrently", id)
+}
+
+// DeleteSession deletes a session by its ID
+func (r *Store) DeleteSession(id string) error {
+	session, err := r.GetSession(id)
+	if err != nil {
+		return err
+	}
+	_, err = r.c.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del(sessionPrefix + id)
+		pipe.ZRem(userSessionsPrefix+shared.Identity(session.OAuthProvider, session.OAuthID), id)
+		return nil
+	})
+	if err != nil {
+		msg := fmt.Sprintf("Could not delete session '%s'", id)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	return nil
+}
+
+// DeleteUserSessions deletes all sessions of a user, it is retried if a
+// session of the user was created concurrently
+func (r *Store) DeleteUserSessions(identity string) error {
+	userSessionsKey := userSessionsPrefix + identity
+	for i := 0; i < 10; i++ {
+		err := r.c.Watch(func(tx *redis.Tx) error {
+			ids, err := tx.ZRange(userSessionsKey, 0, -1).Result()
+			if err != nil {
+				return errors.Wrapf(err, "Could not get sessions of user '%s'", identity)
+			}
+			_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+				for _, id := range ids {
+					pipe.Del(sessionPrefix + id)
+				}
+				pipe.Del(userSessionsKey)
+				return nil
+			})
+			return err
+		}, userSessionsKey)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return errors.Errorf("Could not delete sessions of user '%s', they were modified concurrently", identity)
+}
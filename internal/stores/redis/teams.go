@@ -0,0 +1,142 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	teamPrefix      = "team:"      // prefix for teams (redis STRING)
+	userTeamsPrefix = "userTeams:" // prefix for user-to-[]team mappings (redis SET)
+)
+
+// CreateTeam saves a new team and adds it to the teams of its members.
+func (r *Store) CreateTeam(team shared.Team) error {
+	raw, err := json.Marshal(team)
+	if err != nil {
+		return errors.Wrap(err, "Could not marshal team")
+	}
+	created, err := r.c.SetNX(teamPrefix+team.ID, raw, 0).Result()
+	if err != nil {
+		msg := fmt.Sprintf("Could not create team '%s'", team.ID)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	if !created {
+		return errors.Errorf("Could not create team '%s': already exists", team.ID)
+	}
+	pipe := r.c.TxPipeline()
+	for _, member := range team.Members {
+		pipe.SAdd(userTeamsPrefix+member, team.ID)
+	}
+	if _, err := pipe.Exec(); err != nil {
+		msg := fmt.Sprintf("Could not add team '%s' to its members", team.ID)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	return nil
+}
+
+// GetTeam returns a team by its ID.
+func (r *Store) GetTeam(id string) (*shared.Team, error) {
+	return getTeam(r.c, id)
+}
+
+// GetUserTeams returns the teams of which the user is a member.
+func (r *Store) GetUserTeams(identity string) ([]shared.Team, error) {
+	ids, err := r.c.SMembers(userTeamsPrefix + identity).Result()
+	if err != nil {
+		msg := fmt.Sprintf("Could not get teams of user '%s'", identity)
+		logrus.Error(msg)
+		return nil, errors.Wrap(err, msg)
+	}
+	teams := []shared.Team{}
+	for _, id := range ids {
+		team, err := r.GetTeam(id)
+		if err != nil {
+			logrus.Warnf("Could not get team '%s': %v", id, err)
+			continue
+		}
+		teams = append(teams, *team)
+	}
+	return teams, nil
+}
+
+// AddTeamMember adds a user to the members of a team.
+func (r *Store) AddTeamMember(id, identity string) error {
+	return r.updateTeam(id, func(team *shared.Team, pipe redis.Pipeliner) (bool, error) {
+		if !team.AddMember(identity) {
+			return false, nil
+		}
+		pipe.SAdd(userTeamsPrefix+identity, id)
+		return true, nil
+	})
+}
+
+// RemoveTeamMember removes a user from the members of a team, the last
+// member can not be removed.
+func (r *Store) RemoveTeamMember(id, identity string) error {
+	return r.updateTeam(id, func(team *shared.Team, pipe redis.Pipeliner) (bool, error) {
+		removed, err := team.RemoveMember(identity)
+		if err != nil || !removed {
+			return false, err
+		}
+		pipe.SRem(userTeamsPrefix+identity, id)
+		return true, nil
+	})
+}
+
+// updateTeam changes a team optimistically, the change is retried if the
+// team was modified concurrently. The function queues the commands which
+// have to be executed together with saving the team and returns if the
+// team changed at all.
+func (r *Store) updateTeam(id string, fn func(*shared.Team, redis.Pipeliner) (bool, error)) error {
+	key := teamPrefix + id
+	for i := 0; i < 10; i++ {
+		err := r.c.Watch(func(tx *redis.Tx) error {
+			team, err := getTeam(tx, id)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+				changed, err := fn(team, pipe)
+				if err != nil || !changed {
+					return err
+				}
+				raw, err := json.Marshal(team)
+				if err != nil {
+					return errors.Wrap(err, "Could not marshal team")
+				}
+				pipe.Set(key, raw, 0)
+				return nil
+			})
+			return err
+		}, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return errors.Errorf("Could not update team '%s', it was modified concurrently", id)
+}
+
+// getTeam reads a team with the given client, which can be a transaction
+func getTeam(c redis.Cmdable, id string) (*shared.Team, error) {
+	raw, err := c.Get(teamPrefix + id).Bytes()
+	if err == redis.Nil {
+		return nil, shared.ErrNoTeamFound
+	} else if err != nil {
+		msg := fmt.Sprintf("Could not get team '%s'", id)
+		logrus.Error(msg)
+		return nil, errors.Wrap(err, msg)
+	}
+	var team shared.Team
+	if err := json.Unmarshal(raw, &team); err != nil {
+		return nil, errors.Wrap(err, "Could not unmarshal team")
+	}
+	return &team, nil
+}
@@ -0,0 +1,119 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	apiTokenPrefix      = "apiToken:"      // prefix for hash-to-API token mappings (redis STRING)
+	userAPITokensPrefix = "userAPITokens:" // prefix for user-to-API token ID-to-hash mappings (redis HASH)
+)
+
+// CreateAPIToken saves an API token of a user, it is stored by its hash and
+// referenced by its ID from the tokens of the user
+func (r *Store) CreateAPIToken(identity string, token shared.APIToken) error {
+	raw, err := json.Marshal(token)
+	if err != nil {
+		return errors.Wrap(err, "Could not marshal API token")
+	}
+	_, err = r.c.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(apiTokenPrefix+token.Hash, raw, 0)
+		pipe.HSet(userAPITokensPrefix+identity, token.ID, token.Hash)
+		return nil
+	})
+	if err != nil {
+		msg := fmt.Sprintf("Could not create API token for user '%s'", identity)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	return nil
+}
+
+// GetAPIToken returns an API token by its hash
+func (r *Store) GetAPIToken(hash string) (*shared.APIToken, error) {
+	raw, err := r.c.Get(apiTokenPrefix + hash).Bytes()
+	if err == redis.Nil {
+		return nil, shared.ErrNoAPITokenFound
+	} else if err != nil {
+		msg := "Could not get API token"
+		logrus.Error(msg)
+		return nil, errors.Wrap(err, msg)
+	}
+	var token shared.APIToken
+	if err := json.Unmarshal(raw, &token); err != nil {
+		return nil, errors.Wrap(err, "Could not unmarshal API token")
+	}
+	return &token, nil
+}
+
+// GetAPITokens returns all API tokens of a user
+func (r *Store) GetAPITokens(identity string) ([]shared.APIToken, error) {
+	tokens := []shared.APIToken{}
+	hashes, err := r.c.HVals(userAPITokensPrefix + identity).Result()
+	if err != nil {
+		msg := fmt.Sprintf("Could not get API tokens of user '%s'", identity)
+		logrus.Error(msg)
+		return nil, errors.Wrap(err, msg)
+	}
+	for _, hash := range hashes {
+		token, err := r.GetAPIToken(hash)
+		if err == shared.ErrNoAPITokenFound {
+			// deleted since its hash was fetched
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, nil
+}
+
+// DeleteAPIToken deletes an API token of a user by its ID
+func (r *Store) DeleteAPIToken(identity, id string) error {
+	hash, err := r.c.HGet(userAPITokensPrefix+identity, id).Result()
+	if err == redis.Nil {
+		return shared.ErrNoAPITokenFound
+	} else if err != nil {
+		msg := fmt.Sprintf("Could not get API token '%s' of user '%s'", id, identity)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	_, err = r.c.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del(apiTokenPrefix + hash)
+		pipe.HDel(userAPITokensPrefix+identity, id)
+		return nil
+	})
+	if err != nil {
+		msg := fmt.Sprintf("Could not delete API token '%s' of user '%s'", id, identity)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	return nil
+}
+
+// TouchAPIToken sets the time at which an API token was used the last time,
+// a token which was deleted in the meantime is not saved again
+func (r *Store) TouchAPIToken(hash string, lastUsed time.Time) error {
+	token, err := r.GetAPIToken(hash)
+	if err != nil {
+		return err
+	}
+	token.LastUsed = &lastUsed
+	raw, err := json.Marshal(token)
+	if err != nil {
+		return errors.Wrap(err, "Could not marshal API token")
+	}
+	if err := r.c.SetXX(apiTokenPrefix+hash, raw, 0).Err(); err != nil {
+		msg := "Could not update API token"
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	webhooksPrefix       = "webhooks:"          // prefix for user-to-webhooks mappings (redis HASH)
+	deliveryPrefix       = "webhookDelivery:"   // prefix for webhook deliveries (redis STRING)
+	userDeliveriesPrefix = "webhookDeliveries:" // prefix for user-to-[]delivery mappings, newest first (redis LIST)
+	deliveryQueueKey     = "webhookQueue"       // pending deliveries by the time of their next attempt (redis ZSET)
+)
+
+// deliveryLogSize is the amount of deliveries which are kept per user
+const deliveryLogSize = 100
+
+// CreateWebhook saves a webhook of a user.
+func (r *Store) CreateWebhook(userIdentifier string, webhook shared.Webhook) error {
+	raw, err := json.Marshal(webhook)
+	if err != nil {
+		return errors.Wrap(err, "Could not marshal webhook")
+	}
+	if err := r.c.HSet(webhooksPrefix+userIdentifier, webhook.ID, raw).Err(); err != nil {
+		msg := fmt.Sprintf("Could not create webhook for user '%s'", userIdentifier)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	return nil
+}
+
+// GetWebhooks returns all webhooks of a user.
+func (r *Store) GetWebhooks(userIdentifier string) ([]shared.Webhook, error) {
+	result, err := r.c.HGetAll(webhooksPrefix + userIdentifier).Result()
+	if err != nil {
+		msg := fmt.Sprintf("Could not get webhooks of user '%s'", userIdentifier)
+		logrus.Error(msg)
+		return nil, errors.Wrap(err, msg)
+	}
+	webhooks := []shared.Webhook{}
+	for _, raw := range result {
+		var webhook shared.Webhook
+		if err := json.Unmarshal([]byte(raw), &webhook); err != nil {
+			return nil, errors.Wrap(err, "Could not unmarshal webhook")
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes a webhook of a user.
+func (r *Store) DeleteWebhook(userIdentifier, id string) error {
+	deleted, err := r.c.HDel(webhooksPrefix+userIdentifier, id).Result()
+	if err != nil {
+		msg := fmt.Sprintf("Could not delete webhook '%s' of user '%s'", id, userIdentifier)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	if deleted == 0 {
+		return shared.ErrNoWebhookFound
+	}
+	return nil
+}
+
+// SaveDelivery saves a webhook delivery in the delivery log and queues it
+// for its next attempt if it is pending. The deliveries expire after the
+// retention of the delivery log.
+func (r *Store) SaveDelivery(delivery shared.WebhookDelivery) error {
+	raw, err := json.Marshal(delivery)
+	if err != nil {
+		return errors.Wrap(err, "Could not marshal delivery")
+	}
+	key := deliveryPrefix + delivery.ID
+	isNew, err := r.c.SetNX(key, raw, shared.WebhookDeliveryRetention).Result()
+	if err != nil {
+		msg := fmt.Sprintf("Could not save delivery '%s'", delivery.ID)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	pipe := r.c.TxPipeline()
+	if isNew {
+		logKey := userDeliveriesPrefix + delivery.UserIdentifier
+		pipe.LPush(logKey, delivery.ID)
+		pipe.LTrim(logKey, 0, deliveryLogSize-1)
+	} else {
+		pipe.Set(key, raw, shared.WebhookDeliveryRetention)
+	}
+	if delivery.Status == shared.DeliveryPending {
+		pipe.ZAdd(deliveryQueueKey, redis.Z{Score: float64(delivery.NextAttempt.UnixNano()), Member: delivery.ID})
+	} else {
+		pipe.ZRem(deliveryQueueKey, delivery.ID)
+	}
+	if _, err := pipe.Exec(); err != nil {
+		msg := fmt.Sprintf("Could not save delivery '%s'", delivery.ID)
+		logrus.Error(msg)
+		return errors.Wrap(err, msg)
+	}
+	return nil
+}
+
+// claimScript moves the due deliveries in the queue to the end of the lease
+// and returns them, in one step so that every delivery is only claimed once
+var claimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, id in ipairs(ids) do
+	redis.call('ZADD', KEYS[1], ARGV[2], id)
+end
+return ids
+`)
+
+// ClaimDeliveries returns up to limit pending deliveries which are due. Every
+// delivery is only claimed by one instance, since the claim script moves it
+// to the end of the lease atomically. It stays queued, so it is retried
+// after the lease if the claiming instance stops before it saves the result.
+func (r *Store) ClaimDeliveries(now time.Time, lease time.Duration, limit int) ([]shared.WebhookDelivery, error) {
+	ids, err := claimScript.Run(r.c, []string{deliveryQueueKey},
+		now.UnixNano(), now.Add(lease).UnixNano(), limit).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not claim due deliveries")
+	}
+	list, _ := ids.([]interface{})
+	var claimed []shared.WebhookDelivery
+	for _, value := range list {
+		id, _ := value.(string)
+		raw, err := r.c.Get(deliveryPrefix + id).Bytes()
+		if err == redis.Nil {
+			// the delivery already expired
+			if err := r.c.ZRem(deliveryQueueKey, id).Err(); err != nil {
+				return claimed, errors.Wrapf(err, "Could not dequeue delivery '%s'", id)
+			}
+			continue
+		} else if err != nil {
+			return claimed, errors.Wrapf(err, "Could not get delivery '%s'", id)
+		}
+		var delivery shared.WebhookDelivery
+		if err := json.Unmarshal(raw, &delivery); err != nil {
+			return claimed, errors.Wrapf(err, "Could not unmarshal delivery '%s'", id)
+		}
+		delivery.NextAttempt = now.Add(lease)
+		if err := r.SaveDelivery(delivery); err != nil {
+			return claimed, err
+		}
+		claimed = append(claimed, delivery)
+	}
+	return claimed, nil
+}
+
+// GetDeliveries returns the latest deliveries of a user, newest first.
+func (r *Store) GetDeliveries(userIdentifier string, limit int) ([]shared.WebhookDelivery, error) {
+	deliveries := []shared.WebhookDelivery{}
+	ids, err := r.c.LRange(userDeliveriesPrefix+userIdentifier, 0, int64(limit)-1).Result()
+	if err != nil {
+		msg := fmt.Sprintf("Could not get deliveries of user '%s'", userIdentifier)
+		logrus.Error(msg)
+		return nil, errors.Wrap(err, msg)
+	}
+	if len(ids) == 0 {
+		return deliveries, nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = deliveryPrefix + id
+	}
+	values, err := r.c.MGet(keys...).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not get deliveries")
+	}
+	for _, value := range values {
+		raw, ok := value.(string)
+		if !ok {
+			// the delivery already expired
+			continue
+		}
+		var delivery shared.WebhookDelivery
+		if err := json.Unmarshal([]byte(raw), &delivery); err != nil {
+			return nil, errors.Wrap(err, "Could not unmarshal delivery")
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
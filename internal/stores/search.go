@@ -0,0 +1,185 @@
+package stores
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Limits of the tags and the notes of an entry
+const (
+	maxTags      = 20
+	maxTagLength = 64
+	maxNotes     = 2000
+)
+
+// searchIndexMarker is set once the entries which were created before the
+// search index existed are indexed
+const searchIndexMarker = "searchIndex:v1"
+
+// ErrInvalidTags is returned when an entry has too many or too long tags
+var ErrInvalidTags = errors.Errorf("the given tags are not valid, at most %d tags of at most %d characters are allowed", maxTags, maxTagLength)
+
+// ErrNotesTooLong is returned when the notes of an entry are too long
+var ErrNotesTooLong = errors.Errorf("the given notes are too long, at most %d characters are allowed", maxNotes)
+
+// ErrNoValidQuery is returned when a search query does not contain any term
+var ErrNoValidQuery = errors.New("the given search query does not contain any letters or digits")
+
+// normalizeTags trims the tags and removes empty and duplicate ones, the
+// tags are compared case-insensitively
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, ErrInvalidTags
+		}
+		seen[strings.ToLower(tag)] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTags {
+		return nil, ErrInvalidTags
+	}
+	if len(normalized) == 0 {
+		return nil, nil
+	}
+	return normalized, nil
+}
+
+// tokenize splits the text into lower case words of letters and digits
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchTerms returns the terms under which an entry is indexed, these are
+// the words of its ID, its URL, its tags and its notes
+func searchTerms(id string, entry shared.Entry) []string {
+	terms := []string{}
+	seen := map[string]bool{}
+	for _, text := range append([]string{id, entry.Public.URL, entry.Notes}, entry.Tags...) {
+		for _, term := range tokenize(text) {
+			if !seen[term] {
+				seen[term] = true
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms
+}
+
+// indexEntry adds the entry to the search index of its owner, failures are
+// only logged since the entry itself is already stored
+func (s *Store) indexEntry(id string, entry shared.Entry) {
+	if err := s.storage.IndexEntry(id, getEntryOwner(entry), searchTerms(id, entry)); err != nil {
+		logrus.Warningf("could not index entry %s: %v", id, err)
+	}
+}
+
+// unindexEntry removes the entry from the search index
+func (s *Store) unindexEntry(id string) {
+	if err := s.storage.IndexEntry(id, "", nil); err != nil {
+		logrus.Warningf("could not remove entry %s from the search index: %v", id, err)
+	}
+}
+
+// migrateSearchIndex indexes all entries once, which were created before
+// the search index existed
+func (s *Store) migrateSearchIndex() error {
+	set, err := s.storage.SetIfAbsent(searchIndexMarker, 0)
+	if err != nil {
+		return errors.Wrap(err, "could not set search index marker")
+	} else if !set {
+		return nil
+	}
+	logrus.Info("Building the search index of the entries")
+	// the entries are collected first, since bolt can't write while
+	// they are iterated in a read transaction
+	entries := map[string]shared.Entry{}
+	err = s.storage.IterateEntries(func(id string, entry shared.Entry) error {
+		entries[id] = entry
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "could not iterate entries")
+	}
+	for id, entry := range entries {
+		if err := s.storage.IndexEntry(id, getEntryOwner(entry), searchTerms(id, entry)); err != nil {
+			return errors.Wrapf(err, "could not index entry %s", id)
+		}
+	}
+	return nil
+}
+
+// SearchUserEntries searches the entries of a user or, if the team ID is
+// set, of a team. Every word of the query has to be the beginning of a word
+// of the ID, the URL, the tags or the notes of an entry.
+func (s *Store) SearchUserEntries(oAuthProvider, oAuthID, teamID, query string) (map[string]shared.Entry, error) {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil, ErrNoValidQuery
+	}
+	owner := getUserIdentifier(oAuthProvider, oAuthID)
+	if teamID != "" {
+		owner = shared.TeamEntriesPrefix + teamID
+	}
+	var ids map[string]bool
+	for _, term := range terms {
+		found, err := s.storage.SearchEntryIDs(owner, term)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not search entries")
+		}
+		matches := map[string]bool{}
+		for _, id := range found {
+			if ids == nil || ids[id] {
+				matches[id] = true
+			}
+		}
+		ids = matches
+	}
+	entries := map[string]shared.Entry{}
+	for id := range ids {
+		entry, err := s.storage.GetEntryByID(id)
+		if errors.Cause(err) == shared.ErrNoEntryFound {
+			continue
+		} else if err != nil {
+			return nil, errors.Wrap(err, "could not get entry")
+		}
+		// the index is updated after the entries, so it can be outdated
+		if getEntryOwner(*entry) == owner {
+			entries[id] = *entry
+		}
+	}
+	return entries, nil
+}
+
+// UpdateEntryDetails changes the tags and the notes of an entry
+func (s *Store) UpdateEntryDetails(id string, tags []string, notes string) error {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return err
+	}
+	if notes = strings.TrimSpace(notes); len(notes) > maxNotes {
+		return ErrNotesTooLong
+	}
+	var updated shared.Entry
+	err = s.storage.UpdateEntry(id, func(entry *shared.Entry) error {
+		entry.Tags, entry.Notes = tags, notes
+		updated = *entry
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.indexEntry(id, updated)
+	return nil
+}
@@ -0,0 +1,137 @@
+package stores
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+)
+
+// defaultSessionLifetime is how long a session lasts without being refreshed
+// if nothing is configured
+const defaultSessionLifetime = 30 * 24 * time.Hour
+
+// ErrInvalidRefreshToken is returned when a refresh token is unknown, was
+// already used or its session is expired or revoked
+var ErrInvalidRefreshToken = errors.New("the given refresh token is not valid")
+
+// newRefreshToken generates a refresh token of a session, it starts with the
+// ID of the session so that the session can be found by it
+func newRefreshToken(sessionID string) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", errors.Wrap(err, "could not generate refresh token")
+	}
+	return sessionID + "." + base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// CreateSession starts a session for the user of the given session. The
+// refresh token is only returned once, only its hash is stored.
+func (s *Store) CreateSession(session shared.Session) (string, *shared.Session, error) {
+	session.ID = uuid.New()
+	refreshToken, err := newRefreshToken(session.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	session.RefreshHash = hashToken(refreshToken)
+	session.CreatedOn, session.RefreshedOn = now, now
+	session.ExpiresOn = now.Add(s.sessionLifetime)
+	if err := s.storage.CreateSession(shared.Identity(session.OAuthProvider, session.OAuthID), session); err != nil {
+		return "", nil, errors.Wrap(err, "could not create session")
+	}
+	return refreshToken, &session, nil
+}
+
+// GetSession returns a session which is neither revoked nor expired
+func (s *Store) GetSession(id string) (*shared.Session, error) {
+	session, err := s.storage.GetSession(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Expired(time.Now()) {
+		return nil, shared.ErrNoSessionFound
+	}
+	return session, nil
+}
+
+// sessionIDOfRefreshToken returns the ID of the session of a refresh token
+func sessionIDOfRefreshToken(refreshToken string) (string, error) {
+	dot := strings.Index(refreshToken, ".")
+	if dot < 1 {
+		return "", ErrInvalidRefreshToken
+	}
+	return refreshToken[:dot], nil
+}
+
+// refreshTokenMatches checks if the refresh token is the current one of the
+// session and if the session is still valid
+func refreshTokenMatches(session *shared.Session, refreshToken string, now time.Time) bool {
+	return !session.Expired(now) && subtle.ConstantTimeCompare([]byte(session.RefreshHash), []byte(hashToken(refreshToken))) == 1
+}
+
+// GetRefreshTokenSession returns the session of a refresh token
+func (s *Store) GetRefreshTokenSession(refreshToken string) (*shared.Session, error) {
+	id, err := sessionIDOfRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.storage.GetSession(id)
+	if errors.Cause(err) == shared.ErrNoSessionFound {
+		return nil, ErrInvalidRefreshToken
+	} else if err != nil {
+		return nil, errors.Wrap(err, "could not get session")
+	}
+	if !refreshTokenMatches(session, refreshToken, time.Now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+	return session, nil
+}
+
+// RefreshSession extends the session of the refresh token and replaces the
+// refresh token with a new one, which is returned. Every refresh token can
+// only be used once.
+func (s *Store) RefreshSession(refreshToken string) (string, *shared.Session, error) {
+	id, err := sessionIDOfRefreshToken(refreshToken)
+	if err != nil {
+		return "", nil, err
+	}
+	newToken, err := newRefreshToken(id)
+	if err != nil {
+		return "", nil, err
+	}
+	var refreshed shared.Session
+	err = s.storage.UpdateSession(id, func(session *shared.Session) error {
+		now := time.Now()
+		if !refreshTokenMatches(session, refreshToken, now) {
+			return ErrInvalidRefreshToken
+		}
+		session.RefreshHash = hashToken(newToken)
+		session.RefreshedOn = now
+		session.ExpiresOn = now.Add(s.sessionLifetime)
+		refreshed = *session
+		return nil
+	})
+	if cause := errors.Cause(err); cause == shared.ErrNoSessionFound || cause == ErrInvalidRefreshToken {
+		return "", nil, ErrInvalidRefreshToken
+	} else if err != nil {
+		return "", nil, errors.Wrap(err, "could not refresh session")
+	}
+	return newToken, &refreshed, nil
+}
+
+// RevokeSession ends a session, its access tokens and its refresh token are
+// not accepted anymore
+func (s *Store) RevokeSession(id string) error {
+	return s.storage.DeleteSession(id)
+}
+
+// RevokeUserSessions ends all sessions of a user
+func (s *Store) RevokeUserSessions(oAuthProvider, oAuthID string) error {
+	return errors.Wrap(s.storage.DeleteUserSessions(shared.Identity(oAuthProvider, oAuthID)), "could not delete sessions")
+}
@@ -0,0 +1,18 @@
+package shared
+
+import "time"
+
+// Actions of audit events
+const (
+	AuditEntryTransferred = "entry.transferred"
+)
+
+// AuditEvent records a change of an entry which was made by a user
+type AuditEvent struct {
+	Action    string
+	EntryID   string
+	Actor     string // identity of the user who made the change
+	From      string `json:",omitempty"`
+	To        string `json:",omitempty"`
+	Timestamp time.Time
+}
@@ -0,0 +1,63 @@
+package shared
+
+import "sync"
+
+// VisitEvent is published for every registered visit of an entry
+type VisitEvent struct {
+	ID      string
+	Visitor Visitor
+}
+
+// subscriberBuffer is the number of events which are buffered per
+// subscriber, events for slower subscribers are dropped
+const subscriberBuffer = 64
+
+// Broker fans out visit events to all subscribers within the process
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[chan VisitEvent]struct{}
+}
+
+// NewBroker returns a broker without subscribers
+func NewBroker() *Broker {
+	return &Broker{subscribers: map[chan VisitEvent]struct{}{}}
+}
+
+// Publish sends the event to all subscribers without blocking
+func (b *Broker) Publish(event VisitEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel which receives all published events and
+// a function which has to be called to unsubscribe
+func (b *Broker) Subscribe() (<-chan VisitEvent, func()) {
+	ch := make(chan VisitEvent, subscriberBuffer)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close unsubscribes all subscribers
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,144 @@
+package shared
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mxschmitt/golang-url-shortener/internal/useragent"
+)
+
+// Prefixes of the rollup counters which are maintained for every
+// entry, the time buckets are in UTC. The counters of the dimensions
+// are followed by the day of the visit, a colon and the value.
+const (
+	RollupHour        = "hour:"
+	RollupDay         = "day:"
+	RollupReferrer    = "referrer:"
+	RollupCountry     = "country:"
+	RollupBrowser     = "browser:"
+	RollupOS          = "os:"
+	RollupDevice      = "device:"
+	RollupUTMSource   = "utm_source:"
+	RollupUTMCampaign = "utm_campaign:"
+)
+
+// Layouts of the time buckets of the rollup counters
+const (
+	RollupHourLayout = "2006010215"
+	RollupDayLayout  = "20060102"
+)
+
+// Values of the dimensions which are not counted by themselves
+const (
+	RollupDirect = "(direct)"
+	RollupOther  = "(other)"
+)
+
+// maxRollupValueLength is the maximum length of a referrer host or an UTM
+// value, longer ones are counted as RollupOther
+const maxRollupValueLength = 64
+
+// RollupCounters returns the names of the rollup counters
+// which have to be increased for a visitor
+func RollupCounters(visitor Visitor) []string {
+	timestamp := visitor.Timestamp.UTC()
+	day := timestamp.Format(RollupDayLayout)
+	info := visitor.UserAgentInfo()
+	counters := []string{
+		RollupHour + timestamp.Format(RollupHourLayout),
+		RollupDay + day,
+		DimensionCounter(RollupReferrer, day, RefererHost(visitor.Referer)),
+		DimensionCounter(RollupBrowser, day, info.Browser),
+		DimensionCounter(RollupOS, day, info.OS),
+		DimensionCounter(RollupDevice, day, info.DeviceType),
+	}
+	if visitor.Country != "" {
+		counters = append(counters, DimensionCounter(RollupCountry, day, visitor.Country))
+	}
+	if visitor.UTMSource != "" {
+		counters = append(counters, DimensionCounter(RollupUTMSource, day, UTMValue(visitor.UTMSource)))
+	}
+	if visitor.UTMCampaign != "" {
+		counters = append(counters, DimensionCounter(RollupUTMCampaign, day, UTMValue(visitor.UTMCampaign)))
+	}
+	return counters
+}
+
+// DimensionCounter returns the name of the rollup counter of a dimension
+// value on a day
+func DimensionCounter(prefix, day, value string) string {
+	return prefix + day + ":" + value
+}
+
+// ParseDimensionCounter splits the rest of a dimension counter after its
+// prefix into the day and the value. Counters which were increased before
+// they were kept per day have no day, ok is false for them.
+func ParseDimensionCounter(rest string) (day time.Time, value string, ok bool) {
+	if len(rest) <= len(RollupDayLayout) || rest[len(RollupDayLayout)] != ':' {
+		return time.Time{}, rest, false
+	}
+	day, err := ParseRollupTime(RollupDayLayout, rest[:len(RollupDayLayout)])
+	if err != nil {
+		return time.Time{}, rest, false
+	}
+	return day, rest[len(RollupDayLayout)+1:], true
+}
+
+// UniquesDay returns the day of the unique visitor sketch
+// which contains the given time
+func UniquesDay(t time.Time) string {
+	return t.UTC().Format(RollupDayLayout)
+}
+
+// ParseRollupTime parses the time bucket of an hour or day rollup counter
+func ParseRollupTime(layout, value string) (time.Time, error) {
+	return time.ParseInLocation(layout, value, time.UTC)
+}
+
+// RefererHost reduces a referer to its lower case host without the port,
+// visits without a referer are counted as direct ones and referers without
+// a valid host as other ones
+func RefererHost(referer string) string {
+	if referer == "" {
+		return RollupDirect
+	}
+	u, err := url.Parse(referer)
+	if err != nil || u.Hostname() == "" {
+		return RollupOther
+	}
+	host := strings.ToLower(u.Hostname())
+	if net.ParseIP(host) == nil && strings.IndexFunc(host, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' && r != '-'
+	}) >= 0 {
+		return RollupOther
+	}
+	return boundedValue(host)
+}
+
+// UTMValue normalizes an UTM parameter, it is trimmed and lower cased
+func UTMValue(value string) string {
+	return boundedValue(strings.ToLower(strings.TrimSpace(value)))
+}
+
+// boundedValue returns RollupOther instead of empty, too long or not
+// printable values of a dimension
+func boundedValue(value string) string {
+	if value == "" || len(value) > maxRollupValueLength || strings.IndexFunc(value, func(r rune) bool {
+		return !unicode.IsPrint(r)
+	}) >= 0 {
+		return RollupOther
+	}
+	return value
+}
+
+// UserAgentInfo returns the classification of the User-Agent of the visitor,
+// visitors which were recorded before it was stored are classified again
+func (v Visitor) UserAgentInfo() useragent.Info {
+	if v.Browser == "" {
+		return useragent.Parse(v.UserAgent)
+	}
+	return useragent.Info{Browser: v.Browser, OS: v.OS, DeviceType: v.DeviceType, Bot: v.Bot}
+}
@@ -0,0 +1,23 @@
+package shared
+
+import "time"
+
+// Session is a login of a user, its access tokens are only valid as long as
+// it exists. Only the SHA-256 hash of its refresh token is stored.
+type Session struct {
+	ID            string
+	RefreshHash   string
+	OAuthProvider string
+	OAuthID       string
+	OAuthName     string
+	OAuthPicture  string
+	OAuthEmail    string
+	CreatedOn     time.Time
+	RefreshedOn   time.Time
+	ExpiresOn     time.Time
+}
+
+// Expired checks if the session is expired at the given time
+func (s *Session) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresOn)
+}
@@ -2,6 +2,8 @@ package shared
 
 import (
 	"errors"
+	"net"
+	"strings"
 	"time"
 )
 
@@ -9,38 +11,204 @@ import (
 // e.g. bolt, sqlite
 type Storage interface {
 	GetEntryByID(string) (*Entry, error)
+	UpdateEntry(string, func(*Entry) error) error
+	IterateEntries(func(string, Entry) error) error
+	TransferEntry(string, string, func(*Entry) (*AuditEvent, error)) error
+	GetAuditEvents(int) ([]AuditEvent, error)
+	IndexEntry(string, string, []string) error
+	SearchEntryIDs(string, string) ([]string, error)
+	CreateAPIToken(string, APIToken) error
+	GetAPIToken(string) (*APIToken, error)
+	GetAPITokens(string) ([]APIToken, error)
+	DeleteAPIToken(string, string) error
+	TouchAPIToken(string, time.Time) error
+	CreateSession(string, Session) error
+	GetSession(string) (*Session, error)
+	UpdateSession(string, func(*Session) error) error
+	DeleteSession(string) error
+	DeleteUserSessions(string) error
 	GetVisitors(string) ([]Visitor, error)
+	IterateVisitors(string, func(Visitor) error) error
+	PruneVisitors(time.Time) (int, error)
+	GetRollups(string) (map[string]int, error)
+	AddRollups(string, map[string]int) error
 	DeleteEntry(string) error
 	IncreaseVisitCounter(string) error
 	CreateEntry(Entry, string, string) error
+	CreateEntries([]NewEntry, bool) ([]error, error)
 	GetUserEntries(string) (map[string]Entry, error)
 	RegisterVisitor(string, string, Visitor) error
+	RegisterBotVisitor(string, string, Visitor) error
+	GetBotVisitors(string) ([]Visitor, error)
+	AddUniqueVisitor(string, time.Time, []byte) error
+	CountUniqueVisitors(string, []time.Time) (int, error)
+	ReserveAttempt(string, time.Duration, func(*Attempts) bool) (bool, error)
+	ResetAttempts(string) error
+	SetIfAbsent(string, time.Duration) (bool, error)
+	PublishVisit(VisitEvent) error
+	SubscribeVisits() (<-chan VisitEvent, func())
+	CreateWebhook(string, Webhook) error
+	GetWebhooks(string) ([]Webhook, error)
+	DeleteWebhook(string, string) error
+	SaveDelivery(WebhookDelivery) error
+	ClaimDeliveries(time.Time, time.Duration, int) ([]WebhookDelivery, error)
+	GetDeliveries(string, int) ([]WebhookDelivery, error)
+	CreateTeam(Team) error
+	GetTeam(string) (*Team, error)
+	GetUserTeams(string) ([]Team, error)
+	AddTeamMember(string, string) error
+	RemoveTeamMember(string, string) error
 	Close() error
 }
 
 // Entry is the data set which is stored in the DB as JSON
 type Entry struct {
 	OAuthProvider, OAuthID string
-	RemoteAddr             string `json:",omitempty"`
-	DeletionURL            string `json:",omitempty"`
-	Password               []byte `json:",omitempty"`
+	RemoteAddr             string        `json:",omitempty"`
+	DeletionURL            string        `json:",omitempty"`
+	Password               []byte        `json:",omitempty"`
+	Access                 *AccessPolicy `json:",omitempty"`
+	AllowedCIDRs           []string      `json:",omitempty"`
+	SharedWith             []string      `json:",omitempty"` // identities in the form of 'provider/id'
+	TeamID                 string        `json:",omitempty"` // team which owns the entry instead of its creator
+	Tags                   []string      `json:",omitempty"`
+	Notes                  string        `json:",omitempty"`
 	Public                 EntryPublicData
 }
 
+// NewEntry is an entry which is created together with others, Owner is the
+// user identifier under which it is listed
+type NewEntry struct {
+	ID    string
+	Owner string
+	Entry Entry
+}
+
+// IsSharedWith checks if the owner shared the entry with the user
+func (e *Entry) IsSharedWith(oAuthProvider, oAuthID string) bool {
+	for _, identity := range e.SharedWith {
+		if identity == Identity(oAuthProvider, oAuthID) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsIP checks if the given client IP is contained in one of the allowed
+// CIDRs of the entry. Entries without allowed CIDRs are accessible by everyone.
+func (e *Entry) AllowsIP(ip net.IP) bool {
+	if len(e.AllowedCIDRs) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range e.AllowedCIDRs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Access modes of an AccessPolicy
+const (
+	AccessPublic        = "public"
+	AccessAuthenticated = "authenticated"
+	AccessRestricted    = "restricted"
+)
+
+// AccessPolicy restricts who is able to resolve an entry. In the restricted
+// mode a visitor needs to match one of the identities ("provider/ID") or
+// one of the email domains.
+type AccessPolicy struct {
+	Mode         string
+	Identities   []string `json:",omitempty"`
+	EmailDomains []string `json:",omitempty"`
+}
+
+// RequiresAuthentication returns true if only authenticated visitors can resolve the entry
+func (p *AccessPolicy) RequiresAuthentication() bool {
+	return p != nil && p.Mode != "" && p.Mode != AccessPublic
+}
+
+// Allows checks if an authenticated visitor is allowed to resolve the entry
+func (p *AccessPolicy) Allows(oAuthProvider, oAuthID, email string) bool {
+	if !p.RequiresAuthentication() || p.Mode == AccessAuthenticated {
+		return true
+	}
+	for _, identity := range p.Identities {
+		if identity == Identity(oAuthProvider, oAuthID) {
+			return true
+		}
+	}
+	if at := strings.LastIndex(email, "@"); at != -1 {
+		for _, domain := range p.EmailDomains {
+			if strings.EqualFold(email[at+1:], domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // EntryPublicData is the public part of an entry
 type EntryPublicData struct {
 	CreatedOn             time.Time
 	LastVisit, Expiration *time.Time `json:",omitempty"`
 	VisitCount            int
+	BotVisitCount         int `json:",omitempty"`
+	UniqueVisitorsToday   int `json:",omitempty"`
 	URL                   string
+	FallbackURL           string        `json:",omitempty"`
+	Suspended             bool          `json:",omitempty"` // disabled by an admin, it does not redirect anymore
+	Metadata              *PageMetadata `json:",omitempty"`
+}
+
+// PageMetadata is the metadata of the page to which an entry redirects
+type PageMetadata struct {
+	Title        string `json:",omitempty"`
+	Description  string `json:",omitempty"`
+	CanonicalURL string `json:",omitempty"`
+	FaviconURL   string `json:",omitempty"`
+	FetchedOn    time.Time
 }
 
 // Visitor is the entry which is stored in the visitors bucket
 type Visitor struct {
 	IP, Referer, UserAgent                                 string
 	Timestamp                                              time.Time
+	Country                                                string `json:",omitempty"`
+	Browser, OS, DeviceType                                string `json:",omitempty"`
+	Bot                                                    bool   `json:",omitempty"`
 	UTMSource, UTMMedium, UTMCampaign, UTMContent, UTMTerm string `json:",omitempty"`
 }
 
+// Attempts holds the failed password attempts which were made
+// for a throttling key, e.g. an entry ID or a client IP
+type Attempts struct {
+	Count       int
+	LastAttempt time.Time
+}
+
 // ErrNoEntryFound is returned when no entry to a id is found
 var ErrNoEntryFound = errors.New("no entry found with this ID")
+
+// ErrEntryAlreadyExists is returned when an entry with the same ID already exists
+var ErrEntryAlreadyExists = errors.New("an entry with this ID already exists")
+
+// ErrNoWebhookFound is returned when no webhook to a id is found
+var ErrNoWebhookFound = errors.New("no webhook found with this ID")
+
+// ErrNoTeamFound is returned when no team to a id is found
+var ErrNoTeamFound = errors.New("no team found with this ID")
+
+// ErrNoAPITokenFound is returned when no API token to a id or a hash is found
+var ErrNoAPITokenFound = errors.New("no API token found")
+
+// ErrNoSessionFound is returned when no session to a id is found
+var ErrNoSessionFound = errors.New("no session found with this ID")
+
+// ErrLastTeamMember is returned when the last member of a team should be removed
+var ErrLastTeamMember = errors.New("the last member of a team can not be removed")
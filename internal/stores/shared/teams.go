@@ -0,0 +1,57 @@
+package shared
+
+import "time"
+
+// TeamEntriesPrefix is the prefix of the identifier under which the entries
+// of a team are stored instead of the identifier of their creator
+const TeamEntriesPrefix = "team:"
+
+// Team is a group of users who own and manage entries together
+type Team struct {
+	ID        string
+	Name      string
+	Members   []string // identities in the form of 'provider/id'
+	CreatedBy string
+	CreatedOn time.Time
+}
+
+// HasMember checks if the identity is a member of the team
+func (t *Team) HasMember(identity string) bool {
+	for _, member := range t.Members {
+		if member == identity {
+			return true
+		}
+	}
+	return false
+}
+
+// AddMember adds the identity to the members of the team, it returns
+// false if it already is a member
+func (t *Team) AddMember(identity string) bool {
+	if t.HasMember(identity) {
+		return false
+	}
+	t.Members = append(t.Members, identity)
+	return true
+}
+
+// RemoveMember removes the identity from the members of the team, it returns
+// false if it is no member
+func (t *Team) RemoveMember(identity string) (bool, error) {
+	for i, member := range t.Members {
+		if member == identity {
+			if len(t.Members) == 1 {
+				return false, ErrLastTeamMember
+			}
+			t.Members = append(t.Members[:i], t.Members[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Identity returns the identity of a user in the form of 'provider/id', which
+// is used for the members of teams and the users an entry is shared with
+func Identity(oAuthProvider, oAuthID string) string {
+	return oAuthProvider + "/" + oAuthID
+}
@@ -0,0 +1,29 @@
+package shared
+
+import "time"
+
+// Scopes of personal API tokens
+const (
+	// TokenScopeFull allows every request the user can do
+	TokenScopeFull = "full"
+	// TokenScopeRead allows to read the entries and their statistics
+	TokenScopeRead = "read"
+	// TokenScopeCreate only allows to create entries
+	TokenScopeCreate = "create"
+)
+
+// APIToken is a personal API token of a user, only the SHA-256 hash of the
+// token itself is stored
+type APIToken struct {
+	ID            string
+	Name          string
+	Scope         string
+	Hash          string
+	OAuthProvider string
+	OAuthID       string
+	OAuthName     string
+	OAuthPicture  string
+	OAuthEmail    string
+	CreatedOn     time.Time
+	LastUsed      *time.Time `json:",omitempty"`
+}
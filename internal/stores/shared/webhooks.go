@@ -0,0 +1,62 @@
+package shared
+
+import "time"
+
+// Events which are sent to webhooks
+const (
+	EventEntryCreated = "entry.created"
+	EventEntryDeleted = "entry.deleted"
+	EventEntryExpired = "entry.expired"
+	EventEntryVisited = "entry.visited"
+)
+
+// Events are all events which can be subscribed by webhooks
+var Events = []string{EventEntryCreated, EventEntryDeleted, EventEntryExpired, EventEntryVisited}
+
+// Statuses of a webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDeliveryRetention is how long finished deliveries are kept in the delivery log
+const WebhookDeliveryRetention = 7 * 24 * time.Hour
+
+// Webhook is an URL of a user which receives the subscribed events,
+// webhooks without events receive all of them
+type Webhook struct {
+	ID        string
+	URL       string
+	Secret    string   `json:",omitempty"`
+	Events    []string `json:",omitempty"`
+	CreatedOn time.Time
+}
+
+// Subscribes checks if the webhook receives the given event
+func (w *Webhook) Subscribes(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one signed payload which is sent to a webhook URL. It is
+// queued until NextAttempt while it is pending. Global webhooks have no user.
+type WebhookDelivery struct {
+	ID, WebhookID, UserIdentifier string
+	URL, Event                    string
+	Payload                       []byte
+	Signature                     string
+	Status                        string
+	Attempts                      int
+	ResponseStatus                int    `json:",omitempty"`
+	LastError                     string `json:",omitempty"`
+	NextAttempt                   time.Time
+	CreatedOn, UpdatedOn          time.Time
+}
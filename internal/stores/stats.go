@@ -0,0 +1,336 @@
+package stores
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Intervals of the clicks over time
+const (
+	IntervalHour = "hour"
+	IntervalDay  = "day"
+	IntervalWeek = "week"
+)
+
+// ErrInvalidInterval is returned when the interval of a stats query is not supported
+var ErrInvalidInterval = errors.New("the given interval is not valid, it has to be hour, day or week")
+
+// rollupsMarker is set once the rollups of the entries, which were visited
+// before the rollups were maintained, are built from their visitors
+const rollupsMarker = "rollups:v1"
+
+// StatsQuery describes which aggregates of an entry should be computed
+type StatsQuery struct {
+	Interval string
+	Location *time.Location
+	From, To time.Time
+	Limit    int
+}
+
+// StatsBucket is the amount of clicks within one interval, the unique
+// visitors are only available for days and weeks
+type StatsBucket struct {
+	Time    time.Time
+	Count   int
+	Uniques int `json:",omitempty"`
+}
+
+// StatsCount is the amount of clicks for one value of a dimension
+type StatsCount struct {
+	Value string
+	Count int
+}
+
+// Stats are the aggregated visitors of an entry. The clicks are limited to
+// the time range of the query, the dimensions to the days in UTC which
+// overlap it, since they are read from the daily rollup counters.
+type Stats struct {
+	Clicks           []StatsBucket
+	UniqueVisitors   int
+	Referrers        []StatsCount
+	Countries        []StatsCount
+	UTMSources       []StatsCount
+	UTMCampaigns     []StatsCount
+	Browsers         []StatsCount
+	OperatingSystems []StatsCount
+	DeviceTypes      []StatsCount
+}
+
+// statsAggregator accumulates the visitors of an entry into counters
+type statsAggregator struct {
+	query                                                             StatsQuery
+	clicks                                                            map[time.Time]int
+	referrers, countries, sources, campaigns, browsers, oses, devices map[string]int
+}
+
+func newStatsAggregator(query StatsQuery) *statsAggregator {
+	return &statsAggregator{
+		query:     query,
+		clicks:    map[time.Time]int{},
+		referrers: map[string]int{},
+		countries: map[string]int{},
+		sources:   map[string]int{},
+		campaigns: map[string]int{},
+		browsers:  map[string]int{},
+		oses:      map[string]int{},
+		devices:   map[string]int{},
+	}
+}
+
+func (a *statsAggregator) add(visitor shared.Visitor) error {
+	if !a.query.From.IsZero() && visitor.Timestamp.Before(a.query.From) {
+		return nil
+	}
+	if !a.query.To.IsZero() && !visitor.Timestamp.Before(a.query.To) {
+		return nil
+	}
+	a.clicks[truncateToInterval(visitor.Timestamp, a.query.Interval, a.query.Location)]++
+	a.referrers[shared.RefererHost(visitor.Referer)]++
+	if visitor.Country != "" {
+		a.countries[visitor.Country]++
+	}
+	if visitor.UTMSource != "" {
+		a.sources[shared.UTMValue(visitor.UTMSource)]++
+	}
+	if visitor.UTMCampaign != "" {
+		a.campaigns[shared.UTMValue(visitor.UTMCampaign)]++
+	}
+	info := visitor.UserAgentInfo()
+	a.browsers[info.Browser]++
+	a.oses[info.OS]++
+	a.devices[info.DeviceType]++
+	return nil
+}
+
+func (a *statsAggregator) stats() *Stats {
+	stats := &Stats{
+		Clicks:           []StatsBucket{},
+		Referrers:        topCounts(a.referrers, a.query.Limit),
+		Countries:        topCounts(a.countries, a.query.Limit),
+		UTMSources:       topCounts(a.sources, a.query.Limit),
+		UTMCampaigns:     topCounts(a.campaigns, a.query.Limit),
+		Browsers:         topCounts(a.browsers, a.query.Limit),
+		OperatingSystems: topCounts(a.oses, a.query.Limit),
+		DeviceTypes:      topCounts(a.devices, a.query.Limit),
+	}
+	for t, count := range a.clicks {
+		stats.Clicks = append(stats.Clicks, StatsBucket{Time: t, Count: count})
+	}
+	sort.Slice(stats.Clicks, func(i, j int) bool {
+		return stats.Clicks[i].Time.Before(stats.Clicks[j].Time)
+	})
+	return stats
+}
+
+// GetStats returns the aggregated visitors of an entry
+func (s *Store) GetStats(id string, query StatsQuery) (*Stats, error) {
+	switch query.Interval {
+	case "":
+		query.Interval = IntervalDay
+	case IntervalHour, IntervalDay, IntervalWeek:
+	default:
+		return nil, ErrInvalidInterval
+	}
+	if query.Location == nil {
+		query.Location = time.UTC
+	}
+	if query.Limit <= 0 {
+		query.Limit = 10
+	}
+	aggregator := newStatsAggregator(query)
+	rollups, err := s.storage.GetRollups(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get rollups")
+	}
+	if len(rollups) == 0 {
+		// entries which were visited before the rollups were maintained
+		// are aggregated from their raw visitors
+		if err := s.storage.IterateVisitors(id, aggregator.add); err != nil {
+			return nil, errors.Wrap(err, "could not iterate visitors")
+		}
+		return aggregator.stats(), nil
+	}
+	aggregator.addRollups(rollups)
+	stats := aggregator.stats()
+	if err := s.addUniques(id, query.Interval, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// migrateRollups builds the rollups of all entries once, which were visited
+// before the rollups were maintained. It has to run before the visitors are
+// pruned, since their history is only kept by the rollups afterwards.
+func (s *Store) migrateRollups() error {
+	set, err := s.storage.SetIfAbsent(rollupsMarker, 0)
+	if err != nil {
+		return errors.Wrap(err, "could not set rollups marker")
+	} else if !set {
+		return nil
+	}
+	logrus.Info("Building the rollups of the visitors")
+	// the IDs are collected first, since bolt can't write while the
+	// entries are iterated in a read transaction
+	var ids []string
+	err = s.storage.IterateEntries(func(id string, _ shared.Entry) error {
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "could not iterate entries")
+	}
+	for _, id := range ids {
+		rollups, err := s.storage.GetRollups(id)
+		if err != nil {
+			return errors.Wrapf(err, "could not get rollups of entry %s", id)
+		}
+		if len(rollups) > 0 {
+			continue
+		}
+		counters := map[string]int{}
+		err = s.storage.IterateVisitors(id, func(visitor shared.Visitor) error {
+			for _, counter := range shared.RollupCounters(visitor) {
+				counters[counter]++
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "could not iterate visitors of entry %s", id)
+		}
+		if err := s.storage.AddRollups(id, counters); err != nil {
+			return errors.Wrapf(err, "could not add rollups of entry %s", id)
+		}
+	}
+	return nil
+}
+
+// addUniques adds the unique visitors to the click buckets and to the stats.
+// The unique visitors are counted per day in UTC, so for other locations the
+// days with the same date are used.
+func (s *Store) addUniques(id, interval string, stats *Stats) error {
+	var all []time.Time
+	seen := map[time.Time]bool{}
+	for i, bucket := range stats.Clicks {
+		start := time.Date(bucket.Time.Year(), bucket.Time.Month(), bucket.Time.Day(), 0, 0, 0, 0, time.UTC)
+		days := []time.Time{start}
+		if interval == IntervalWeek {
+			for d := 1; d < 7; d++ {
+				days = append(days, start.AddDate(0, 0, d))
+			}
+		}
+		if interval != IntervalHour {
+			uniques, err := s.GetUniqueVisitors(id, days...)
+			if err != nil {
+				return err
+			}
+			stats.Clicks[i].Uniques = uniques
+		}
+		for _, day := range days {
+			if !seen[day] {
+				seen[day] = true
+				all = append(all, day)
+			}
+		}
+	}
+	uniques, err := s.GetUniqueVisitors(id, all...)
+	if err != nil {
+		return err
+	}
+	stats.UniqueVisitors = uniques
+	return nil
+}
+
+// addRollups adds the rollup counters of an entry. Day buckets are only
+// used when they can't span two intervals, which is the case for days and
+// weeks in UTC, otherwise the hour buckets are used.
+func (a *statsAggregator) addRollups(rollups map[string]int) {
+	timePrefix, layout := shared.RollupHour, shared.RollupHourLayout
+	if a.query.Interval != IntervalHour && a.query.Location == time.UTC {
+		timePrefix, layout = shared.RollupDay, shared.RollupDayLayout
+	}
+	dimensions := map[string]map[string]int{
+		shared.RollupReferrer:    a.referrers,
+		shared.RollupCountry:     a.countries,
+		shared.RollupUTMSource:   a.sources,
+		shared.RollupUTMCampaign: a.campaigns,
+		shared.RollupBrowser:     a.browsers,
+		shared.RollupOS:          a.oses,
+		shared.RollupDevice:      a.devices,
+	}
+	for counter, count := range rollups {
+		if strings.HasPrefix(counter, timePrefix) {
+			t, err := shared.ParseRollupTime(layout, strings.TrimPrefix(counter, timePrefix))
+			if err != nil {
+				continue
+			}
+			if !a.query.From.IsZero() && t.Before(a.query.From) {
+				continue
+			}
+			if !a.query.To.IsZero() && !t.Before(a.query.To) {
+				continue
+			}
+			a.clicks[truncateToInterval(t, a.query.Interval, a.query.Location)] += count
+			continue
+		}
+		for prefix, counts := range dimensions {
+			if !strings.HasPrefix(counter, prefix) {
+				continue
+			}
+			day, value, ok := shared.ParseDimensionCounter(strings.TrimPrefix(counter, prefix))
+			if a.includesDay(day, ok) {
+				counts[value] += count
+			}
+			break
+		}
+	}
+}
+
+// includesDay returns whether the dimension counters of a day in UTC overlap
+// the time range of the query. The counters which were increased before they
+// were kept per day are only included if the range is not limited.
+func (a *statsAggregator) includesDay(day time.Time, ok bool) bool {
+	if !ok {
+		return a.query.From.IsZero() && a.query.To.IsZero()
+	}
+	if !a.query.From.IsZero() && !day.AddDate(0, 0, 1).After(a.query.From) {
+		return false
+	}
+	return a.query.To.IsZero() || day.Before(a.query.To)
+}
+
+// truncateToInterval returns the start of the interval in the given
+// location which contains t, weeks start on monday
+func truncateToInterval(t time.Time, interval string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch interval {
+	case IntervalHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+	case IntervalWeek:
+		return time.Date(t.Year(), t.Month(), t.Day()-(int(t.Weekday())+6)%7, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+}
+
+// topCounts returns the values with the highest counts in descending order
+func topCounts(counts map[string]int, limit int) []StatsCount {
+	result := []StatsCount{}
+	for value, count := range counts {
+		result = append(result, StatsCount{Value: value, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count == result[j].Count {
+			return result[i].Value < result[j].Value
+		}
+		return result[i].Count > result[j].Count
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
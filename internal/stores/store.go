@@ -4,17 +4,24 @@ package stores
 import (
 	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/sha512"
+	"encoding/hex"
 	"math/big"
+	"net"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
 	"github.com/asaskevich/govalidator"
+	"github.com/mxschmitt/golang-url-shortener/internal/metadata"
+	"github.com/mxschmitt/golang-url-shortener/internal/metrics"
 	"github.com/mxschmitt/golang-url-shortener/internal/stores/boltdb"
 	"github.com/mxschmitt/golang-url-shortener/internal/stores/redis"
 	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/mxschmitt/golang-url-shortener/internal/useragent"
 	"github.com/mxschmitt/golang-url-shortener/internal/util"
 	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
@@ -24,8 +31,17 @@ import (
 
 // Store holds internal funcs and vars about the store
 type Store struct {
-	storage  shared.Storage
-	idLength int
+	storage            shared.Storage
+	idLength           int
+	passwordProtection passwordProtection
+	webhooks           webhookSettings
+	stop               chan struct{}
+	workers            *sync.WaitGroup
+	countBots          bool
+	privacy            privacy
+	duplicateWindow    time.Duration
+	metadata           *metadata.Fetcher
+	sessionLifetime    time.Duration
 }
 
 // ErrNoValidURL is returned when the URL is not valid
@@ -34,9 +50,27 @@ var ErrNoValidURL = errors.New("the given URL is no valid URL")
 // ErrGeneratingIDFailed is returned when the 10 tries to generate an id failed
 var ErrGeneratingIDFailed = errors.New("could not generate unique id, all ten tries failed")
 
+// ErrNoValidFallbackURL is returned when the fallback URL is not valid
+var ErrNoValidFallbackURL = errors.New("the given fallback URL is no valid URL")
+
+// ErrInvalidAccessPolicy is returned when the access policy of an entry is not valid
+var ErrInvalidAccessPolicy = errors.New("the given access policy is not valid")
+
+// ErrNoValidCIDR is returned when one of the allowed CIDRs is not valid
+var ErrNoValidCIDR = errors.New("the given allowed CIDRs are not valid")
+
+// ErrReservedID is returned when the given ID is used by the routes or the assets
+var ErrReservedID = errors.New("the given ID is reserved")
+
+// ErrInvalidSharedWith is returned when one of the identities an entry is shared with is not valid
+var ErrInvalidSharedWith = errors.New("the given identities to share with are not valid, they have to be in the form of 'provider/id'")
+
 // ErrEntryIsExpired is returned when the entry is expired
 var ErrEntryIsExpired = errors.New("entry is expired")
 
+// ErrEntryIsSuspended is returned when the entry was suspended by an admin
+var ErrEntryIsSuspended = errors.New("entry is suspended")
+
 // New initializes the store with the db
 func New() (*Store, error) {
 	var err error
@@ -55,10 +89,59 @@ func New() (*Store, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "could not initialize the data backend")
 	}
-	return &Store{
-		storage:  s,
-		idLength: util.GetConfig().ShortedIDLength,
-	}, nil
+	s = instrumentStorage(util.GetConfig().Backend, s)
+	protection, err := newPasswordProtection()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize the password protection")
+	}
+	privacy, err := newPrivacy()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize the privacy settings")
+	}
+	webhooks, err := newWebhookSettings()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize the webhooks")
+	}
+	fetcher, err := newMetadataFetcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize the metadata fetcher")
+	}
+	store := &Store{
+		storage:            s,
+		idLength:           util.GetConfig().ShortedIDLength,
+		passwordProtection: protection,
+		countBots:          util.GetConfig().Visitors.CountBots,
+		privacy:            privacy,
+		webhooks:           webhooks,
+		metadata:           fetcher,
+		stop:               make(chan struct{}),
+		workers:            &sync.WaitGroup{},
+	}
+	if window := util.GetConfig().Visitors.DuplicateClickWindow; window != "" {
+		if store.duplicateWindow, err = time.ParseDuration(window); err != nil {
+			return nil, errors.Wrap(err, "could not parse the duplicate click window")
+		}
+	}
+	if store.sessionLifetime, err = parseDurationOr(util.GetConfig().Sessions.RefreshTokenLifetime, defaultSessionLifetime); err != nil {
+		return nil, errors.Wrap(err, "could not parse the refresh token lifetime")
+	}
+	if err := store.migrateRollups(); err != nil {
+		return nil, errors.Wrap(err, "could not build the rollups")
+	}
+	if retention := util.GetConfig().Visitors.Retention; retention != "" {
+		duration, err := time.ParseDuration(retention)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not parse the visitor retention")
+		}
+		store.workers.Add(1)
+		go store.pruneVisitors(duration, time.Hour)
+	}
+	if err := store.migrateSearchIndex(); err != nil {
+		return nil, errors.Wrap(err, "could not build the search index")
+	}
+	store.workers.Add(1)
+	go store.deliverWebhooks(time.Second)
+	return store, nil
 }
 
 // GetEntryByID returns a unmarshalled entry of the db by a given ID
@@ -69,15 +152,30 @@ func (s *Store) GetEntryByID(id string) (*shared.Entry, error) {
 	return s.storage.GetEntryByID(id)
 }
 
-// GetEntryAndIncrease Increases the visitor count, checks
-// if the URL is expired and returns the origin URL
-func (s *Store) GetEntryAndIncrease(id string) (*shared.Entry, error) {
+// GetActiveEntryByID returns an entry and checks if it is suspended or
+// expired. If the entry is expired, it is returned together with
+// ErrEntryIsExpired so that the caller can make use of its fallback URL.
+func (s *Store) GetActiveEntryByID(id string) (*shared.Entry, error) {
 	entry, err := s.GetEntryByID(id)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not fetch entry "+id)
 	}
+	if entry.Public.Suspended {
+		return entry, ErrEntryIsSuspended
+	}
 	if entry.Public.Expiration != nil && !entry.Public.Expiration.IsZero() && time.Now().After(*entry.Public.Expiration) {
-		return nil, ErrEntryIsExpired
+		s.dispatchExpired(id, entry)
+		return entry, ErrEntryIsExpired
+	}
+	return entry, nil
+}
+
+// GetEntryAndIncrease Increases the visitor count, checks
+// if the URL is expired and returns the origin URL
+func (s *Store) GetEntryAndIncrease(id string) (*shared.Entry, error) {
+	entry, err := s.GetActiveEntryByID(id)
+	if err != nil {
+		return entry, err
 	}
 	if err := s.storage.IncreaseVisitCounter(id); err != nil {
 		return nil, errors.Wrap(err, "could not increase visitor counter")
@@ -86,19 +184,92 @@ func (s *Store) GetEntryAndIncrease(id string) (*shared.Entry, error) {
 	return entry, nil
 }
 
-// CreateEntry creates a new record and returns his short id
-func (s *Store) CreateEntry(entry shared.Entry, givenID, password string) (string, []byte, error) {
+// prepareEntry validates and normalizes a new entry and hashes its password
+func prepareEntry(entry *shared.Entry, password string) error {
 	entry.Public.URL = strings.Replace(entry.Public.URL, " ", "%20", -1)
 	if !govalidator.IsURL(entry.Public.URL) {
-		return "", nil, ErrNoValidURL
+		return ErrNoValidURL
 	}
-	if password != "" {
-		var err error
-		entry.Password, err = bcrypt.GenerateFromPassword([]byte(password), 10)
+	if entry.Public.FallbackURL != "" {
+		entry.Public.FallbackURL = strings.Replace(entry.Public.FallbackURL, " ", "%20", -1)
+		if !govalidator.IsURL(entry.Public.FallbackURL) {
+			return ErrNoValidFallbackURL
+		}
+	}
+	if entry.Access != nil {
+		switch entry.Access.Mode {
+		case "", shared.AccessPublic:
+			entry.Access = nil
+		case shared.AccessAuthenticated:
+		case shared.AccessRestricted:
+			if len(entry.Access.Identities) == 0 && len(entry.Access.EmailDomains) == 0 {
+				return ErrInvalidAccessPolicy
+			}
+		default:
+			return ErrInvalidAccessPolicy
+		}
+	}
+	for i, cidr := range entry.AllowedCIDRs {
+		normalized, err := normalizeCIDR(cidr)
 		if err != nil {
-			return "", nil, errors.Wrap(err, "could not generate bcrypt from password")
+			return ErrNoValidCIDR
+		}
+		entry.AllowedCIDRs[i] = normalized
+	}
+	for i, identity := range entry.SharedWith {
+		if entry.SharedWith[i] = strings.TrimSpace(identity); !validIdentity(entry.SharedWith[i]) {
+			return ErrInvalidSharedWith
 		}
 	}
+	var err error
+	if entry.Tags, err = normalizeTags(entry.Tags); err != nil {
+		return err
+	}
+	if entry.Notes = strings.TrimSpace(entry.Notes); len(entry.Notes) > maxNotes {
+		return ErrNotesTooLong
+	}
+	if password != "" {
+		if entry.Password, err = hashPassword(password); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashPassword returns the bcrypt hash of the password of an entry
+func hashPassword(password string) ([]byte, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not generate bcrypt from password")
+	}
+	return hash, nil
+}
+
+// reservedIDs are the first path segments which are used by the routes or
+// the assets of the frontend, entries with them would be shadowed or would
+// shadow the assets
+var reservedIDs = map[string]bool{
+	"api": true, "d": true, "ok": true, "metrics": true, "static": true, "images": true,
+	"index.html": true, "favicon.ico": true, "manifest.json": true, "asset-manifest.json": true, "service-worker.js": true,
+}
+
+// validateID checks that a given ID is not reserved
+func validateID(id string) error {
+	if reservedIDs[strings.SplitN(id, "/", 2)[0]] {
+		return ErrReservedID
+	}
+	return nil
+}
+
+// CreateEntry creates a new record and returns his short id, a given id
+// must not be reserved by the routes or the assets
+func (s *Store) CreateEntry(entry shared.Entry, givenID, password string) (string, []byte, error) {
+	if err := validateID(givenID); err != nil {
+		return "", nil, err
+	}
+	if err := prepareEntry(&entry, password); err != nil {
+		return "", nil, err
+	}
 	// try it 10 times to make a short URL
 	for i := 1; i <= 10; i++ {
 		id, passwordHash, err := s.createEntry(entry, givenID)
@@ -106,8 +277,12 @@ func (s *Store) CreateEntry(entry shared.Entry, givenID, password string) (strin
 			return "", nil, err
 		} else if err != nil {
 			logrus.Debugf("Could not create entry: %v", err)
+			metrics.IDRetries.Inc()
 			continue
 		}
+		metrics.EntriesCreated.Inc()
+		s.fetchMetadataInBackground(id)
+		s.dispatch(shared.EventEntryCreated, getUserIdentifier(entry.OAuthProvider, entry.OAuthID), id, entry.Public)
 		return id, passwordHash, nil
 	}
 	return "", nil, ErrGeneratingIDFailed
@@ -122,20 +297,210 @@ func (s *Store) DeleteEntry(id string, givenHmac []byte) error {
 	if !hmac.Equal(mac.Sum(nil), givenHmac) {
 		return errors.New("hmac verification failed")
 	}
-	return errors.Wrap(s.storage.DeleteEntry(id), "could not delete entry")
+	return s.deleteEntry(id)
+}
+
+// deleteEntry deletes an Entry fully from the DB without any verification
+func (s *Store) deleteEntry(id string) error {
+	entry, err := s.storage.GetEntryByID(id)
+	if err != nil {
+		return errors.Wrap(err, "could not get entry")
+	}
+	if err := s.storage.DeleteEntry(id); err != nil {
+		return errors.Wrap(err, "could not delete entry")
+	}
+	s.unindexEntry(id)
+	metrics.EntriesDeleted.Inc()
+	s.dispatch(shared.EventEntryDeleted, getUserIdentifier(entry.OAuthProvider, entry.OAuthID), id, entry.Public)
+	return nil
 }
 
 // RegisterVisit registers an new incoming request in the store
+// and increases the visitor count of the entry. Visits of bots are
+// recorded separately and not counted, unless this is configured. The IP
+// address is anonymized according to the privacy settings before it is
+// logged or stored.
 func (s *Store) RegisterVisit(id string, visitor shared.Visitor) {
+	now := visitor.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if s.isDuplicateVisit(id, visitor) {
+		logrus.WithField("ID", id).Debug("Duplicate redirect was not registered")
+		return
+	}
+	fingerprint := visitorFingerprint(visitor.IP, visitor.UserAgent, now)
+	visitor.IP = s.privacy.anonymizeIP(visitor.IP, now)
+	info := useragent.Parse(visitor.UserAgent)
+	visitor.Browser, visitor.OS, visitor.DeviceType, visitor.Bot = info.Browser, info.OS, info.DeviceType, info.Bot
 	requestID := uuid.New()
 	logrus.WithFields(logrus.Fields{
 		"ClientIP":  visitor.IP,
 		"ID":        id,
 		"RequestID": requestID,
+		"Bot":       visitor.Bot,
 	}).Info("New redirect was registered...")
+	if visitor.Bot && !s.countBots {
+		if err := s.storage.RegisterBotVisitor(id, requestID, visitor); err != nil {
+			logrus.Warningf("could not register bot visit: %v", err)
+		}
+		return
+	}
+	if err := s.storage.IncreaseVisitCounter(id); err != nil {
+		logrus.Warningf("could not increase visitor counter: %v", err)
+	}
 	if err := s.storage.RegisterVisitor(id, requestID, visitor); err != nil {
 		logrus.Warningf("could not register visit: %v", err)
 	}
+	if err := s.storage.AddUniqueVisitor(id, now, fingerprint); err != nil {
+		logrus.Warningf("could not add unique visitor: %v", err)
+	}
+	if err := s.storage.PublishVisit(shared.VisitEvent{ID: id, Visitor: visitor}); err != nil {
+		logrus.Warningf("could not publish visit: %v", err)
+	}
+	if entry, err := s.storage.GetEntryByID(id); err != nil {
+		logrus.Warningf("could not get entry for webhooks: %v", err)
+	} else {
+		s.dispatch(shared.EventEntryVisited, getUserIdentifier(entry.OAuthProvider, entry.OAuthID), id, visitor)
+	}
+}
+
+// SubscribeVisits returns a channel which receives the registered visits of
+// all entries and a function which has to be called to unsubscribe
+func (s *Store) SubscribeVisits() (<-chan shared.VisitEvent, func()) {
+	return s.storage.SubscribeVisits()
+}
+
+// GetUniqueVisitors returns the approximate number of unique visitors
+// of a shorted URL over the given days (UTC)
+func (s *Store) GetUniqueVisitors(id string, days ...time.Time) (int, error) {
+	count, err := s.storage.CountUniqueVisitors(id, days)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not count unique visitors")
+	}
+	return count, nil
+}
+
+// isDuplicateVisit checks if the same client already visited the entry within
+// the duplicate click window. The marker is stored in the backend, so
+// duplicates are detected across multiple instances.
+func (s *Store) isDuplicateVisit(id string, visitor shared.Visitor) bool {
+	if s.duplicateWindow <= 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, util.GetPrivateKey())
+	mac.Write([]byte(id + "\n" + visitor.IP + "\n" + visitor.UserAgent))
+	set, err := s.storage.SetIfAbsent("visit:"+hex.EncodeToString(mac.Sum(nil)), s.duplicateWindow)
+	if err != nil {
+		logrus.Warningf("could not check for duplicate visit: %v", err)
+		return false
+	}
+	return !set
+}
+
+// RegisterUntrackedVisit registers a visit like RegisterVisit, e.g. when the
+// client requested to not be tracked, but the visitor itself is neither
+// stored nor published. Bots and duplicates are skipped in the same way and
+// the visit is only added to the counter, the rollups and the uniques.
+func (s *Store) RegisterUntrackedVisit(id string, visitor shared.Visitor) {
+	now := visitor.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+		visitor.Timestamp = now
+	}
+	if s.isDuplicateVisit(id, visitor) {
+		logrus.WithField("ID", id).Debug("Duplicate redirect was not registered")
+		return
+	}
+	bot := useragent.Parse(visitor.UserAgent).Bot
+	logrus.WithFields(logrus.Fields{
+		"ID":         id,
+		"DoNotTrack": true,
+		"Bot":        bot,
+	}).Info("New redirect was registered...")
+	if bot && !s.countBots {
+		return
+	}
+	if err := s.storage.IncreaseVisitCounter(id); err != nil {
+		logrus.Warningf("could not increase visitor counter: %v", err)
+	}
+	counters := map[string]int{}
+	for _, counter := range shared.RollupCounters(visitor) {
+		counters[counter]++
+	}
+	if err := s.storage.AddRollups(id, counters); err != nil {
+		logrus.Warningf("could not add rollups: %v", err)
+	}
+	if err := s.storage.AddUniqueVisitor(id, now, visitorFingerprint(visitor.IP, visitor.UserAgent, now)); err != nil {
+		logrus.Warningf("could not add unique visitor: %v", err)
+	}
+}
+
+// errEndOfRange stops the iteration of the visitors at the end of the range
+var errEndOfRange = errors.New("end of the time range")
+
+// IterateVisitors calls fn for every visit of a shorted URL within the given
+// time range, oldest first, without loading all of them into memory. Zero
+// times leave the range open. Since the storages iterate the visitors in
+// the order of their visits, the iteration stops at the end of the range.
+func (s *Store) IterateVisitors(id string, from, to time.Time, fn func(shared.Visitor) error) error {
+	if !from.IsZero() || !to.IsZero() {
+		visited, err := s.visitedBetween(id, from, to)
+		if err != nil {
+			return err
+		} else if !visited {
+			return nil
+		}
+	}
+	err := s.storage.IterateVisitors(id, func(visitor shared.Visitor) error {
+		if !from.IsZero() && visitor.Timestamp.Before(from) {
+			return nil
+		}
+		if !to.IsZero() && !visitor.Timestamp.Before(to) {
+			return errEndOfRange
+		}
+		return fn(visitor)
+	})
+	if err == errEndOfRange {
+		return nil
+	}
+	return errors.Wrap(err, "could not iterate visitors")
+}
+
+// visitedBetween checks with the hourly rollup counters of an entry if it
+// could have been visited in the time range, so that the visitors of the
+// entries which were not don't have to be read. Entries without rollups
+// might have been visited.
+func (s *Store) visitedBetween(id string, from, to time.Time) (bool, error) {
+	rollups, err := s.storage.GetRollups(id)
+	if err != nil {
+		return false, errors.Wrap(err, "could not get rollups")
+	}
+	if len(rollups) == 0 {
+		return true, nil
+	}
+	for counter := range rollups {
+		if !strings.HasPrefix(counter, shared.RollupHour) {
+			continue
+		}
+		hour, err := shared.ParseRollupTime(shared.RollupHourLayout, strings.TrimPrefix(counter, shared.RollupHour))
+		if err != nil {
+			continue
+		}
+		if (from.IsZero() || hour.Add(time.Hour).After(from)) && (to.IsZero() || hour.Before(to)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetBotVisitors returns all the visits of bots of a shorted URL
+func (s *Store) GetBotVisitors(id string) ([]shared.Visitor, error) {
+	visitors, err := s.storage.GetBotVisitors(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get bot visitors")
+	}
+	return visitors, nil
 }
 
 // GetVisitors returns all the visits of a shorted URL
@@ -157,15 +522,54 @@ func (s *Store) GetUserEntries(oAuthProvider, oAuthID string) (map[string]shared
 	return entries, nil
 }
 
+// GetSharedEntries returns the entries which are shared with an user, there
+// is no index of them so all entries are scanned
+func (s *Store) GetSharedEntries(oAuthProvider, oAuthID string) (map[string]shared.Entry, error) {
+	entries := map[string]shared.Entry{}
+	err := s.storage.IterateEntries(func(id string, entry shared.Entry) error {
+		if entry.IsSharedWith(oAuthProvider, oAuthID) {
+			entries[id] = entry
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not iterate entries")
+	}
+	return entries, nil
+}
+
 func getUserIdentifier(oAuthProvider, oAuthID string) string {
 	return oAuthProvider + oAuthID
 }
 
-// Close closes the bolt db database
+// Close stops the background workers and closes the database
 func (s *Store) Close() error {
+	close(s.stop)
+	s.workers.Wait()
 	return s.storage.Close()
 }
 
+// pruneVisitors periodically deletes the visitors which are older than the
+// retention, the statistics of them are kept in the rollup counters
+func (s *Store) pruneVisitors(retention, interval time.Duration) {
+	defer s.workers.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		pruned, err := s.storage.PruneVisitors(time.Now().Add(-retention))
+		if err != nil {
+			logrus.Warningf("could not prune visitors: %v", err)
+		} else if pruned > 0 {
+			logrus.Infof("Pruned %d visitors which are older than %s", pruned, retention)
+		}
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
 // createEntry creates a new entry with a randomly generated id. If on is present
 // then the given ID is used
 func (s *Store) createEntry(entry shared.Entry, entryID string) (string, []byte, error) {
@@ -176,14 +580,37 @@ func (s *Store) createEntry(entry shared.Entry, entryID string) (string, []byte,
 		}
 	}
 	entry.Public.CreatedOn = time.Now()
+	if err := s.storage.CreateEntry(entry, entryID, getEntryOwner(entry)); err != nil {
+		return "", nil, errors.Wrap(err, "could not create entry")
+	}
+	s.indexEntry(entryID, entry)
+	return entryID, deletionHMAC(entryID), nil
+}
+
+// deletionHMAC returns the HMAC of the ID of an entry, which authorizes the
+// deletion of the entry without being its owner
+func deletionHMAC(id string) []byte {
 	mac := hmac.New(sha512.New, util.GetPrivateKey())
-	if _, err := mac.Write([]byte(entryID)); err != nil {
-		return "", nil, errors.Wrap(err, "could not write hmac")
+	// writing to a hash never returns an error
+	mac.Write([]byte(id))
+	return mac.Sum(nil)
+}
+
+// normalizeCIDR parses a CIDR and returns it in its canonical form. Single
+// IP addresses are converted into a CIDR which only contains the address.
+func normalizeCIDR(cidr string) (string, error) {
+	cidr = strings.TrimSpace(cidr)
+	if ip := net.ParseIP(cidr); ip != nil {
+		if ip.To4() != nil {
+			return ip.String() + "/32", nil
+		}
+		return ip.String() + "/128", nil
 	}
-	if err := s.storage.CreateEntry(entry, entryID, getUserIdentifier(entry.OAuthProvider, entry.OAuthID)); err != nil {
-		return "", nil, errors.Wrap(err, "could not create entry")
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
 	}
-	return entryID, mac.Sum(nil), nil
+	return network.String(), nil
 }
 
 // generateRandomString generates a random string with an predefined length
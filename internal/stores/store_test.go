@@ -1,9 +1,19 @@
 package stores
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/boltdb/bolt"
 	"github.com/pkg/errors"
 
 	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
@@ -119,3 +129,1056 @@ func TestStore(t *testing.T) {
 		t.Errorf("could not remove database: %v", err)
 	}
 }
+
+func TestCheckPassword(t *testing.T) {
+	config := util.Configuration{
+		DataDir:         testData.DataDir,
+		Backend:         "boltdb",
+		ShortedIDLength: 4,
+	}
+	config.PasswordProtection.FreeAttempts = 1
+	config.PasswordProtection.BackoffBase = "1h"
+	config.PasswordProtection.MaxAttempts = 3
+	config.PasswordProtection.LockoutDuration = "2h"
+	util.SetConfig(config)
+	if err := os.MkdirAll(testData.DataDir, 0755); err != nil {
+		t.Fatalf("could not create data dir: %v", err)
+	}
+	defer os.RemoveAll(testData.DataDir)
+	store, err := New()
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	defer store.Close()
+	entryID, _, err := store.CreateEntry(testData.Entry, "", testData.Password)
+	if err != nil {
+		t.Fatalf("could not create entry: %v", err)
+	}
+	entry, err := store.GetEntryByID(entryID)
+	if err != nil {
+		t.Fatalf("could not get entry: %v", err)
+	}
+	if err := store.CheckPassword(entryID, "203.0.113.1", entry, testData.Password); err != nil {
+		t.Fatalf("could not check correct password: %v", err)
+	}
+	if err := store.CheckPassword(entryID, "203.0.113.1", entry, "wrong"); err != ErrInvalidPassword {
+		t.Fatalf("unexpected error for wrong password: %v", err)
+	}
+	if err := store.CheckPassword(entryID, "203.0.113.1", entry, testData.Password); err != ErrTooManyAttempts {
+		t.Fatalf("unexpected error for throttled entry: %v", err)
+	}
+	if err := store.CheckPassword(entryID, "203.0.113.2", entry, testData.Password); err != ErrTooManyAttempts {
+		t.Fatalf("unexpected error for throttled entry from another IP: %v", err)
+	}
+	entryID, _, err = store.CreateEntry(testData.Entry, "", testData.Password)
+	if err != nil {
+		t.Fatalf("could not create entry: %v", err)
+	}
+	var wg sync.WaitGroup
+	results := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results <- store.CheckPassword(entryID, fmt.Sprintf("198.51.100.%d", i), entry, "wrong")
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+	invalid := 0
+	for err := range results {
+		if err == ErrInvalidPassword {
+			invalid++
+		} else if err != ErrTooManyAttempts {
+			t.Fatalf("unexpected error for concurrent attempt: %v", err)
+		}
+	}
+	if invalid != 1 {
+		t.Fatalf("%d concurrent attempts were compared, expected only 1", invalid)
+	}
+}
+
+func TestPasswordWaitTime(t *testing.T) {
+	p := passwordProtection{freeAttempts: 1, backoffBase: time.Second}
+	if wait := p.waitTime(&shared.Attempts{Count: 200, LastAttempt: time.Now()}); wait <= 23*time.Hour || wait > maxPasswordBackoff {
+		t.Fatalf("backoff was not clamped: %v", wait)
+	}
+	p.lockout = time.Hour
+	if wait := p.waitTime(&shared.Attempts{Count: 200, LastAttempt: time.Now()}); wait <= 59*time.Minute || wait > time.Hour {
+		t.Fatalf("backoff was not limited by the lockout: %v", wait)
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	util.SetConfig(util.Configuration{
+		DataDir:         testData.DataDir,
+		Backend:         "boltdb",
+		ShortedIDLength: 4,
+	})
+	if err := os.MkdirAll(testData.DataDir, 0755); err != nil {
+		t.Fatalf("could not create data dir: %v", err)
+	}
+	defer os.RemoveAll(testData.DataDir)
+	store, err := New()
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	defer store.Close()
+	entryID, _, err := store.CreateEntry(testData.Entry, "", "")
+	if err != nil {
+		t.Fatalf("could not create entry: %v", err)
+	}
+	day := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+	for _, visitor := range []shared.Visitor{
+		{Timestamp: day, Referer: "https://example.com/foo", UTMSource: "newsletter", Country: "DE"},
+		{Timestamp: day.Add(time.Hour), Referer: "https://example.com/bar", Country: "DE"},
+		{Timestamp: day.Add(24 * time.Hour)},
+	} {
+		store.RegisterVisit(entryID, visitor)
+	}
+	stats, err := store.GetStats(entryID, StatsQuery{Interval: IntervalDay})
+	if err != nil {
+		t.Fatalf("could not get stats: %v", err)
+	}
+	if len(stats.Clicks) != 2 || !stats.Clicks[0].Time.Equal(day.Truncate(24*time.Hour)) || stats.Clicks[0].Count != 2 || stats.Clicks[1].Count != 1 {
+		t.Errorf("clicks are not the expected ones: %+v", stats.Clicks)
+	}
+	if len(stats.Referrers) != 2 || stats.Referrers[0] != (StatsCount{Value: "example.com", Count: 2}) {
+		t.Errorf("referrers are not the expected ones: %+v", stats.Referrers)
+	}
+	if len(stats.UTMSources) != 1 || stats.UTMSources[0] != (StatsCount{Value: "newsletter", Count: 1}) {
+		t.Errorf("utm sources are not the expected ones: %+v", stats.UTMSources)
+	}
+	if len(stats.Countries) != 1 || stats.Countries[0] != (StatsCount{Value: "DE", Count: 2}) {
+		t.Errorf("countries are not the expected ones: %+v", stats.Countries)
+	}
+	if stats.UniqueVisitors != 2 || stats.Clicks[0].Uniques != 1 || stats.Clicks[1].Uniques != 1 {
+		t.Errorf("unique visitors are not the expected ones: %d, %+v", stats.UniqueVisitors, stats.Clicks)
+	}
+	stats, err = store.GetStats(entryID, StatsQuery{Interval: IntervalDay, From: day.Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("could not get stats: %v", err)
+	}
+	if len(stats.Referrers) != 1 || stats.Referrers[0] != (StatsCount{Value: shared.RollupDirect, Count: 1}) || len(stats.Countries) != 0 {
+		t.Errorf("dimensions are not limited to the range: %+v, %+v", stats.Referrers, stats.Countries)
+	}
+	store.RegisterVisit(entryID, shared.Visitor{Timestamp: day.Add(48 * time.Hour), Referer: "no url", UTMSource: strings.Repeat("x", 100), UTMCampaign: " Spring "})
+	stats, err = store.GetStats(entryID, StatsQuery{Interval: IntervalDay, From: day.Add(48 * time.Hour)})
+	if err != nil {
+		t.Fatalf("could not get stats: %v", err)
+	}
+	if len(stats.Referrers) != 1 || stats.Referrers[0].Value != shared.RollupOther || len(stats.UTMSources) != 1 || stats.UTMSources[0].Value != shared.RollupOther {
+		t.Errorf("unbounded values are not counted as other ones: %+v, %+v", stats.Referrers, stats.UTMSources)
+	}
+	if len(stats.UTMCampaigns) != 1 || stats.UTMCampaigns[0].Value != "spring" {
+		t.Errorf("utm campaigns are not normalized: %+v", stats.UTMCampaigns)
+	}
+	store.RegisterVisit(entryID, shared.Visitor{Timestamp: day, IP: "203.0.113.7"})
+	if uniques, err := store.GetUniqueVisitors(entryID, day); err != nil || uniques != 2 {
+		t.Errorf("unique visitors are not the expected ones: %d, %v", uniques, err)
+	}
+	if _, err := store.GetStats(entryID, StatsQuery{Interval: "year"}); err != ErrInvalidInterval {
+		t.Errorf("unexpected error for invalid interval: %v", err)
+	}
+}
+
+func TestMigrateRollups(t *testing.T) {
+	util.SetConfig(util.Configuration{
+		DataDir:         testData.DataDir,
+		Backend:         "boltdb",
+		ShortedIDLength: 4,
+	})
+	if err := os.MkdirAll(testData.DataDir, 0755); err != nil {
+		t.Fatalf("could not create data dir: %v", err)
+	}
+	defer os.RemoveAll(testData.DataDir)
+	store, err := New()
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	entryID, _, err := store.CreateEntry(testData.Entry, "", "")
+	if err != nil {
+		t.Fatalf("could not create entry: %v", err)
+	}
+	day := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+	store.RegisterVisit(entryID, shared.Visitor{Timestamp: day, Referer: "https://example.com/foo"})
+	store.RegisterVisit(entryID, shared.Visitor{Timestamp: day.Add(24 * time.Hour)})
+	if err := store.Close(); err != nil {
+		t.Fatalf("could not close store: %v", err)
+	}
+	// drop the rollups and the marker, as if the visits were registered before the rollups existed
+	db, err := bolt.Open(filepath.Join(testData.DataDir, "main.db"), 0644, nil)
+	if err != nil {
+		t.Fatalf("could not open database: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte("rollups")); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("markers")).Delete([]byte(rollupsMarker))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatalf("could not drop the rollups: %v", err)
+	}
+	if store, err = New(); err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	defer store.Close()
+	// a new visit must not hide the migrated history
+	store.RegisterVisit(entryID, shared.Visitor{Timestamp: day.Add(48 * time.Hour)})
+	stats, err := store.GetStats(entryID, StatsQuery{Interval: IntervalDay})
+	if err != nil {
+		t.Fatalf("could not get stats: %v", err)
+	}
+	if len(stats.Clicks) != 3 || stats.Clicks[0].Count != 1 || !stats.Clicks[0].Time.Equal(day.Truncate(24*time.Hour)) {
+		t.Errorf("clicks are not the expected ones: %+v", stats.Clicks)
+	}
+	if len(stats.Referrers) != 2 || stats.Referrers[0] != (StatsCount{Value: "(direct)", Count: 2}) {
+		t.Errorf("referrers are not the expected ones: %+v", stats.Referrers)
+	}
+}
+
+func TestPruneVisitors(t *testing.T) {
+	util.SetConfig(util.Configuration{
+		DataDir:         testData.DataDir,
+		Backend:         "boltdb",
+		ShortedIDLength: 4,
+	})
+	if err := os.MkdirAll(testData.DataDir, 0755); err != nil {
+		t.Fatalf("could not create data dir: %v", err)
+	}
+	defer os.RemoveAll(testData.DataDir)
+	store, err := New()
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	defer store.Close()
+	entryID, _, err := store.CreateEntry(testData.Entry, "", "")
+	if err != nil {
+		t.Fatalf("could not create entry: %v", err)
+	}
+	day := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+	for _, visitor := range []shared.Visitor{
+		{Timestamp: day},
+		{Timestamp: day.Add(time.Hour)},
+		{Timestamp: day.Add(24 * time.Hour)},
+	} {
+		store.RegisterVisit(entryID, visitor)
+	}
+	pruned, err := store.storage.PruneVisitors(day.Add(12 * time.Hour))
+	if err != nil {
+		t.Fatalf("could not prune visitors: %v", err)
+	}
+	if pruned != 2 {
+		t.Errorf("pruned visitors are not the expected ones: %d", pruned)
+	}
+	visitors, err := store.GetVisitors(entryID)
+	if err != nil {
+		t.Fatalf("could not get visitors: %v", err)
+	}
+	if len(visitors) != 1 {
+		t.Errorf("remaining visitors are not the expected ones: %+v", visitors)
+	}
+	entry, err := store.GetEntryByID(entryID)
+	if err != nil {
+		t.Fatalf("could not get entry: %v", err)
+	}
+	if entry.Public.VisitCount != 3 {
+		t.Errorf("visit count changed after pruning: %d", entry.Public.VisitCount)
+	}
+	location := time.FixedZone("UTC+13:30", 13*60*60+30*60)
+	stats, err := store.GetStats(entryID, StatsQuery{Interval: IntervalDay, Location: location})
+	if err != nil {
+		t.Fatalf("could not get stats: %v", err)
+	}
+	if len(stats.Clicks) != 2 || stats.Clicks[0].Count != 1 || stats.Clicks[1].Count != 2 {
+		t.Errorf("clicks are not the expected ones after pruning: %+v", stats.Clicks)
+	}
+}
+
+func TestRegisterBotVisit(t *testing.T) {
+	util.SetConfig(util.Configuration{
+		DataDir:         testData.DataDir,
+		Backend:         "boltdb",
+		ShortedIDLength: 4,
+	})
+	if err := os.MkdirAll(testData.DataDir, 0755); err != nil {
+		t.Fatalf("could not create data dir: %v", err)
+	}
+	defer os.RemoveAll(testData.DataDir)
+	store, err := New()
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	defer store.Close()
+	entryID, _, err := store.CreateEntry(testData.Entry, "", "")
+	if err != nil {
+		t.Fatalf("could not create entry: %v", err)
+	}
+	store.RegisterVisit(entryID, shared.Visitor{Timestamp: time.Now(), UserAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"})
+	store.RegisterVisit(entryID, shared.Visitor{Timestamp: time.Now(), UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:63.0) Gecko/20100101 Firefox/63.0"})
+	entry, err := store.GetEntryByID(entryID)
+	if err != nil {
+		t.Fatalf("could not get entry: %v", err)
+	}
+	if entry.Public.VisitCount != 1 || entry.Public.BotVisitCount != 1 {
+		t.Errorf("visit counts are not the expected ones: %d visits, %d bot visits", entry.Public.VisitCount, entry.Public.BotVisitCount)
+	}
+	visitors, err := store.GetVisitors(entryID)
+	if err != nil {
+		t.Fatalf("could not get visitors: %v", err)
+	}
+	if len(visitors) != 1 || visitors[0].Bot || visitors[0].Browser != "Firefox" {
+		t.Errorf("visitors are not the expected ones: %+v", visitors)
+	}
+	bots, err := store.GetBotVisitors(entryID)
+	if err != nil {
+		t.Fatalf("could not get bot visitors: %v", err)
+	}
+	if len(bots) != 1 || !bots[0].Bot || bots[0].Browser != "Slack" {
+		t.Errorf("bot visitors are not the expected ones: %+v", bots)
+	}
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	day := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+	tt := []struct {
+		name, mode, ip, expected string
+	}{
+		{"full", IPModeFull, "203.0.113.6", "203.0.113.6"},
+		{"truncate ipv4", IPModeTruncate, "203.0.113.6", "203.0.113.0"},
+		{"truncate ipv6", IPModeTruncate, "2001:db8:1234:5678::1", "2001:db8:1234::"},
+		{"truncate invalid", IPModeTruncate, "foo", ""},
+		{"drop", IPModeDrop, "203.0.113.6", ""},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if ip := (privacy{ipMode: tc.mode}).anonymizeIP(tc.ip, day); ip != tc.expected {
+				t.Errorf("expected: %s; got: %s", tc.expected, ip)
+			}
+		})
+	}
+	p := privacy{ipMode: IPModeHash}
+	hashed := p.anonymizeIP("203.0.113.6", day)
+	if hashed == "" || hashed == "203.0.113.6" {
+		t.Errorf("ip is not hashed: %s", hashed)
+	}
+	if p.anonymizeIP("203.0.113.6", day.Add(time.Hour)) != hashed {
+		t.Errorf("hash changed within the same day")
+	}
+	if p.anonymizeIP("203.0.113.6", day.Add(24*time.Hour)) == hashed {
+		t.Errorf("hash did not change on the next day")
+	}
+}
+
+func TestDuplicateVisits(t *testing.T) {
+	config := util.Configuration{
+		DataDir:         testData.DataDir,
+		Backend:         "boltdb",
+		ShortedIDLength: 4,
+	}
+	config.Visitors.DuplicateClickWindow = "1h"
+	util.SetConfig(config)
+	if err := os.MkdirAll(testData.DataDir, 0755); err != nil {
+		t.Fatalf("could not create data dir: %v", err)
+	}
+	defer os.RemoveAll(testData.DataDir)
+	store, err := New()
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	defer store.Close()
+	entryID, _, err := store.CreateEntry(testData.Entry, "", "")
+	if err != nil {
+		t.Fatalf("could not create entry: %v", err)
+	}
+	for _, visitor := range []shared.Visitor{
+		{Timestamp: time.Now(), IP: "203.0.113.1", UserAgent: "foo"},
+		{Timestamp: time.Now(), IP: "203.0.113.1", UserAgent: "foo"},
+		{Timestamp: time.Now(), IP: "203.0.113.1", UserAgent: "bar"},
+		{Timestamp: time.Now(), IP: "203.0.113.2", UserAgent: "foo"},
+	} {
+		store.RegisterVisit(entryID, visitor)
+	}
+	entry, err := store.GetEntryByID(entryID)
+	if err != nil {
+		t.Fatalf("could not get entry: %v", err)
+	}
+	if entry.Public.VisitCount != 3 {
+		t.Errorf("duplicate visit was counted: %d visits", entry.Public.VisitCount)
+	}
+	visitors, err := store.GetVisitors(entryID)
+	if err != nil {
+		t.Fatalf("could not get visitors: %v", err)
+	}
+	if len(visitors) != 3 {
+		t.Errorf("duplicate visit was recorded: %+v", visitors)
+	}
+}
+
+func TestRegisterUntrackedVisit(t *testing.T) {
+	config := util.Configuration{
+		DataDir:         testData.DataDir,
+		Backend:         "boltdb",
+		ShortedIDLength: 4,
+	}
+	config.Visitors.DuplicateClickWindow = "1h"
+	util.SetConfig(config)
+	if err := os.MkdirAll(testData.DataDir, 0755); err != nil {
+		t.Fatalf("could not create data dir: %v", err)
+	}
+	defer os.RemoveAll(testData.DataDir)
+	store, err := New()
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	defer store.Close()
+	entryID, _, err := store.CreateEntry(testData.Entry, "", "")
+	if err != nil {
+		t.Fatalf("could not create entry: %v", err)
+	}
+	day := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+	for _, visitor := range []shared.Visitor{
+		{Timestamp: day, IP: "203.0.113.1", UserAgent: "foo", Referer: "https://example.com/foo"},
+		{Timestamp: day, IP: "203.0.113.1", UserAgent: "foo", Referer: "https://example.com/foo"},
+		{Timestamp: day, IP: "203.0.113.2", UserAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"},
+	} {
+		store.RegisterUntrackedVisit(entryID, visitor)
+	}
+	entry, err := store.GetEntryByID(entryID)
+	if err != nil {
+		t.Fatalf("could not get entry: %v", err)
+	}
+	if entry.Public.VisitCount != 1 {
+		t.Errorf("duplicate or bot visit was counted: %d visits", entry.Public.VisitCount)
+	}
+	visitors, err := store.GetVisitors(entryID)
+	if err != nil {
+		t.Fatalf("could not get visitors: %v", err)
+	}
+	bots, err := store.GetBotVisitors(entryID)
+	if err != nil {
+		t.Fatalf("could not get bot visitors: %v", err)
+	}
+	if len(visitors) != 0 || len(bots) != 0 {
+		t.Errorf("untracked visitors were recorded: %+v, %+v", visitors, bots)
+	}
+	stats, err := store.GetStats(entryID, StatsQuery{Interval: IntervalDay})
+	if err != nil {
+		t.Fatalf("could not get stats: %v", err)
+	}
+	if len(stats.Clicks) != 1 || stats.Clicks[0].Count != 1 || stats.UniqueVisitors != 1 {
+		t.Errorf("clicks are not the expected ones: %d, %+v", stats.UniqueVisitors, stats.Clicks)
+	}
+	if len(stats.Referrers) != 1 || stats.Referrers[0] != (StatsCount{Value: "example.com", Count: 1}) {
+		t.Errorf("referrers are not the expected ones: %+v", stats.Referrers)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	received := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+		if r.Header.Get("X-Gus-Event") == shared.EventEntryDeleted {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	config := util.Configuration{
+		DataDir:         testData.DataDir,
+		Backend:         "boltdb",
+		ShortedIDLength: 4,
+	}
+	config.Webhooks.MaxAttempts = 3
+	config.Webhooks.BackoffBase = "1h"
+	config.Webhooks.AllowPrivate = true
+	util.SetConfig(config)
+	if err := os.MkdirAll(testData.DataDir, 0755); err != nil {
+		t.Fatalf("could not create data dir: %v", err)
+	}
+	defer os.RemoveAll(testData.DataDir)
+	store, err := New()
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	defer store.Close()
+	if _, err := store.CreateWebhook(testData.oAuthProvider, testData.oAuthID, shared.Webhook{URL: "ftp://example.com"}); err != ErrNoValidWebhookURL {
+		t.Fatalf("unexpected error for invalid URL: %v", err)
+	}
+	store.webhooks.allowPrivate = false
+	if _, err := store.CreateWebhook(testData.oAuthProvider, testData.oAuthID, shared.Webhook{URL: server.URL}); err != ErrForbiddenWebhookURL {
+		t.Fatalf("unexpected error for loopback URL: %v", err)
+	}
+	store.webhooks.allowPrivate = true
+	webhook, err := store.CreateWebhook(testData.oAuthProvider, testData.oAuthID, shared.Webhook{
+		URL:    server.URL,
+		Events: []string{shared.EventEntryCreated, shared.EventEntryDeleted},
+	})
+	if err != nil {
+		t.Fatalf("could not create webhook: %v", err)
+	}
+	entry := testData.Entry
+	entry.OAuthProvider, entry.OAuthID = testData.oAuthProvider, testData.oAuthID
+	entryID, deletionHmac, err := store.CreateEntry(entry, "", "")
+	if err != nil {
+		t.Fatalf("could not create entry: %v", err)
+	}
+	select {
+	case r := <-received:
+		body := <-bodies
+		if r.Header.Get("X-Gus-Event") != shared.EventEntryCreated {
+			t.Errorf("event is not the expected one: %s", r.Header.Get("X-Gus-Event"))
+		}
+		if r.Header.Get(webhookSignatureHeader) != signPayload(webhook.Secret, body) {
+			t.Errorf("signature is not valid: %s", r.Header.Get(webhookSignatureHeader))
+		}
+		var payload WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil || payload.EntryID != entryID {
+			t.Errorf("payload is not the expected one: %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+	// visits are not subscribed
+	store.RegisterVisit(entryID, shared.Visitor{Timestamp: time.Now()})
+	if err := store.DeleteEntry(entryID, deletionHmac); err != nil {
+		t.Fatalf("could not delete entry: %v", err)
+	}
+	select {
+	case r := <-received:
+		<-bodies
+		if r.Header.Get("X-Gus-Event") != shared.EventEntryDeleted {
+			t.Errorf("event is not the expected one: %s", r.Header.Get("X-Gus-Event"))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+	var deliveries []shared.WebhookDelivery
+	for i := 0; i < 50; i++ {
+		if deliveries, err = store.GetWebhookDeliveries(testData.oAuthProvider, testData.oAuthID); err != nil {
+			t.Fatalf("could not get deliveries: %v", err)
+		}
+		if len(deliveries) == 2 && deliveries[0].Attempts == 1 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("deliveries are not the expected ones: %+v", deliveries)
+	}
+	if failed := deliveries[0]; failed.Status != shared.DeliveryPending || failed.ResponseStatus != http.StatusInternalServerError || failed.NextAttempt.Before(time.Now().Add(30*time.Minute)) {
+		t.Errorf("failed delivery is not retried later: %+v", failed)
+	}
+	if delivered := deliveries[1]; delivered.Status != shared.DeliveryDelivered || delivered.Attempts != 1 {
+		t.Errorf("delivery is not delivered: %+v", delivered)
+	}
+}
+
+func TestTeams(t *testing.T) {
+	util.SetConfig(util.Configuration{
+		DataDir:         testData.DataDir,
+		Backend:         "boltdb",
+		ShortedIDLength: 4,
+	})
+	if err := os.MkdirAll(testData.DataDir, 0755); err != nil {
+		t.Fatalf("could not create data dir: %v", err)
+	}
+	defer os.RemoveAll(testData.DataDir)
+	store, err := New()
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	defer store.Close()
+	creator := shared.Identity(testData.oAuthProvider, testData.oAuthID)
+	if _, err := store.CreateTeam(" ", creator); err != ErrNoValidTeamName {
+		t.Fatalf("unexpected error for empty name: %v", err)
+	}
+	team, err := store.CreateTeam("Marketing", creator)
+	if err != nil {
+		t.Fatalf("could not create team: %v", err)
+	}
+	if err := store.AddTeamMember(team.ID, "invalid"); err != ErrInvalidIdentity {
+		t.Fatalf("unexpected error for invalid identity: %v", err)
+	}
+	if err := store.AddTeamMember(team.ID, "github/42"); err != nil {
+		t.Fatalf("could not add team member: %v", err)
+	}
+	if err := store.AddTeamMember("does-not-exist", "github/42"); errors.Cause(err) != shared.ErrNoTeamFound {
+		t.Fatalf("unexpected error for unknown team: %v", err)
+	}
+	teams, err := store.GetUserTeams("github", "42")
+	if err != nil {
+		t.Fatalf("could not get user teams: %v", err)
+	}
+	if len(teams) != 1 || teams[0].ID != team.ID || len(teams[0].Members) != 2 {
+		t.Fatalf("teams are not the expected ones: %+v", teams)
+	}
+	entry := testData.Entry
+	entry.OAuthProvider, entry.OAuthID, entry.TeamID = testData.oAuthProvider, testData.oAuthID, team.ID
+	entryID, _, err := store.CreateEntry(entry, "", "")
+	if err != nil {
+		t.Fatalf("could not create entry: %v", err)
+	}
+	entries, err := store.GetTeamEntries(team.ID)
+	if err != nil {
+		t.Fatalf("could not get team entries: %v", err)
+	}
+	if _, ok := entries[entryID]; !ok || len(entries) != 1 {
+		t.Fatalf("team entries are not the expected ones: %+v", entries)
+	}
+	if entries, err = store.GetUserEntries(testData.oAuthProvider, testData.oAuthID); err != nil || len(entries) != 0 {
+		t.Fatalf("team entry is owned by its creator: %+v, %v", entries, err)
+	}
+	if err := store.RemoveTeamMember(team.ID, creator); err != nil {
+		t.Fatalf("could not remove team member: %v", err)
+	}
+	if teams, err = store.GetUserTeams(testData.oAuthProvider, testData.oAuthID); err != nil || len(teams) != 0 {
+		t.Fatalf("removed member still has teams: %+v, %v", teams, err)
+	}
+	if err := store.RemoveTeamMember(team.ID, "github/42"); errors.Cause(err) != shared.ErrLastTeamMember {
+		t.Fatalf("unexpected error for the last member: %v", err)
+	}
+}
+
+func TestAdminEntries(t *testing.T) {
+	util.SetConfig(util.Configuration{
+		DataDir:         testData.DataDir,
+		Backend:         "boltdb",
+		ShortedIDLength: 4,
+	})
+	if err := os.MkdirAll(testData.DataDir, 0755); err != nil {
+		t.Fatalf("could not create data dir: %v", err)
+	}
+	defer os.RemoveAll(testData.DataDir)
+	store, err := New()
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	defer store.Close()
+	entry := testData.Entry
+	entry.OAuthProvider, entry.OAuthID = testData.oAuthProvider, testData.oAuthID
+	for i := 0; i < 2; i++ {
+		if _, _, err := store.CreateEntry(entry, "", ""); err != nil {
+			t.Fatalf("could not create entry: %v", err)
+		}
+	}
+	entry.OAuthID = "other"
+	entryID, _, err := store.CreateEntry(entry, "", "")
+	if err != nil {
+		t.Fatalf("could not create entry: %v", err)
+	}
+	entries, err := store.SearchEntries(" " + testData.oAuthProvider + "/OTHER")
+	if err != nil {
+		t.Fatalf("could not search entries: %v", err)
+	}
+	if _, ok := entries[entryID]; !ok || len(entries) != 1 {
+		t.Fatalf("entries are not the expected ones: %+v", entries)
+	}
+	users, err := store.GetUserLinkCounts()
+	if err != nil {
+		t.Fatalf("could not get user link counts: %v", err)
+	}
+	if len(users) != 2 || users[0].Owner != shared.Identity(testData.oAuthProvider, testData.oAuthID) || users[0].Links != 2 || users[1].Links != 1 {
+		t.Fatalf("user link counts are not the expected ones: %+v", users)
+	}
+	if err := store.SuspendEntry(entryID, true); err != nil {
+		t.Fatalf("could not suspend entry: %v", err)
+	}
+	if _, err := store.GetActiveEntryByID(entryID); err != ErrEntryIsSuspended {
+		t.Fatalf("unexpected error for a suspended entry: %v", err)
+	}
+	if err := store.SuspendEntry(entryID, false); err != nil {
+		t.Fatalf("could not unsuspend entry: %v", err)
+	}
+	if _, err := store.GetActiveEntryByID(entryID); err != nil {
+		t.Fatalf("could not get unsuspended entry: %v", err)
+	}
+	if err := store.AdminDeleteEntry(entryID); err != nil {
+		t.Fatalf("could not delete entry: %v", err)
+	}
+	if err := store.SuspendEntry(entryID, true); errors.Cause(err) != shared.ErrNoEntryFound {
+		t.Fatalf("unexpected error for a deleted entry: %v", err)
+	}
+}
+
+func TestTransferEntry(t *testing.T) {
+	util.SetConfig(util.Configuration{
+		DataDir:         testData.DataDir,
+		Backend:         "boltdb",
+		ShortedIDLength: 4,
+	})
+	if err := os.MkdirAll(testData.DataDir, 0755); err != nil {
+		t.Fatalf("could not create data dir: %v", err)
+	}
+	defer os.RemoveAll(testData.DataDir)
+	store, err := New()
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	defer store.Close()
+	entry := testData.Entry
+	entry.OAuthProvider, entry.OAuthID = testData.oAuthProvider, testData.oAuthID
+	entryID, _, err := store.CreateEntry(entry, "", "")
+	if err != nil {
+		t.Fatalf("could not create entry: %v", err)
+	}
+	owner := shared.Identity(testData.oAuthProvider, testData.oAuthID)
+	if err := store.TransferEntry(entryID, "invalid", owner); err != ErrInvalidNewOwner {
+		t.Fatalf("unexpected error for invalid owner: %v", err)
+	}
+	if err := store.TransferEntry(entryID, owner, owner); errors.Cause(err) != ErrAlreadyOwner {
+		t.Fatalf("unexpected error for the current owner: %v", err)
+	}
+	if err := store.TransferEntry(entryID, shared.TeamEntriesPrefix+"does-not-exist", owner); errors.Cause(err) != shared.ErrNoTeamFound {
+		t.Fatalf("unexpected error for unknown team: %v", err)
+	}
+	if err := store.TransferEntry("does-not-exist", "github/42", owner); errors.Cause(err) != shared.ErrNoEntryFound {
+		t.Fatalf("unexpected error for unknown entry: %v", err)
+	}
+	if err := store.TransferEntry(entryID, "github/42", owner); err != nil {
+		t.Fatalf("could not transfer entry: %v", err)
+	}
+	if entries, err := store.GetUserEntries("github", "42"); err != nil || len(entries) != 1 || entries[entryID].OAuthID != "42" {
+		t.Fatalf("entries of the new owner are not the expected ones: %+v, %v", entries, err)
+	}
+	if entries, err := store.GetUserEntries(testData.oAuthProvider, testData.oAuthID); err != nil || len(entries) != 0 {
+		t.Fatalf("entries of the previous owner are not the expected ones: %+v, %v", entries, err)
+	}
+	team, err := store.CreateTeam("Marketing", "github/42")
+	if err != nil {
+		t.Fatalf("could not create team: %v", err)
+	}
+	if err := store.TransferEntry(entryID, shared.TeamEntriesPrefix+team.ID, "github/42"); err != nil {
+		t.Fatalf("could not transfer entry to team: %v", err)
+	}
+	if entries, err := store.GetTeamEntries(team.ID); err != nil || len(entries) != 1 {
+		t.Fatalf("team entries are not the expected ones: %+v, %v", entries, err)
+	}
+	events, err := store.GetAuditEvents(10)
+	if err != nil {
+		t.Fatalf("could not get audit events: %v", err)
+	}
+	if len(events) != 2 || events[0].To != shared.TeamEntriesPrefix+team.ID || events[1].From != owner || events[1].To != "github/42" || events[1].Actor != owner {
+		t.Fatalf("audit events are not the expected ones: %+v", events)
+	}
+}
+
+func TestSearchUserEntries(t *testing.T) {
+	util.SetConfig(util.Configuration{
+		DataDir:         testData.DataDir,
+		Backend:         "boltdb",
+		ShortedIDLength: 4,
+	})
+	if err := os.MkdirAll(testData.DataDir, 0755); err != nil {
+		t.Fatalf("could not create data dir: %v", err)
+	}
+	defer os.RemoveAll(testData.DataDir)
+	store, err := New()
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	defer store.Close()
+	entry := testData.Entry
+	entry.OAuthProvider, entry.OAuthID = testData.oAuthProvider, testData.oAuthID
+	entry.Tags = []string{"Marketing"}
+	entryID, _, err := store.CreateEntry(entry, "", "")
+	if err != nil {
+		t.Fatalf("could not create entry: %v", err)
+	}
+	search := func(query string) map[string]shared.Entry {
+		entries, err := store.SearchUserEntries(testData.oAuthProvider, testData.oAuthID, "", query)
+		if err != nil {
+			t.Fatalf("could not search entries: %v", err)
+		}
+		return entries
+	}
+	if _, ok := search("mark")[entryID]; !ok {
+		t.Fatal("entry was not found by its tag")
+	}
+	if _, err := store.SearchUserEntries(testData.oAuthProvider, testData.oAuthID, "", " "); err != ErrNoValidQuery {
+		t.Fatalf("unexpected error for an empty query: %v", err)
+	}
+	if err := store.TransferEntry(entryID, "github/42", "github/42"); err != nil {
+		t.Fatalf("could not transfer entry: %v", err)
+	}
+	if len(search("mark")) != 0 {
+		t.Fatal("transferred entry was found in the entries of the previous owner")
+	}
+	if entries, err := store.SearchUserEntries("github", "42", "", "mark"); err != nil || len(entries) != 1 {
+		t.Fatalf("transferred entry was not found in the entries of the new owner: %+v, %v", entries, err)
+	}
+	if err := store.AdminDeleteEntry(entryID); err != nil {
+		t.Fatalf("could not delete entry: %v", err)
+	}
+	ids, err := store.storage.SearchEntryIDs(getUserIdentifier("github", "42"), "mark")
+	if err != nil || len(ids) != 0 {
+		t.Fatalf("deleted entry is still in the search index: %v, %v", ids, err)
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	util.SetConfig(util.Configuration{
+		DataDir:         testData.DataDir,
+		Backend:         "boltdb",
+		ShortedIDLength: 4,
+	})
+	if err := os.MkdirAll(testData.DataDir, 0755); err != nil {
+		t.Fatalf("could not create data dir: %v", err)
+	}
+	defer os.RemoveAll(testData.DataDir)
+	store, err := New()
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	defer store.Close()
+	owner := shared.APIToken{OAuthProvider: testData.oAuthProvider, OAuthID: testData.oAuthID}
+	for _, tc := range []struct {
+		name  string
+		scope string
+		err   error
+	}{
+		{name: " ", err: ErrNoValidTokenName},
+		{name: "CI", scope: "write", err: ErrInvalidTokenScope},
+	} {
+		token := owner
+		token.Name, token.Scope = tc.name, tc.scope
+		if _, _, err := store.CreateAPIToken(token); err != tc.err {
+			t.Errorf("expected error: %v; got: %v", tc.err, err)
+		}
+	}
+	token := owner
+	token.Name = "CI"
+	plain, created, err := store.CreateAPIToken(token)
+	if err != nil {
+		t.Fatalf("could not create API token: %v", err)
+	}
+	if created.Scope != shared.TokenScopeFull || created.Hash == plain || !strings.HasPrefix(plain, APITokenPrefix) {
+		t.Fatalf("API token is not the expected one: %+v", created)
+	}
+	authenticated, err := store.AuthenticateAPIToken(plain)
+	if err != nil {
+		t.Fatalf("could not authenticate API token: %v", err)
+	}
+	if authenticated.ID != created.ID || authenticated.LastUsed == nil {
+		t.Fatalf("authenticated API token is not the expected one: %+v", authenticated)
+	}
+	if _, err := store.AuthenticateAPIToken(plain + "x"); errors.Cause(err) != shared.ErrNoAPITokenFound {
+		t.Fatalf("unexpected error for an unknown API token: %v", err)
+	}
+	tokens, err := store.GetAPITokens(testData.oAuthProvider, testData.oAuthID)
+	if err != nil || len(tokens) != 1 || tokens[0].LastUsed == nil {
+		t.Fatalf("API tokens are not the expected ones: %+v, %v", tokens, err)
+	}
+	if err := store.RevokeAPIToken("github", "42", created.ID); errors.Cause(err) != shared.ErrNoAPITokenFound {
+		t.Fatalf("API token of another user was revoked: %v", err)
+	}
+	if err := store.RevokeAPIToken(testData.oAuthProvider, testData.oAuthID, created.ID); err != nil {
+		t.Fatalf("could not revoke API token: %v", err)
+	}
+	if _, err := store.AuthenticateAPIToken(plain); errors.Cause(err) != shared.ErrNoAPITokenFound {
+		t.Fatalf("revoked API token was authenticated: %v", err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	util.SetConfig(util.Configuration{
+		DataDir:         testData.DataDir,
+		Backend:         "boltdb",
+		ShortedIDLength: 4,
+	})
+	if err := os.MkdirAll(testData.DataDir, 0755); err != nil {
+		t.Fatalf("could not create data dir: %v", err)
+	}
+	defer os.RemoveAll(testData.DataDir)
+	store, err := New()
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	defer store.Close()
+	user := shared.Session{OAuthProvider: testData.oAuthProvider, OAuthID: testData.oAuthID}
+	refreshToken, session, err := store.CreateSession(user)
+	if err != nil {
+		t.Fatalf("could not create session: %v", err)
+	}
+	if session.RefreshHash == "" || strings.Contains(session.RefreshHash, refreshToken) {
+		t.Fatalf("session is not the expected one: %+v", session)
+	}
+	newRefreshToken, refreshed, err := store.RefreshSession(refreshToken)
+	if err != nil {
+		t.Fatalf("could not refresh session: %v", err)
+	}
+	if refreshed.ID != session.ID || newRefreshToken == refreshToken {
+		t.Fatalf("refreshed session is not the expected one: %+v", refreshed)
+	}
+	for _, token := range []string{refreshToken, "invalid", session.ID + ".invalid"} {
+		if _, _, err := store.RefreshSession(token); err != ErrInvalidRefreshToken {
+			t.Errorf("unexpected error for refresh token %q: %v", token, err)
+		}
+	}
+	if found, err := store.GetRefreshTokenSession(newRefreshToken); err != nil || found.ID != session.ID {
+		t.Fatalf("session of the refresh token is not the expected one: %+v, %v", found, err)
+	}
+	if err := store.RevokeSession(session.ID); err != nil {
+		t.Fatalf("could not revoke session: %v", err)
+	}
+	if _, err := store.GetSession(session.ID); errors.Cause(err) != shared.ErrNoSessionFound {
+		t.Fatalf("revoked session was found: %v", err)
+	}
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		_, session, err := store.CreateSession(user)
+		if err != nil {
+			t.Fatalf("could not create session: %v", err)
+		}
+		ids = append(ids, session.ID)
+	}
+	if err := store.RevokeUserSessions(testData.oAuthProvider, testData.oAuthID); err != nil {
+		t.Fatalf("could not revoke sessions: %v", err)
+	}
+	for _, id := range ids {
+		if _, err := store.GetSession(id); errors.Cause(err) != shared.ErrNoSessionFound {
+			t.Errorf("session %s was not revoked: %v", id, err)
+		}
+	}
+
+	store.sessionLifetime = -time.Minute
+	refreshToken, session, err = store.CreateSession(user)
+	if err != nil {
+		t.Fatalf("could not create session: %v", err)
+	}
+	if _, err := store.GetSession(session.ID); errors.Cause(err) != shared.ErrNoSessionFound {
+		t.Fatalf("expired session was found: %v", err)
+	}
+	if _, _, err := store.RefreshSession(refreshToken); err != ErrInvalidRefreshToken {
+		t.Fatalf("expired session was refreshed: %v", err)
+	}
+}
+
+func TestCreateEntryWithReservedID(t *testing.T) {
+	util.SetConfig(util.Configuration{
+		DataDir:         testData.DataDir,
+		Backend:         "boltdb",
+		ShortedIDLength: 4,
+	})
+	if err := os.MkdirAll(testData.DataDir, 0755); err != nil {
+		t.Fatalf("could not create data dir: %v", err)
+	}
+	defer os.RemoveAll(testData.DataDir)
+	store, err := New()
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	defer store.Close()
+	tt := []struct {
+		id       string
+		expected error
+	}{
+		{"ok", ErrReservedID},
+		{"api", ErrReservedID},
+		{"api/v1/info", ErrReservedID},
+		{"static/js/main.js", ErrReservedID},
+		{"favicon.ico", ErrReservedID},
+		{"apis", nil},
+		{"okay/api", nil},
+	}
+	for _, tc := range tt {
+		t.Run(tc.id, func(t *testing.T) {
+			_, _, err := store.CreateEntry(testData.Entry, tc.id, "")
+			if err != tc.expected {
+				t.Fatalf("expected error: %v; got: %v", tc.expected, err)
+			}
+			if _, err := store.GetEntryByID(tc.id); (err == nil) != (tc.expected == nil) {
+				t.Errorf("unexpected lookup result of the entry: %v", err)
+			}
+		})
+	}
+}
+
+func TestCreateEntries(t *testing.T) {
+	util.SetConfig(util.Configuration{
+		DataDir:         testData.DataDir,
+		Backend:         "boltdb",
+		ShortedIDLength: 4,
+	})
+	if err := os.MkdirAll(testData.DataDir, 0755); err != nil {
+		t.Fatalf("could not create data dir: %v", err)
+	}
+	defer os.RemoveAll(testData.DataDir)
+	store, err := New()
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	defer store.Close()
+	entry := testData.Entry
+	entry.OAuthProvider, entry.OAuthID = testData.oAuthProvider, testData.oAuthID
+	if _, _, err := store.CreateEntry(entry, "taken", ""); err != nil {
+		t.Fatalf("could not create entry: %v", err)
+	}
+	invalid := entry
+	invalid.Public.URL = "this is no URL"
+	if _, err := store.CreateEntries(nil, true); err != ErrNoEntries {
+		t.Fatalf("unexpected error for no entries: %v", err)
+	}
+	var passwords []BulkEntry
+	for i := 0; i <= maxBulkPasswords; i++ {
+		passwords = append(passwords, BulkEntry{Entry: entry, Password: fmt.Sprintf("secret%d", i)})
+	}
+	passwords = append(passwords, BulkEntry{Entry: entry, Password: "secret0"})
+	results, err := store.CreateEntries(passwords, false)
+	if err != nil {
+		t.Fatalf("could not create entries: %v", err)
+	}
+	for i, result := range results {
+		if expected := i == maxBulkPasswords; (result.Err == ErrTooManyPasswords) != expected || (result.Err == nil) == expected {
+			t.Fatalf("unexpected error of entry %d: %v", i, result.Err)
+		}
+	}
+	tt := []struct {
+		name     string
+		entries  []BulkEntry
+		atomic   bool
+		expected []error
+	}{
+		{"atomic", []BulkEntry{{Entry: entry}, {Entry: entry, ID: "bulk-a"}}, true, []error{nil, nil}},
+		{"atomic with invalid URL", []BulkEntry{{Entry: entry}, {Entry: invalid}}, true, []error{ErrBulkAborted, ErrNoValidURL}},
+		{"atomic with duplicate ID", []BulkEntry{{Entry: entry, ID: "bulk-b"}, {Entry: entry, ID: "bulk-b"}}, true, []error{ErrBulkAborted, ErrDuplicateID}},
+		{"atomic with existing ID", []BulkEntry{{Entry: entry, ID: "bulk-c"}, {Entry: entry, ID: "taken"}}, true, []error{ErrBulkAborted, shared.ErrEntryAlreadyExists}},
+		{"best-effort", []BulkEntry{{Entry: entry, ID: "bulk-d"}, {Entry: invalid}, {Entry: entry, ID: "taken"}, {Entry: entry}}, false, []error{nil, ErrNoValidURL, shared.ErrEntryAlreadyExists, nil}},
+		{"best-effort with reserved IDs", []BulkEntry{{Entry: entry, ID: "api/v1/info"}, {Entry: entry, ID: "favicon.ico"}, {Entry: entry, ID: "bulk-e"}}, false, []error{ErrReservedID, ErrReservedID, nil}},
+		{"best-effort with passwords", []BulkEntry{{Entry: entry, ID: "bulk-f", Password: "secret"}, {Entry: entry, ID: "bulk-g", Password: "secret"}}, false, []error{nil, nil}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := store.CreateEntries(tc.entries, tc.atomic)
+			if err != nil {
+				t.Fatalf("could not create entries: %v", err)
+			}
+			for i, result := range results {
+				if errors.Cause(result.Err) != tc.expected[i] {
+					t.Fatalf("unexpected error of entry %d: %v; expected: %v", i, result.Err, tc.expected[i])
+				}
+				_, err := store.GetEntryByID(result.ID)
+				if result.Err == nil && (result.ID == "" || err != nil) {
+					t.Fatalf("entry %d was not created: %v", i, err)
+				}
+				if tc.entries[i].Password != "" && result.Err == nil {
+					created, err := store.GetEntryByID(result.ID)
+					if err != nil || store.CheckPassword(result.ID, "203.0.113.1", created, tc.entries[i].Password) != nil {
+						t.Fatalf("password of entry %d is not the expected one: %v", i, err)
+					}
+				}
+				if tc.entries[i].ID != "" && tc.entries[i].ID != "taken" && tc.expected[i] != ErrReservedID {
+					_, err := store.GetEntryByID(tc.entries[i].ID)
+					if created := err == nil; created != (result.Err == nil) {
+						t.Fatalf("entry %d was created: %v; expected: %v", i, created, result.Err == nil)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package stores
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+)
+
+// ErrNoValidTeamName is returned when the name of a team is empty
+var ErrNoValidTeamName = errors.New("the given team name is not valid")
+
+// ErrInvalidIdentity is returned when an identity is not in the form of 'provider/id'
+var ErrInvalidIdentity = errors.New("the given identity is not valid, it has to be in the form of 'provider/id'")
+
+// validIdentity checks if the identity is in the form of 'provider/id'
+func validIdentity(identity string) bool {
+	slash := strings.Index(identity, "/")
+	return slash > 0 && slash < len(identity)-1
+}
+
+// CreateTeam creates a team of which the creator is the first member
+func (s *Store) CreateTeam(name, creator string) (*shared.Team, error) {
+	if name = strings.TrimSpace(name); name == "" {
+		return nil, ErrNoValidTeamName
+	}
+	team := shared.Team{
+		ID:        uuid.New(),
+		Name:      name,
+		Members:   []string{creator},
+		CreatedBy: creator,
+		CreatedOn: time.Now(),
+	}
+	if err := s.storage.CreateTeam(team); err != nil {
+		return nil, errors.Wrap(err, "could not create team")
+	}
+	return &team, nil
+}
+
+// GetTeam returns a team by its ID
+func (s *Store) GetTeam(id string) (*shared.Team, error) {
+	if id == "" {
+		return nil, shared.ErrNoTeamFound
+	}
+	return s.storage.GetTeam(id)
+}
+
+// GetUserTeams returns the teams of which the user is a member
+func (s *Store) GetUserTeams(oAuthProvider, oAuthID string) ([]shared.Team, error) {
+	teams, err := s.storage.GetUserTeams(shared.Identity(oAuthProvider, oAuthID))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get user teams")
+	}
+	return teams, nil
+}
+
+// AddTeamMember adds a user by its identity to the members of a team
+func (s *Store) AddTeamMember(id, identity string) error {
+	if identity = strings.TrimSpace(identity); !validIdentity(identity) {
+		return ErrInvalidIdentity
+	}
+	return s.storage.AddTeamMember(id, identity)
+}
+
+// RemoveTeamMember removes a user by its identity from the members of a team
+func (s *Store) RemoveTeamMember(id, identity string) error {
+	return s.storage.RemoveTeamMember(id, identity)
+}
+
+// GetTeamEntries returns the entries which are owned by a team
+func (s *Store) GetTeamEntries(id string) (map[string]shared.Entry, error) {
+	entries, err := s.storage.GetUserEntries(shared.TeamEntriesPrefix + id)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get team entries")
+	}
+	return entries, nil
+}
+
+// getEntryOwner returns the identifier under which an entry is stored,
+// entries of a team belong to the team instead of their creator
+func getEntryOwner(entry shared.Entry) string {
+	if entry.TeamID != "" {
+		return shared.TeamEntriesPrefix + entry.TeamID
+	}
+	return getUserIdentifier(entry.OAuthProvider, entry.OAuthID)
+}
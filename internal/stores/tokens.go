@@ -0,0 +1,99 @@
+package stores
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// APITokenPrefix is the prefix of personal API tokens, it distinguishes
+// them from JWTs
+const APITokenPrefix = "gus_"
+
+// apiTokenTouchInterval is how often the last usage of an API token is saved
+const apiTokenTouchInterval = time.Minute
+
+// ErrNoValidTokenName is returned when the name of an API token is empty
+var ErrNoValidTokenName = errors.New("the given token name is not valid")
+
+// ErrInvalidTokenScope is returned when the scope of an API token is unknown
+var ErrInvalidTokenScope = errors.New("the given token scope is not valid, it has to be 'full', 'read' or 'create'")
+
+// hashToken returns the hex encoded SHA-256 hash under which a token is stored
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// CreateAPIToken creates a personal API token with the name, the scope and
+// the user of the given token. The token itself is only returned once, only
+// its hash is stored.
+func (s *Store) CreateAPIToken(token shared.APIToken) (string, *shared.APIToken, error) {
+	if token.Name = strings.TrimSpace(token.Name); token.Name == "" {
+		return "", nil, ErrNoValidTokenName
+	}
+	switch token.Scope {
+	case "":
+		token.Scope = shared.TokenScopeFull
+	case shared.TokenScopeFull, shared.TokenScopeRead, shared.TokenScopeCreate:
+	default:
+		return "", nil, ErrInvalidTokenScope
+	}
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", nil, errors.Wrap(err, "could not generate token")
+	}
+	plain := APITokenPrefix + base64.RawURLEncoding.EncodeToString(random)
+	token.ID = uuid.New()
+	token.Hash = hashToken(plain)
+	token.CreatedOn = time.Now()
+	token.LastUsed = nil
+	if err := s.storage.CreateAPIToken(shared.Identity(token.OAuthProvider, token.OAuthID), token); err != nil {
+		return "", nil, errors.Wrap(err, "could not create API token")
+	}
+	return plain, &token, nil
+}
+
+// AuthenticateAPIToken returns the API token which matches the given token
+// and saves that it was used
+func (s *Store) AuthenticateAPIToken(plain string) (*shared.APIToken, error) {
+	if !strings.HasPrefix(plain, APITokenPrefix) {
+		return nil, shared.ErrNoAPITokenFound
+	}
+	hash := hashToken(plain)
+	token, err := s.storage.GetAPIToken(hash)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	// the last usage is only saved once in a while to not write on every request
+	if token.LastUsed == nil || now.Sub(*token.LastUsed) > apiTokenTouchInterval {
+		if err := s.storage.TouchAPIToken(hash, now); err != nil {
+			logrus.Warningf("could not save last usage of API token %s: %v", token.ID, err)
+		}
+		token.LastUsed = &now
+	}
+	return token, nil
+}
+
+// GetAPITokens returns the API tokens of a user
+func (s *Store) GetAPITokens(oAuthProvider, oAuthID string) ([]shared.APIToken, error) {
+	tokens, err := s.storage.GetAPITokens(shared.Identity(oAuthProvider, oAuthID))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get API tokens")
+	}
+	return tokens, nil
+}
+
+// RevokeAPIToken deletes an API token of a user by its ID
+func (s *Store) RevokeAPIToken(oAuthProvider, oAuthID, id string) error {
+	return s.storage.DeleteAPIToken(shared.Identity(oAuthProvider, oAuthID), id)
+}
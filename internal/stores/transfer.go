@@ -0,0 +1,69 @@
+package stores
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidNewOwner is returned when the new owner of an entry is neither a user nor a team
+var ErrInvalidNewOwner = errors.New("the given owner is not valid, it has to be in the form of 'provider/id' or 'team:<id>'")
+
+// ErrAlreadyOwner is returned when an entry is transferred to its current owner
+var ErrAlreadyOwner = errors.New("the entry is already owned by the given owner")
+
+// TransferEntry reassigns an entry to another user, given by its identity in
+// the form of 'provider/id', or to a team, given as 'team:<id>'. The transfer
+// is recorded in the audit log together with the identity of the actor.
+func (s *Store) TransferEntry(id, to, actor string) error {
+	to = strings.TrimSpace(to)
+	var owner shared.Entry
+	if strings.HasPrefix(to, shared.TeamEntriesPrefix) {
+		owner.TeamID = strings.TrimPrefix(to, shared.TeamEntriesPrefix)
+		if _, err := s.GetTeam(owner.TeamID); err != nil {
+			return err
+		}
+	} else if validIdentity(to) {
+		parts := strings.SplitN(to, "/", 2)
+		owner.OAuthProvider, owner.OAuthID = parts[0], parts[1]
+	} else {
+		return ErrInvalidNewOwner
+	}
+	var transferred shared.Entry
+	err := s.storage.TransferEntry(id, getEntryOwner(owner), func(entry *shared.Entry) (*shared.AuditEvent, error) {
+		from := EntryOwnerIdentity(*entry)
+		if from == to {
+			return nil, ErrAlreadyOwner
+		}
+		// the creator of an entry stays the same if it is transferred to a team
+		entry.TeamID = owner.TeamID
+		if owner.TeamID == "" {
+			entry.OAuthProvider, entry.OAuthID = owner.OAuthProvider, owner.OAuthID
+		}
+		transferred = *entry
+		return &shared.AuditEvent{
+			Action:    shared.AuditEntryTransferred,
+			EntryID:   id,
+			Actor:     actor,
+			From:      from,
+			To:        to,
+			Timestamp: time.Now(),
+		}, nil
+	})
+	if err != nil {
+		return err
+	}
+	s.indexEntry(id, transferred)
+	return nil
+}
+
+// GetAuditEvents returns the latest events of the audit log, the newest first
+func (s *Store) GetAuditEvents(limit int) ([]shared.AuditEvent, error) {
+	events, err := s.storage.GetAuditEvents(limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get audit events")
+	}
+	return events, nil
+}
@@ -0,0 +1,341 @@
+package stores
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mxschmitt/golang-url-shortener/internal/metadata"
+	"github.com/mxschmitt/golang-url-shortener/internal/stores/shared"
+	"github.com/mxschmitt/golang-url-shortener/internal/util"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrNoValidWebhookURL is returned when the URL of a webhook is not valid
+var ErrNoValidWebhookURL = errors.New("the given webhook URL is no valid http or https URL")
+
+// ErrForbiddenWebhookURL is returned when the host of a webhook URL can't
+// be resolved or resolves to a private, loopback or link-local address
+var ErrForbiddenWebhookURL = errors.New("the given webhook URL does not resolve to an allowed address")
+
+// ErrInvalidWebhookEvent is returned when a webhook subscribes an unknown event
+var ErrInvalidWebhookEvent = errors.New("the given webhook event is not valid")
+
+const (
+	// maxWebhookBackoff caps the wait time between two delivery attempts
+	maxWebhookBackoff = 6 * time.Hour
+	// webhookClaimLimit is the amount of deliveries which are claimed at once
+	webhookClaimLimit = 10
+	// webhookDeliveryLogLimit is the amount of deliveries which are returned in the log
+	webhookDeliveryLogLimit = 100
+	// webhookSignatureHeader contains the HMAC-SHA256 of the payload with the webhook secret
+	webhookSignatureHeader = "X-Gus-Signature"
+)
+
+// WebhookPayload is the JSON body which is sent to the webhooks
+type WebhookPayload struct {
+	Event     string
+	Timestamp time.Time
+	EntryID   string
+	Data      interface{}
+}
+
+// webhookSettings holds the parsed webhook settings and the global webhooks
+type webhookSettings struct {
+	global               []shared.Webhook
+	maxAttempts          int
+	backoffBase, timeout time.Duration
+	allowPrivate         bool
+	// global webhooks are configured by the administrator and may target
+	// internal services, the ones of users only public addresses
+	globalClient, userClient *http.Client
+}
+
+func newWebhookSettings() (webhookSettings, error) {
+	conf := util.GetConfig().Webhooks
+	w := webhookSettings{maxAttempts: conf.MaxAttempts, allowPrivate: conf.AllowPrivate}
+	if w.maxAttempts <= 0 {
+		w.maxAttempts = 1
+	}
+	var err error
+	if w.backoffBase, err = parseDurationOr(conf.BackoffBase, 10*time.Second); err != nil {
+		return w, errors.Wrap(err, "could not parse backoff base")
+	}
+	if w.timeout, err = parseDurationOr(conf.Timeout, 10*time.Second); err != nil {
+		return w, errors.Wrap(err, "could not parse timeout")
+	}
+	w.globalClient = &http.Client{Timeout: w.timeout}
+	w.userClient = metadata.NewClient(w.timeout, w.allowPrivate)
+	events := splitList(conf.Events)
+	for _, event := range events {
+		if !validWebhookEvent(event) {
+			return w, ErrInvalidWebhookEvent
+		}
+	}
+	for i, u := range splitList(conf.URLs) {
+		if !validWebhookURL(u) {
+			return w, ErrNoValidWebhookURL
+		}
+		w.global = append(w.global, shared.Webhook{
+			ID:     fmt.Sprintf("global-%d", i),
+			URL:    u,
+			Secret: conf.Secret,
+			Events: events,
+		})
+	}
+	return w, nil
+}
+
+// parseDurationOr parses a duration and falls back to the given one if it is empty
+func parseDurationOr(duration string, fallback time.Duration) (time.Duration, error) {
+	if duration == "" {
+		return fallback, nil
+	}
+	return time.ParseDuration(duration)
+}
+
+// splitList splits a comma separated list and drops empty items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func validWebhookURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func validWebhookEvent(event string) bool {
+	for _, e := range shared.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateWebhook validates and saves a webhook of a user, a secret is
+// generated if none is given. The secret is only returned here.
+func (s *Store) CreateWebhook(oAuthProvider, oAuthID string, webhook shared.Webhook) (*shared.Webhook, error) {
+	if !validWebhookURL(webhook.URL) {
+		return nil, ErrNoValidWebhookURL
+	}
+	for _, event := range webhook.Events {
+		if !validWebhookEvent(event) {
+			return nil, ErrInvalidWebhookEvent
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.webhooks.timeout)
+	defer cancel()
+	if err := metadata.CheckURL(ctx, webhook.URL, s.webhooks.allowPrivate); err != nil {
+		logrus.Debugf("webhook URL %s is not allowed: %v", webhook.URL, err)
+		return nil, ErrForbiddenWebhookURL
+	}
+	if webhook.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, errors.Wrap(err, "could not generate secret")
+		}
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+	webhook.ID = uuid.New()
+	webhook.CreatedOn = time.Now()
+	if err := s.storage.CreateWebhook(getUserIdentifier(oAuthProvider, oAuthID), webhook); err != nil {
+		return nil, errors.Wrap(err, "could not create webhook")
+	}
+	return &webhook, nil
+}
+
+// GetWebhooks returns the webhooks of a user without their secrets
+func (s *Store) GetWebhooks(oAuthProvider, oAuthID string) ([]shared.Webhook, error) {
+	webhooks, err := s.storage.GetWebhooks(getUserIdentifier(oAuthProvider, oAuthID))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get webhooks")
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes a webhook of a user
+func (s *Store) DeleteWebhook(oAuthProvider, oAuthID, id string) error {
+	return errors.Wrap(s.storage.DeleteWebhook(getUserIdentifier(oAuthProvider, oAuthID), id), "could not delete webhook")
+}
+
+// GetWebhookDeliveries returns the latest deliveries to the webhooks of a user
+func (s *Store) GetWebhookDeliveries(oAuthProvider, oAuthID string) ([]shared.WebhookDelivery, error) {
+	deliveries, err := s.storage.GetDeliveries(getUserIdentifier(oAuthProvider, oAuthID), webhookDeliveryLogLimit)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get deliveries")
+	}
+	return deliveries, nil
+}
+
+// dispatch queues a delivery of the event for every global webhook and
+// every webhook of the owner of the entry which subscribed it
+func (s *Store) dispatch(event, userIdentifier, entryID string, data interface{}) {
+	webhooks := s.webhooks.global
+	if userIdentifier != "" {
+		userWebhooks, err := s.storage.GetWebhooks(userIdentifier)
+		if err != nil {
+			logrus.Warningf("could not get webhooks of %s: %v", userIdentifier, err)
+		}
+		webhooks = append(userWebhooks, webhooks...)
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+	now := time.Now()
+	payload, err := json.Marshal(WebhookPayload{
+		Event:     event,
+		Timestamp: now,
+		EntryID:   entryID,
+		Data:      data,
+	})
+	if err != nil {
+		logrus.Warningf("could not marshal webhook payload: %v", err)
+		return
+	}
+	for i, webhook := range webhooks {
+		if !webhook.Subscribes(event) {
+			continue
+		}
+		delivery := shared.WebhookDelivery{
+			ID:          uuid.New(),
+			WebhookID:   webhook.ID,
+			URL:         webhook.URL,
+			Event:       event,
+			Payload:     payload,
+			Signature:   signPayload(webhook.Secret, payload),
+			Status:      shared.DeliveryPending,
+			NextAttempt: now,
+			CreatedOn:   now,
+			UpdatedOn:   now,
+		}
+		if i < len(webhooks)-len(s.webhooks.global) {
+			delivery.UserIdentifier = userIdentifier
+		}
+		if err := s.storage.SaveDelivery(delivery); err != nil {
+			logrus.Warningf("could not queue webhook delivery: %v", err)
+		}
+	}
+}
+
+// dispatchExpired dispatches the expired event of an entry only once,
+// even if the expired entry is accessed again or by multiple instances
+func (s *Store) dispatchExpired(id string, entry *shared.Entry) {
+	set, err := s.storage.SetIfAbsent("expired:"+id, 0)
+	if err != nil {
+		logrus.Warningf("could not mark entry %s as expired: %v", id, err)
+		return
+	}
+	if set {
+		s.dispatch(shared.EventEntryExpired, getUserIdentifier(entry.OAuthProvider, entry.OAuthID), id, entry.Public)
+	}
+}
+
+// signPayload returns the hex encoded HMAC-SHA256 of the payload
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliverWebhooks periodically claims the due deliveries and sends them
+func (s *Store) deliverWebhooks(interval time.Duration) {
+	defer s.workers.Done()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+		// deliveries which are not finished until the timeout are claimed again
+		deliveries, err := s.storage.ClaimDeliveries(time.Now(), 2*s.webhooks.timeout, webhookClaimLimit)
+		if err != nil {
+			logrus.Warningf("could not claim webhook deliveries: %v", err)
+			continue
+		}
+		for _, delivery := range deliveries {
+			client := s.webhooks.globalClient
+			if delivery.UserIdentifier != "" {
+				client = s.webhooks.userClient
+			}
+			s.workers.Add(1)
+			go func(client *http.Client, delivery shared.WebhookDelivery) {
+				defer s.workers.Done()
+				s.deliver(ctx, client, delivery)
+			}(client, delivery)
+		}
+	}
+}
+
+// deliver sends a delivery to its webhook and saves the result, failed
+// deliveries are retried with an exponential backoff
+func (s *Store) deliver(ctx context.Context, client *http.Client, delivery shared.WebhookDelivery) {
+	delivery.Attempts++
+	delivery.ResponseStatus, delivery.LastError = 0, ""
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		delivery.LastError = err.Error()
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "golang-url-shortener")
+		req.Header.Set("X-Gus-Event", delivery.Event)
+		req.Header.Set("X-Gus-Delivery", delivery.ID)
+		req.Header.Set(webhookSignatureHeader, delivery.Signature)
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			delivery.LastError = err.Error()
+		} else {
+			resp.Body.Close()
+			delivery.ResponseStatus = resp.StatusCode
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				delivery.LastError = "unexpected status: " + resp.Status
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		// the store is closed, the claim expires and the delivery is retried
+		return
+	}
+	now := time.Now()
+	delivery.UpdatedOn = now
+	switch {
+	case delivery.LastError == "":
+		delivery.Status = shared.DeliveryDelivered
+	case delivery.Attempts >= s.webhooks.maxAttempts:
+		delivery.Status = shared.DeliveryFailed
+		logrus.Warningf("webhook delivery %s to %s failed finally: %s", delivery.ID, delivery.URL, delivery.LastError)
+	default:
+		backoff := s.webhooks.backoffBase << uint(delivery.Attempts-1)
+		if backoff <= 0 || backoff > maxWebhookBackoff {
+			backoff = maxWebhookBackoff
+		}
+		delivery.NextAttempt = now.Add(backoff)
+	}
+	if err := s.storage.SaveDelivery(delivery); err != nil {
+		logrus.Warningf("could not save webhook delivery %s: %v", delivery.ID, err)
+	}
+}
@@ -0,0 +1,99 @@
+// Package useragent classifies User-Agent headers into browser, operating
+// system and device type and detects bots, based on an embedded rules file
+package useragent
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/gobuffalo/packr/v2"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Info is the classification of a User-Agent header, for bots
+// the name of the bot is used as browser
+type Info struct {
+	Browser, OS, DeviceType string
+	Bot                     bool
+}
+
+// Unknown is used for every property which could not be determined
+const Unknown = "Unknown"
+
+// DeviceTypeBot is the device type of bots and crawlers
+const DeviceTypeBot = "Bot"
+
+var rulesBox = packr.New("UserAgentRules", "./rules")
+
+// rule maps a substring of a User-Agent header to a name, the
+// rules are evaluated in order and the first match wins
+type rule struct {
+	Match string `yaml:"match"`
+	Name  string `yaml:"name"`
+}
+
+// ruleSet are the rules of the embedded rules file
+type ruleSet struct {
+	Bots     []rule `yaml:"bots"`
+	Browsers []rule `yaml:"browsers"`
+	OS       []rule `yaml:"os"`
+	Devices  []rule `yaml:"devices"`
+}
+
+var (
+	rules     ruleSet
+	rulesOnce sync.Once
+)
+
+// loadRules reads the rules file from the box
+func loadRules() (ruleSet, error) {
+	var set ruleSet
+	raw, err := rulesBox.Find("rules.yaml")
+	if err != nil {
+		return set, errors.Wrap(err, "could not find rules file")
+	}
+	if err := yaml.Unmarshal(raw, &set); err != nil {
+		return set, errors.Wrap(err, "could not unmarshal rules file")
+	}
+	for _, section := range [][]rule{set.Bots, set.Browsers, set.OS, set.Devices} {
+		for i := range section {
+			section[i].Match = strings.ToLower(section[i].Match)
+		}
+	}
+	return set, nil
+}
+
+func getRules() ruleSet {
+	rulesOnce.Do(func() {
+		var err error
+		if rules, err = loadRules(); err != nil {
+			logrus.Errorf("could not load the user agent rules: %v", err)
+		}
+	})
+	return rules
+}
+
+func matchRules(ua string, rules []rule) (string, bool) {
+	for _, r := range rules {
+		if strings.Contains(ua, r.Match) {
+			return r.Name, true
+		}
+	}
+	return Unknown, false
+}
+
+// Parse classifies the given User-Agent header
+func Parse(userAgent string) Info {
+	ua := strings.ToLower(userAgent)
+	set := getRules()
+	if name, ok := matchRules(ua, set.Bots); ok {
+		system, _ := matchRules(ua, set.OS)
+		return Info{Browser: name, OS: system, DeviceType: DeviceTypeBot, Bot: true}
+	}
+	browser, _ := matchRules(ua, set.Browsers)
+	system, _ := matchRules(ua, set.OS)
+	device, _ := matchRules(ua, set.Devices)
+	return Info{Browser: browser, OS: system, DeviceType: device}
+}
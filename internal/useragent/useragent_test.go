@@ -0,0 +1,58 @@
+package useragent
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tt := []struct {
+		name      string
+		userAgent string
+		expected  Info
+	}{
+		{
+			name:      "chrome on windows",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/70.0.3538.77 Safari/537.36",
+			expected:  Info{Browser: "Chrome", OS: "Windows", DeviceType: "Desktop"},
+		},
+		{
+			name:      "safari on iphone",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 12_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.0 Mobile/15E148 Safari/604.1",
+			expected:  Info{Browser: "Safari", OS: "iOS", DeviceType: "Mobile"},
+		},
+		{
+			name:      "firefox on linux",
+			userAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:63.0) Gecko/20100101 Firefox/63.0",
+			expected:  Info{Browser: "Firefox", OS: "Linux", DeviceType: "Desktop"},
+		},
+		{
+			name:      "slack unfurling",
+			userAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+			expected:  Info{Browser: "Slack", OS: Unknown, DeviceType: DeviceTypeBot, Bot: true},
+		},
+		{
+			name:      "twitter card",
+			userAgent: "Twitterbot/1.0",
+			expected:  Info{Browser: "Twitter", OS: Unknown, DeviceType: DeviceTypeBot, Bot: true},
+		},
+		{
+			name:      "googlebot on android",
+			userAgent: "Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X Build/MMB29P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/41.0.2272.96 Mobile Safari/537.36 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			expected:  Info{Browser: "Googlebot", OS: "Android", DeviceType: DeviceTypeBot, Bot: true},
+		},
+		{
+			name:      "unknown crawler",
+			userAgent: "ExampleCrawler/2.0",
+			expected:  Info{Browser: "Other bot", OS: Unknown, DeviceType: DeviceTypeBot, Bot: true},
+		},
+		{
+			name:     "empty",
+			expected: Info{Browser: Unknown, OS: Unknown, DeviceType: Unknown},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if info := Parse(tc.userAgent); info != tc.expected {
+				t.Fatalf("expected: %+v; got: %+v", tc.expected, info)
+			}
+		})
+	}
+}
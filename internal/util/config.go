@@ -14,23 +14,32 @@ import (
 
 // Configuration are the available config values
 type Configuration struct {
-	ListenAddr       string        `yaml:"ListenAddr" env:"LISTEN_ADDR"`
-	BaseURL          string        `yaml:"BaseURL" env:"BASE_URL"`
-	DisplayURL       string        `yaml:"DisplayURL" env:"DISPLAY_URL"`
-	DataDir          string        `yaml:"DataDir" env:"DATA_DIR"`
-	Backend          string        `yaml:"Backend" env:"BACKEND"`
-	AuthBackend      string        `yaml:"AuthBackend" env:"AUTH_BACKEND"`
-	UseSSL           bool          `yaml:"EnableSSL" env:"USE_SSL"`
-	EnableDebugMode  bool          `yaml:"EnableDebugMode" env:"ENABLE_DEBUG_MODE"`
-	EnableAccessLogs bool          `yaml:"EnableAccessLogs" env:"ENABLE_ACCESS_LOGS"`
-	EnableColorLogs  bool          `yaml:"EnableColorLogs" env:"ENABLE_COLOR_LOGS"`
-	ShortedIDLength  int           `yaml:"ShortedIDLength" env:"SHORTED_ID_LENGTH"`
-	Google           oAuthConf     `yaml:"Google" env:"GOOGLE"`
-	GitHub           oAuthConf     `yaml:"GitHub" env:"GITHUB"`
-	Microsoft        oAuthConf     `yaml:"Microsoft" env:"MICROSOFT"`
-	Okta             oAuthConf     `yaml:"Okta" env:"OKTA"`
-	Proxy            proxyAuthConf `yaml:"Proxy" env:"PROXY"`
-	Redis            redisConf     `yaml:"Redis" env:"REDIS"`
+	ListenAddr         string                 `yaml:"ListenAddr" env:"LISTEN_ADDR"`
+	BaseURL            string                 `yaml:"BaseURL" env:"BASE_URL"`
+	DisplayURL         string                 `yaml:"DisplayURL" env:"DISPLAY_URL"`
+	DataDir            string                 `yaml:"DataDir" env:"DATA_DIR"`
+	Backend            string                 `yaml:"Backend" env:"BACKEND"`
+	AuthBackend        string                 `yaml:"AuthBackend" env:"AUTH_BACKEND"`
+	UseSSL             bool                   `yaml:"EnableSSL" env:"USE_SSL"`
+	EnableDebugMode    bool                   `yaml:"EnableDebugMode" env:"ENABLE_DEBUG_MODE"`
+	EnableAccessLogs   bool                   `yaml:"EnableAccessLogs" env:"ENABLE_ACCESS_LOGS"`
+	EnableColorLogs    bool                   `yaml:"EnableColorLogs" env:"ENABLE_COLOR_LOGS"`
+	ShortedIDLength    int                    `yaml:"ShortedIDLength" env:"SHORTED_ID_LENGTH"`
+	Google             oAuthConf              `yaml:"Google" env:"GOOGLE"`
+	GitHub             oAuthConf              `yaml:"GitHub" env:"GITHUB"`
+	Microsoft          oAuthConf              `yaml:"Microsoft" env:"MICROSOFT"`
+	Okta               oAuthConf              `yaml:"Okta" env:"OKTA"`
+	Proxy              proxyAuthConf          `yaml:"Proxy" env:"PROXY"`
+	Redis              redisConf              `yaml:"Redis" env:"REDIS"`
+	PasswordProtection passwordProtectionConf `yaml:"PasswordProtection" env:"PASSWORD_PROTECTION"`
+	ClientIP           clientIPConf           `yaml:"ClientIP" env:"CLIENT_IP"`
+	Visitors           visitorsConf           `yaml:"Visitors" env:"VISITORS"`
+	Privacy            privacyConf            `yaml:"Privacy" env:"PRIVACY"`
+	Webhooks           webhooksConf           `yaml:"Webhooks" env:"WEBHOOKS"`
+	Metrics            metricsConf            `yaml:"Metrics" env:"METRICS"`
+	Admin              adminConf              `yaml:"Admin" env:"ADMIN"`
+	Metadata           metadataConf           `yaml:"Metadata" env:"METADATA"`
+	Sessions           sessionsConf           `yaml:"Sessions" env:"SESSIONS"`
 }
 
 type redisConf struct {
@@ -54,6 +63,68 @@ type proxyAuthConf struct {
 	RequireUserHeader bool   `yaml:"RequireUserHeader" env:"REQUIRE_USER_HEADER"`
 	UserHeader        string `yaml:"UserHeader" env:"USER_HEADER"`
 	DisplayNameHeader string `yaml:"DisplayNameHeader" env:"DISPLAY_NAME_HEADER"`
+	EmailHeader       string `yaml:"EmailHeader" env:"EMAIL_HEADER"`
+	LoginURL          string `yaml:"LoginURL" env:"LOGIN_URL"`
+}
+
+type passwordProtectionConf struct {
+	FreeAttempts     int    `yaml:"FreeAttempts" env:"FREE_ATTEMPTS"`
+	BackoffBase      string `yaml:"BackoffBase" env:"BACKOFF_BASE"`
+	MaxAttempts      int    `yaml:"MaxAttempts" env:"MAX_ATTEMPTS"`
+	LockoutDuration  string `yaml:"LockoutDuration" env:"LOCKOUT_DURATION"`
+	RememberDuration string `yaml:"RememberDuration" env:"REMEMBER_DURATION"`
+}
+
+type clientIPConf struct {
+	TrustedProxies string `yaml:"TrustedProxies" env:"TRUSTED_PROXIES"` // comma separated list of CIDRs
+	Header         string `yaml:"Header" env:"HEADER"`
+	TrustNone      bool   `yaml:"TrustNone" env:"TRUST_NONE"`
+}
+
+type visitorsConf struct {
+	Retention            string `yaml:"Retention" env:"RETENTION"`
+	CountryHeader        string `yaml:"CountryHeader" env:"COUNTRY_HEADER"`
+	CountBots            bool   `yaml:"CountBots" env:"COUNT_BOTS"`
+	DuplicateClickWindow string `yaml:"DuplicateClickWindow" env:"DUPLICATE_CLICK_WINDOW"`
+}
+
+type privacyConf struct {
+	IPMode            string `yaml:"IPMode" env:"IP_MODE"`
+	RespectDoNotTrack bool   `yaml:"RespectDoNotTrack" env:"RESPECT_DO_NOT_TRACK"`
+}
+
+type webhooksConf struct {
+	URLs         string `yaml:"URLs" env:"URLS"`     // comma separated list of global webhook URLs
+	Secret       string `yaml:"Secret" env:"SECRET"` // secret of the global webhooks
+	Events       string `yaml:"Events" env:"EVENTS"` // comma separated list of events for the global webhooks
+	MaxAttempts  int    `yaml:"MaxAttempts" env:"MAX_ATTEMPTS"`
+	BackoffBase  string `yaml:"BackoffBase" env:"BACKOFF_BASE"`
+	Timeout      string `yaml:"Timeout" env:"TIMEOUT"`
+	AllowPrivate bool   `yaml:"AllowPrivate" env:"ALLOW_PRIVATE"` // allows webhooks of users on private and loopback addresses
+}
+
+type metricsConf struct {
+	Enabled    bool   `yaml:"Enabled" env:"ENABLED"`
+	ListenAddr string `yaml:"ListenAddr" env:"LISTEN_ADDR"` // separate address of the metrics endpoint
+	Token      string `yaml:"Token" env:"TOKEN"`            // bearer token which is required to scrape the metrics
+}
+
+type adminConf struct {
+	Users       string `yaml:"Users" env:"USERS"`              // comma separated list of identities in the form of 'provider/id'
+	GroupHeader string `yaml:"GroupHeader" env:"GROUP_HEADER"` // header of the proxy which contains the comma separated groups of the user
+	Group       string `yaml:"Group" env:"GROUP"`
+}
+
+type metadataConf struct {
+	Enabled      bool   `yaml:"Enabled" env:"ENABLED"`
+	Timeout      string `yaml:"Timeout" env:"TIMEOUT"`
+	MaxSize      int    `yaml:"MaxSize" env:"MAX_SIZE"`           // bytes of a page which are read at most
+	AllowPrivate bool   `yaml:"AllowPrivate" env:"ALLOW_PRIVATE"` // allows to fetch pages on private and loopback addresses
+}
+
+type sessionsConf struct {
+	AccessTokenLifetime  string `yaml:"AccessTokenLifetime" env:"ACCESS_TOKEN_LIFETIME"`   // lifetime of the JWTs, they are renewed with the refresh token
+	RefreshTokenLifetime string `yaml:"RefreshTokenLifetime" env:"REFRESH_TOKEN_LIFETIME"` // a session ends if it was not refreshed within this time
 }
 
 // Config contains the default values
@@ -77,6 +148,41 @@ var Config = Configuration{
 		SessionDB:    "1",
 		SharedKey:    "secret",
 	},
+	PasswordProtection: passwordProtectionConf{
+		FreeAttempts:     3,
+		BackoffBase:      "1s",
+		MaxAttempts:      10,
+		LockoutDuration:  "15m",
+		RememberDuration: "24h",
+	},
+	ClientIP: clientIPConf{
+		TrustedProxies: "127.0.0.0/8,::1/128",
+		Header:         "X-Forwarded-For",
+	},
+	Visitors: visitorsConf{
+		DuplicateClickWindow: "10s",
+	},
+	Privacy: privacyConf{
+		IPMode:            "full",
+		RespectDoNotTrack: true,
+	},
+	Webhooks: webhooksConf{
+		MaxAttempts: 8,
+		BackoffBase: "10s",
+		Timeout:     "10s",
+	},
+	Metrics: metricsConf{
+		Enabled: true,
+	},
+	Metadata: metadataConf{
+		Enabled: true,
+		Timeout: "5s",
+		MaxSize: 1 << 20,
+	},
+	Sessions: sessionsConf{
+		AccessTokenLifetime:  "15m",
+		RefreshTokenLifetime: "720h",
+	},
 }
 
 // ReadInConfig loads the Configuration and other needed folders for further usage
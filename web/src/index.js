@@ -38,18 +38,20 @@ export default class BaseComponent extends Component {
     }
 
     checkAuth = () => {
-        const token = window.localStorage.getItem('token');
-        if (token) {
-            fetch('/api/v1/auth/check', {
-                method: 'POST',
-                credentials: 'include',
-                body: JSON.stringify({
-                    Token: token
-                }),
-                headers: {
-                    'Content-Type': 'application/json'
-                }
-            })
+        const check = () => fetch('/api/v1/auth/check', {
+            method: 'POST',
+            credentials: 'include',
+            body: JSON.stringify({
+                Token: window.localStorage.getItem('token')
+            }),
+            headers: {
+                'Content-Type': 'application/json'
+            }
+        })
+        if (window.localStorage.getItem('token')) {
+            check()
+                // renew an expired access token with the refresh token of the session
+                .then(res => res.status === 401 ? util.refreshToken().then(check, () => res) : res)
                 .then(res => res.ok ? res.json() : Promise.reject(`incorrect response status code: ${res.status}; text: ${res.statusText}`))
                 .then(d => this.setState({
                     userData: d,
@@ -95,8 +97,18 @@ export default class BaseComponent extends Component {
     }
 
     handleLogout = () => {
-        window.localStorage.removeItem("token")
-        this.setState({ authorized: false })
+        fetch('/api/v1/auth/logout', {
+            method: 'POST',
+            credentials: 'include',
+            headers: {
+                'Authorization': window.localStorage.getItem('token')
+            }
+        })
+            .catch(e => util._reportError(e, "logout"))
+            .then(() => {
+                window.localStorage.removeItem("token")
+                this.setState({ authorized: false })
+            })
     }
 
     render() {
@@ -7,15 +7,29 @@ export default class UtilHelper {
             .then(cb())
             .catch(e => this._reportError(e, "delete entry"))
     }
-    static _constructFetch(url, body, cbSucc, cbErr) {
-        fetch(url, {
-            method: "POST",
+    static refreshToken() {
+        // the refresh token is stored in the session cookie
+        return fetch("/api/v1/auth/refresh", { method: "POST", credentials: "include" })
+            .then(res => res.ok ? res.json() : Promise.reject(res))
+            .then(res => window.localStorage.setItem('token', res.Token))
+    }
+    static _authorizedFetch(url, options) {
+        const doFetch = () => fetch(url, {
+            ...options,
             credentials: "include",
-            body: JSON.stringify(body),
             headers: {
                 'Authorization': window.localStorage.getItem('token'),
                 'Content-Type': 'application/json'
             }
+        })
+        // the access token is short-lived, so it is renewed once if it was rejected
+        return doFetch()
+            .then(res => res.status === 403 ? this.refreshToken().then(doFetch, () => res) : res)
+    }
+    static _constructFetch(url, body, cbSucc, cbErr) {
+        this._authorizedFetch(url, {
+            method: "POST",
+            body: JSON.stringify(body)
         })
             .then(res => res.ok ? res.json() : Promise.reject(res.json()))
             .then(res => cbSucc ? cbSucc(res) : null)
@@ -45,13 +59,7 @@ export default class UtilHelper {
         this._constructFetch("/api/v1/protected/create", entry, cbSucc)
     }
     static getRecentURLs(cbSucc) {
-        fetch('/api/v1/protected/recent', {
-            credentials: "include",
-            headers: {
-                'Authorization': window.localStorage.getItem('token'),
-                'Content-Type': 'application/json'
-            }
-        })
+        this._authorizedFetch('/api/v1/protected/recent', {})
             .then(res => res.ok ? res.json() : Promise.reject(res.json()))
             .then(res => cbSucc ? cbSucc(res) : null)
             .catch(e => this._reportError(e, "recent"))